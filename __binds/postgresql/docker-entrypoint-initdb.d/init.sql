@@ -17,7 +17,7 @@ CREATE TABLE events (
     PRIMARY KEY (location_id, timestamp, type)
 );
 
-CREATE EXTENSION "uuid-ossp";
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
 
 ALTER TABLE events DROP CONSTRAINT events_pkey;
 ALTER TABLE events ADD id uuid DEFAULT uuid_generate_v4 ();
@@ -30,3 +30,113 @@ ALTER TABLE measurements DROP CONSTRAINT measurements_pkey;
 ALTER TABLE measurements ADD id uuid DEFAULT uuid_generate_v4 ();
 ALTER TABLE measurements ADD PRIMARY KEY (id);
 ALTER TABLE measurements ADD UNIQUE (sensor_id, timestamp);
+
+ALTER TABLE measurements ADD received_at INT;
+
+CREATE TABLE dead_letters (
+    id uuid DEFAULT uuid_generate_v4 () PRIMARY KEY,
+    topic VARCHAR (255) NOT NULL,
+    payload TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    received_at INT NOT NULL
+);
+CREATE INDEX dead_letters_received_at_idx ON dead_letters (received_at);
+
+ALTER TABLE measurements ADD sample_count INT NOT NULL DEFAULT 1;
+
+CREATE TABLE sensors (
+    id VARCHAR (255) PRIMARY KEY,
+    display_name VARCHAR (255) NOT NULL DEFAULT '',
+    location VARCHAR (255) NOT NULL DEFAULT '',
+    firmware_version VARCHAR (255) NOT NULL DEFAULT '',
+    first_seen INT,
+    last_seen INT
+);
+INSERT INTO sensors (id, first_seen, last_seen)
+    SELECT sensor_id, min(timestamp), max(timestamp) FROM measurements GROUP BY sensor_id;
+INSERT INTO sensors (id, display_name, location) VALUES
+    ('bedroom', 'Bedroom', 'bedroom'),
+    ('livingroom', 'Living room', 'livingroom')
+    ON CONFLICT (id) DO UPDATE SET display_name = excluded.display_name, location = excluded.location;
+
+ALTER TABLE sensors ADD status VARCHAR (16) NOT NULL DEFAULT 'unknown';
+ALTER TABLE sensors ADD status_changed_at INT;
+
+CREATE TABLE alert_rules (
+    id uuid DEFAULT uuid_generate_v4 () PRIMARY KEY,
+    name VARCHAR (255) NOT NULL DEFAULT '',
+    sensor_id VARCHAR (255) NOT NULL DEFAULT '',
+    metric VARCHAR (32) NOT NULL,
+    comparison VARCHAR (16) NOT NULL,
+    threshold DOUBLE PRECISION NOT NULL,
+    duration INT NOT NULL DEFAULT 0,
+    hysteresis DOUBLE PRECISION NOT NULL DEFAULT 0
+);
+
+CREATE TABLE alerts (
+    id uuid DEFAULT uuid_generate_v4 () PRIMARY KEY,
+    rule_id uuid NOT NULL REFERENCES alert_rules (id) ON DELETE CASCADE,
+    sensor_id VARCHAR (255) NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    started_at INT NOT NULL,
+    resolved_at INT
+);
+CREATE INDEX alerts_started_at_idx ON alerts (started_at);
+CREATE UNIQUE INDEX alerts_firing_idx ON alerts (rule_id, sensor_id) WHERE resolved_at IS NULL;
+
+CREATE TABLE measurements_5m (
+    sensor_id VARCHAR (255) NOT NULL,
+    timestamp INT NOT NULL,
+    count INT NOT NULL,
+    iaq_count INT NOT NULL,
+    iaq_sum DOUBLE PRECISION,
+    iaq_min DOUBLE PRECISION,
+    iaq_max DOUBLE PRECISION,
+    iaq_first DOUBLE PRECISION,
+    iaq_last DOUBLE PRECISION,
+    co2_count INT NOT NULL,
+    co2_sum DOUBLE PRECISION,
+    co2_min DOUBLE PRECISION,
+    co2_max DOUBLE PRECISION,
+    co2_first DOUBLE PRECISION,
+    co2_last DOUBLE PRECISION,
+    voc_count INT NOT NULL,
+    voc_sum DOUBLE PRECISION,
+    voc_min DOUBLE PRECISION,
+    voc_max DOUBLE PRECISION,
+    voc_first DOUBLE PRECISION,
+    voc_last DOUBLE PRECISION,
+    pressure_count INT NOT NULL,
+    pressure_sum DOUBLE PRECISION,
+    pressure_min DOUBLE PRECISION,
+    pressure_max DOUBLE PRECISION,
+    pressure_first DOUBLE PRECISION,
+    pressure_last DOUBLE PRECISION,
+    temperature_count INT NOT NULL,
+    temperature_sum DOUBLE PRECISION,
+    temperature_min DOUBLE PRECISION,
+    temperature_max DOUBLE PRECISION,
+    temperature_first DOUBLE PRECISION,
+    temperature_last DOUBLE PRECISION,
+    humidity_count INT NOT NULL,
+    humidity_sum DOUBLE PRECISION,
+    humidity_min DOUBLE PRECISION,
+    humidity_max DOUBLE PRECISION,
+    humidity_first DOUBLE PRECISION,
+    humidity_last DOUBLE PRECISION,
+    PRIMARY KEY (sensor_id, timestamp)
+);
+CREATE TABLE measurements_1h (LIKE measurements_5m INCLUDING ALL);
+CREATE TABLE measurements_1d (LIKE measurements_5m INCLUDING ALL);
+
+CREATE TABLE measurement_rollups_pending (
+    sensor_id VARCHAR (255) NOT NULL,
+    timestamp INT NOT NULL,
+    PRIMARY KEY (sensor_id, timestamp)
+);
+
+-- a single row, the rollups of all measurements from the timestamp on are built
+CREATE TABLE measurement_rollups_backfill (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    timestamp INT NOT NULL
+);
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/miselaytes-anton/airy/internal/comfort"
+	"github.com/miselaytes-anton/airy/internal/models"
+	"github.com/miselaytes-anton/airy/internal/notify"
+)
+
+const (
+	alertQueueSize  = 1000
+	alertBackoff    = 5 * time.Second
+	alertMaxBackoff = 5 * time.Minute
+)
+
+type alertEvaluatorOpts struct {
+	Rules  models.AlertRuleModelInterface
+	Alerts models.AlertModelInterface
+	// RefreshInterval is how often alert rules are reloaded from the database.
+	RefreshInterval time.Duration
+	// QueueSize is how many measurements may wait for evaluation, further measurements are dropped.
+	QueueSize int
+	// Backoff is how long loading rules or firing alerts is not retried after a failure,
+	// it doubles with every consecutive failure up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Notifications receives alerts firing and resolving, it may be nil.
+	Notifications notificationDispatcher
+	// Bands classify the value of a notification.
+	Bands    comfort.Bands
+	Now      func() time.Time
+	LogError *log.Logger
+	LogInfo  *log.Logger
+}
+
+// notificationDispatcher queues notifications for delivery without blocking.
+type notificationDispatcher interface {
+	Dispatch(n notify.Notification)
+}
+
+type alertKey struct {
+	ruleID   string
+	sensorID string
+}
+
+type alertState struct {
+	// breached is true when the last measurement breached the threshold,
+	// breachedSince is the timestamp of the first of consecutive breaching measurements.
+	breached      bool
+	breachedSince int64
+	firing        *models.Alert
+}
+
+// alertEvaluator evaluates alert rules against incoming measurements. An alert fires when the threshold of a rule
+// was breached by all measurements of a sensor for the duration of the rule, and resolves once a measurement
+// is back beyond the threshold and the hysteresis.
+// Measurements are evaluated in the background, so that database calls do not block receiving messages.
+type alertEvaluator struct {
+	alertEvaluatorOpts
+	// the state is only accessed by the goroutine evaluating queued measurements
+	rules    []models.AlertRule
+	loadedAt time.Time
+	// restored is true once alerts which were firing when the processor started are known.
+	restored bool
+	states   map[alertKey]*alertState
+	// backoff is the current backoff after failed loads, loads are skipped until retryAt.
+	backoff time.Duration
+	retryAt time.Time
+	queue   chan models.Measurement
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// newAlertEvaluator creates an alert evaluator and starts evaluating queued measurements in the background.
+func newAlertEvaluator(o alertEvaluatorOpts) *alertEvaluator {
+	e := &alertEvaluator{
+		alertEvaluatorOpts: o,
+		states:             make(map[alertKey]*alertState),
+		queue:              make(chan models.Measurement, o.QueueSize),
+		stop:               make(chan struct{}),
+		done:               make(chan struct{}),
+	}
+
+	go e.run()
+
+	return e
+}
+
+// Evaluate queues a measurement for evaluation without blocking, it is dropped when the queue is full.
+func (e *alertEvaluator) Evaluate(m models.Measurement) {
+	select {
+	case e.queue <- m:
+	default:
+		e.LogError.Printf("alert evaluation queue is full, measurement of sensor %s at %d was not evaluated", m.SensorID, m.Timestamp)
+	}
+}
+
+// Close evaluates the queued measurements and stops the evaluator.
+func (e *alertEvaluator) Close() {
+	close(e.stop)
+	<-e.done
+}
+
+func (e *alertEvaluator) run() {
+	defer close(e.done)
+
+	for {
+		select {
+		case m := <-e.queue:
+			e.evaluate(m)
+		case <-e.stop:
+			for {
+				select {
+				case m := <-e.queue:
+					e.evaluate(m)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// evaluate checks a measurement against all rules of its sensor.
+func (e *alertEvaluator) evaluate(m models.Measurement) {
+	e.refresh()
+
+	if !e.restored {
+		// without knowing the firing alerts, alerts could be fired twice
+		return
+	}
+
+	for _, rule := range e.rules {
+		if !rule.AppliesTo(m.SensorID) {
+			continue
+		}
+
+		value, ok := m.Metric(rule.Metric)
+		if !ok {
+			continue
+		}
+
+		key := alertKey{ruleID: rule.ID, sensorID: m.SensorID}
+		state, ok := e.states[key]
+		if !ok {
+			state = &alertState{}
+			e.states[key] = state
+		}
+
+		if state.firing != nil {
+			if rule.Recovered(value) {
+				e.resolve(rule, state, value, m.Timestamp)
+			}
+			continue
+		}
+
+		if !rule.Breached(value) {
+			state.breached = false
+			continue
+		}
+
+		if !state.breached {
+			state.breached = true
+			state.breachedSince = m.Timestamp
+		}
+
+		if m.Timestamp-state.breachedSince >= rule.Duration {
+			e.fire(rule, state, m.SensorID, value)
+		}
+	}
+}
+
+// refresh reloads rules when they are older than RefreshInterval and restores firing alerts.
+// After a failed load both are not retried until the backoff passed.
+func (e *alertEvaluator) refresh() {
+	now := e.Now()
+	if now.Before(e.retryAt) {
+		return
+	}
+
+	if !e.restored {
+		alerts, err := e.Alerts.GetFiring()
+		if err != nil {
+			e.LogError.Printf("firing alerts could not be loaded: %s", err)
+			e.failed(now)
+			return
+		}
+		for _, state := range e.states {
+			state.firing = nil
+		}
+		for _, a := range alerts {
+			a := a
+			key := alertKey{ruleID: a.RuleID, sensorID: a.SensorID}
+			e.states[key] = &alertState{breached: true, breachedSince: a.StartedAt, firing: &a}
+		}
+		e.restored = true
+		e.backoff = 0
+	}
+
+	if !e.loadedAt.IsZero() && now.Sub(e.loadedAt) < e.RefreshInterval {
+		return
+	}
+
+	rules, err := e.Rules.GetAll()
+	if err != nil {
+		e.LogError.Printf("alert rules could not be loaded: %s", err)
+		e.failed(now)
+		return
+	}
+
+	e.rules = rules
+	e.loadedAt = now
+	e.backoff = 0
+
+	// forget the state of deleted rules
+	ids := make(map[string]bool)
+	for _, rule := range rules {
+		ids[rule.ID] = true
+	}
+	for key := range e.states {
+		if !ids[key.ruleID] {
+			delete(e.states, key)
+		}
+	}
+}
+
+// failed backs off further loads after a failure.
+func (e *alertEvaluator) failed(now time.Time) {
+	e.backoff = min(max(2*e.backoff, e.Backoff), e.MaxBackoff)
+	e.retryAt = now.Add(e.backoff)
+}
+
+func (e *alertEvaluator) fire(rule models.AlertRule, state *alertState, sensorID string, value float64) {
+	alert, err := e.Alerts.FireAlert(models.Alert{
+		RuleID:    rule.ID,
+		SensorID:  sensorID,
+		Metric:    rule.Metric,
+		Value:     value,
+		StartedAt: state.breachedSince,
+	})
+	if errors.Is(err, models.ErrAlertAlreadyFiring) {
+		// the alert was fired by another process, reload firing alerts with the next measurement
+		e.restored = false
+		return
+	}
+	if err != nil {
+		e.LogError.Printf("alert %s for sensor %s could not be stored: %s", rule, sensorID, err)
+		return
+	}
+
+	state.firing = &alert
+	e.LogInfo.Printf("alert firing: %s, sensor %s value %g\n", rule, sensorID, value)
+	e.notify(rule, alert, models.AlertStatusFiring, value, alert.StartedAt)
+}
+
+func (e *alertEvaluator) resolve(rule models.AlertRule, state *alertState, value float64, timestamp int64) {
+	err := e.Alerts.ResolveAlert(state.firing.ID, timestamp)
+	if err != nil && !errors.Is(err, models.ErrAlertNotFound) {
+		e.LogError.Printf("alert %s for sensor %s could not be resolved: %s", rule, state.firing.SensorID, err)
+		return
+	}
+
+	e.LogInfo.Printf("alert resolved: %s, sensor %s\n", rule, state.firing.SensorID)
+	e.notify(rule, *state.firing, models.AlertStatusResolved, value, timestamp)
+	state.firing = nil
+	state.breached = false
+}
+
+func (e *alertEvaluator) notify(rule models.AlertRule, alert models.Alert, status string, value float64, timestamp int64) {
+	if e.Notifications == nil {
+		return
+	}
+
+	band, _ := e.Bands.Classify(rule.Metric, value)
+
+	e.Notifications.Dispatch(notify.Notification{
+		Key:       "alert:" + rule.ID + ":" + alert.SensorID,
+		Kind:      notify.KindAlert,
+		Status:    status,
+		SensorID:  alert.SensorID,
+		Rule:      rule.String(),
+		Metric:    rule.Metric,
+		Value:     value,
+		Band:      band.Name,
+		Timestamp: timestamp,
+	})
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/miselaytes-anton/airy/internal/comfort"
+	"github.com/miselaytes-anton/airy/internal/models"
+	"github.com/miselaytes-anton/airy/internal/models/mocks"
+	"github.com/miselaytes-anton/airy/internal/notify"
+)
+
+// notificationRecorder records dispatched notifications.
+type notificationRecorder struct {
+	mu            sync.Mutex
+	notifications []notify.Notification
+}
+
+func (r *notificationRecorder) Dispatch(n notify.Notification) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifications = append(r.notifications, n)
+}
+
+func (r *notificationRecorder) dispatched() []notify.Notification {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]notify.Notification(nil), r.notifications...)
+}
+
+func Test_alertEvaluator(t *testing.T) {
+	co2Rule := models.AlertRule{ID: "co2", SensorID: "bedroom", Metric: "co2", Comparison: models.ComparisonAbove, Threshold: 1000, Duration: 120, Hysteresis: 50}
+	humidityRule := models.AlertRule{ID: "humidity", Metric: "humidity", Comparison: models.ComparisonBelow, Threshold: 30}
+
+	co2 := func(timestamp int64, value float64) models.Measurement {
+		return models.Measurement{SensorID: "bedroom", Timestamp: timestamp, CO2: value, Humidity: 50}
+	}
+
+	data := []struct {
+		name         string
+		rules        []models.AlertRule
+		firing       []models.Alert
+		measurements []models.Measurement
+		expected     []models.Alert
+	}{
+		{
+			"fires after the duration",
+			[]models.AlertRule{co2Rule},
+			[]models.Alert{},
+			[]models.Measurement{co2(0, 1100), co2(60, 1200), co2(120, 1100)},
+			[]models.Alert{{ID: "uuid-1", RuleID: "co2", SensorID: "bedroom", Metric: "co2", Value: 1100, Status: "firing", StartedAt: 0}},
+		},
+		{
+			"does not fire when the breach is interrupted",
+			[]models.AlertRule{co2Rule},
+			[]models.Alert{},
+			[]models.Measurement{co2(0, 1100), co2(60, 900), co2(120, 1100), co2(180, 1100)},
+			[]models.Alert{},
+		},
+		{
+			"resolves beyond the hysteresis only",
+			[]models.AlertRule{co2Rule},
+			[]models.Alert{},
+			[]models.Measurement{co2(0, 1100), co2(120, 1100), co2(180, 980), co2(240, 1020), co2(300, 940)},
+			[]models.Alert{{ID: "uuid-1", RuleID: "co2", SensorID: "bedroom", Metric: "co2", Value: 1100, Status: "resolved", StartedAt: 0, ResolvedAt: 300}},
+		},
+		{
+			"fires again after resolving",
+			[]models.AlertRule{co2Rule},
+			[]models.Alert{},
+			[]models.Measurement{co2(0, 1100), co2(120, 1100), co2(180, 900), co2(240, 1100), co2(360, 1300)},
+			[]models.Alert{
+				{ID: "uuid-1", RuleID: "co2", SensorID: "bedroom", Metric: "co2", Value: 1100, Status: "resolved", StartedAt: 0, ResolvedAt: 180},
+				{ID: "uuid-2", RuleID: "co2", SensorID: "bedroom", Metric: "co2", Value: 1300, Status: "firing", StartedAt: 240},
+			},
+		},
+		{
+			"other sensors are ignored",
+			[]models.AlertRule{co2Rule},
+			[]models.Alert{},
+			[]models.Measurement{{SensorID: "livingroom", Timestamp: 0, CO2: 2000}, {SensorID: "livingroom", Timestamp: 300, CO2: 2000}},
+			[]models.Alert{},
+		},
+		{
+			"rules without sensor apply to all sensors",
+			[]models.AlertRule{humidityRule},
+			[]models.Alert{},
+			[]models.Measurement{{SensorID: "livingroom", Timestamp: 0, Humidity: 25}, {SensorID: "bedroom", Timestamp: 0, Humidity: 50}},
+			[]models.Alert{{ID: "uuid-1", RuleID: "humidity", SensorID: "livingroom", Metric: "humidity", Value: 25, Status: "firing"}},
+		},
+		{
+			"firing alerts are restored",
+			[]models.AlertRule{co2Rule},
+			[]models.Alert{{ID: "stored", RuleID: "co2", SensorID: "bedroom", Metric: "co2", Value: 1100, Status: "firing", StartedAt: 0}},
+			[]models.Measurement{co2(600, 1100), co2(660, 900)},
+			[]models.Alert{{ID: "stored", RuleID: "co2", SensorID: "bedroom", Metric: "co2", Value: 1100, Status: "resolved", StartedAt: 0, ResolvedAt: 660}},
+		},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				rulesMock := mocks.AlertRuleModelMock{
+					AlertRules:           d.rules,
+					GetAllAlertRulesMock: mocks.GetAllAlertRulesOkMock,
+				}
+				alertsMock := mocks.AlertModelMock{
+					Alerts:              d.firing,
+					GetFiringAlertsMock: mocks.GetFiringAlertsOkMock,
+					FireAlertMock:       mocks.FireAlertOkMock,
+					ResolveAlertMock:    mocks.ResolveAlertOkMock,
+				}
+
+				evaluator := newAlertEvaluator(alertEvaluatorOpts{
+					Rules:           &rulesMock,
+					Alerts:          &alertsMock,
+					RefreshInterval: time.Minute,
+					QueueSize:       len(d.measurements),
+					Now:             time.Now,
+					LogError:        log.New(io.Discard, "", 0),
+					LogInfo:         log.New(io.Discard, "", 0),
+				})
+
+				for _, m := range d.measurements {
+					evaluator.Evaluate(m)
+				}
+				// queued measurements are evaluated before the evaluator stops
+				evaluator.Close()
+
+				if diff := cmp.Diff(d.expected, alertsMock.Alerts); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
+
+func Test_alertEvaluator_databaseError(t *testing.T) {
+	rule := models.AlertRule{ID: "co2", Metric: "co2", Comparison: models.ComparisonAbove, Threshold: 1000}
+
+	rulesMock := mocks.AlertRuleModelMock{
+		AlertRules:           []models.AlertRule{rule},
+		GetAllAlertRulesMock: mocks.GetAllAlertRulesOkMock,
+	}
+	alertsMock := mocks.AlertModelMock{
+		Alerts:              make([]models.Alert, 0),
+		GetFiringAlertsMock: mocks.GetFiringAlertsOkMock,
+		FireAlertMock:       mocks.FireAlertErrorMock,
+		ResolveAlertMock:    mocks.ResolveAlertOkMock,
+	}
+
+	evaluator := newAlertEvaluator(alertEvaluatorOpts{
+		Rules:           &rulesMock,
+		Alerts:          &alertsMock,
+		RefreshInterval: time.Minute,
+		Now:             time.Now,
+		LogError:        log.New(io.Discard, "", 0),
+		LogInfo:         log.New(io.Discard, "", 0),
+	})
+	defer evaluator.Close()
+
+	evaluator.evaluate(models.Measurement{SensorID: "bedroom", Timestamp: 0, CO2: 1100})
+
+	// the alert is fired with the next measurement once the database is back
+	alertsMock.FireAlertMock = mocks.FireAlertOkMock
+	evaluator.evaluate(models.Measurement{SensorID: "bedroom", Timestamp: 60, CO2: 1200})
+
+	expected := []models.Alert{{ID: "uuid-1", RuleID: "co2", SensorID: "bedroom", Metric: "co2", Value: 1200, Status: "firing", StartedAt: 0}}
+	if diff := cmp.Diff(expected, alertsMock.Alerts); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_alertEvaluator_notifications(t *testing.T) {
+	rule := models.AlertRule{ID: "co2", SensorID: "bedroom", Metric: "co2", Comparison: models.ComparisonAbove, Threshold: 1000, Hysteresis: 50}
+
+	rulesMock := mocks.AlertRuleModelMock{
+		AlertRules:           []models.AlertRule{rule},
+		GetAllAlertRulesMock: mocks.GetAllAlertRulesOkMock,
+	}
+	alertsMock := mocks.AlertModelMock{
+		Alerts:              make([]models.Alert, 0),
+		GetFiringAlertsMock: mocks.GetFiringAlertsOkMock,
+		FireAlertMock:       mocks.FireAlertOkMock,
+		ResolveAlertMock:    mocks.ResolveAlertOkMock,
+	}
+	recorder := notificationRecorder{}
+
+	evaluator := newAlertEvaluator(alertEvaluatorOpts{
+		Rules:           &rulesMock,
+		Alerts:          &alertsMock,
+		RefreshInterval: time.Minute,
+		QueueSize:       3,
+		Notifications:   &recorder,
+		Bands:           comfort.Default(),
+		Now:             time.Now,
+		LogError:        log.New(io.Discard, "", 0),
+		LogInfo:         log.New(io.Discard, "", 0),
+	})
+
+	evaluator.Evaluate(models.Measurement{SensorID: "bedroom", Timestamp: 0, CO2: 1100})
+	evaluator.Evaluate(models.Measurement{SensorID: "bedroom", Timestamp: 60, CO2: 1200})
+	evaluator.Evaluate(models.Measurement{SensorID: "bedroom", Timestamp: 120, CO2: 900})
+	evaluator.Close()
+
+	expected := []notify.Notification{
+		{Key: "alert:co2:bedroom", Kind: "alert", Status: "firing", SensorID: "bedroom", Rule: "co2 of bedroom above 1000", Metric: "co2", Value: 1100, Band: "moderate", Timestamp: 0},
+		{Key: "alert:co2:bedroom", Kind: "alert", Status: "resolved", SensorID: "bedroom", Rule: "co2 of bedroom above 1000", Metric: "co2", Value: 900, Band: "moderate", Timestamp: 120},
+	}
+	if diff := cmp.Diff(expected, recorder.dispatched()); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_alertEvaluator_queueFull(t *testing.T) {
+	rulesMock := mocks.AlertRuleModelMock{
+		AlertRules:           []models.AlertRule{{ID: "co2", Metric: "co2", Comparison: models.ComparisonAbove, Threshold: 1000}},
+		GetAllAlertRulesMock: mocks.GetAllAlertRulesOkMock,
+	}
+	alertsMock := mocks.AlertModelMock{
+		Alerts:              make([]models.Alert, 0),
+		GetFiringAlertsMock: mocks.GetFiringAlertsOkMock,
+		FireAlertMock:       mocks.FireAlertOkMock,
+		ResolveAlertMock:    mocks.ResolveAlertOkMock,
+	}
+
+	// the evaluation of the first measurement blocks until it is released
+	release := make(chan struct{})
+	evaluating := make(chan struct{})
+	evaluator := newAlertEvaluator(alertEvaluatorOpts{
+		Rules:           &rulesMock,
+		Alerts:          &alertsMock,
+		RefreshInterval: time.Minute,
+		QueueSize:       1,
+		Now: func() time.Time {
+			select {
+			case evaluating <- struct{}{}:
+				<-release
+			default:
+			}
+			return time.Now()
+		},
+		LogError: log.New(io.Discard, "", 0),
+		LogInfo:  log.New(io.Discard, "", 0),
+	})
+
+	evaluator.Evaluate(models.Measurement{SensorID: "bedroom", Timestamp: 0, CO2: 1100})
+	<-evaluating
+
+	// Evaluate does not block while the evaluation is stuck on the database
+	evaluator.Evaluate(models.Measurement{SensorID: "kitchen", Timestamp: 0, CO2: 1100})
+	evaluator.Evaluate(models.Measurement{SensorID: "livingroom", Timestamp: 0, CO2: 1100})
+
+	close(release)
+	evaluator.Close()
+
+	sensors := make([]string, 0)
+	for _, a := range alertsMock.Alerts {
+		sensors = append(sensors, a.SensorID)
+	}
+	if diff := cmp.Diff([]string{"bedroom", "kitchen"}, sensors); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_alertEvaluator_backoff(t *testing.T) {
+	rulesMock := mocks.AlertRuleModelMock{
+		AlertRules:           []models.AlertRule{{ID: "co2", Metric: "co2", Comparison: models.ComparisonAbove, Threshold: 1000}},
+		GetAllAlertRulesMock: mocks.GetAllAlertRulesOkMock,
+	}
+	loads := 0
+	alertsMock := mocks.AlertModelMock{
+		Alerts: make([]models.Alert, 0),
+		GetFiringAlertsMock: func(alerts *[]models.Alert) ([]models.Alert, error) {
+			loads++
+			return nil, errors.New("database error")
+		},
+		FireAlertMock:    mocks.FireAlertOkMock,
+		ResolveAlertMock: mocks.ResolveAlertOkMock,
+	}
+
+	now := time.Unix(1702156335, 0)
+	evaluator := newAlertEvaluator(alertEvaluatorOpts{
+		Rules:           &rulesMock,
+		Alerts:          &alertsMock,
+		RefreshInterval: time.Minute,
+		Backoff:         time.Second,
+		MaxBackoff:      4 * time.Second,
+		Now:             func() time.Time { return now },
+		LogError:        log.New(io.Discard, "", 0),
+		LogInfo:         log.New(io.Discard, "", 0),
+	})
+	defer evaluator.Close()
+
+	measurement := models.Measurement{SensorID: "bedroom", Timestamp: 0, CO2: 1100}
+
+	// time elapsed before every evaluation and the expected number of loads after it
+	data := []struct {
+		elapsed time.Duration
+		loads   int
+	}{
+		{0, 1},
+		{500 * time.Millisecond, 1},
+		{500 * time.Millisecond, 2},
+		{time.Second, 2},
+		{time.Second, 3},
+		{4 * time.Second, 4},
+		{3 * time.Second, 4},
+		{time.Second, 5},
+	}
+
+	for i, d := range data {
+		now = now.Add(d.elapsed)
+		evaluator.evaluate(measurement)
+		if diff := cmp.Diff(d.loads, loads); diff != "" {
+			t.Errorf("evaluation %d: %s", i, diff)
+		}
+	}
+
+	// loads succeed again once the database is back
+	alertsMock.GetFiringAlertsMock = mocks.GetFiringAlertsOkMock
+	now = now.Add(4 * time.Second)
+	evaluator.evaluate(measurement)
+
+	expected := []models.Alert{{ID: "uuid-1", RuleID: "co2", SensorID: "bedroom", Metric: "co2", Value: 1100, Status: "firing"}}
+	if diff := cmp.Diff(expected, alertsMock.Alerts); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+)
+
+type spooledDeadLettersOpts struct {
+	DeadLetters models.DeadLetterModelInterface
+	// Spool stores dead letters while the database is unreachable.
+	Spool recordSpool
+	// DrainInterval is how often spooled dead letters are moved to the database.
+	DrainInterval time.Duration
+	LogError      *log.Logger
+	LogInfo       *log.Logger
+}
+
+// spooledDeadLetters stores dead letters in the database and appends them to the spool while the database is unreachable,
+// so that messages rejected during an outage are not lost. Spooled dead letters are moved to the database once it is
+// reachable again, from where they are replayed like any other dead letter.
+type spooledDeadLetters struct {
+	models.DeadLetterModelInterface
+	spooledDeadLettersOpts
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newSpooledDeadLetters creates the dead letter store and starts moving spooled dead letters to the database in the background.
+func newSpooledDeadLetters(o spooledDeadLettersOpts) *spooledDeadLetters {
+	d := &spooledDeadLetters{
+		DeadLetterModelInterface: o.DeadLetters,
+		spooledDeadLettersOpts:   o,
+		stop:                     make(chan struct{}),
+		done:                     make(chan struct{}),
+	}
+
+	go d.run()
+
+	return d
+}
+
+// InsertDeadLetter stores the dead letter in the database or, while the database is unavailable, in the spool.
+// The ID of a spooled dead letter is empty.
+func (d *spooledDeadLetters) InsertDeadLetter(deadLetter models.DeadLetter) (string, error) {
+	id, err := d.DeadLetters.InsertDeadLetter(deadLetter)
+	if err == nil || !models.IsUnavailableError(err) {
+		return id, err
+	}
+
+	// encoding a struct of strings and numbers can not fail
+	record, _ := json.Marshal(deadLetter)
+	if spoolErr := d.Spool.Append([][]byte{record}); spoolErr != nil {
+		return "", fmt.Errorf("%w, and it could not be spooled: %s", err, spoolErr)
+	}
+
+	d.LogError.Printf("database is unavailable, spooled dead letter: %s", err)
+
+	return "", nil
+}
+
+// Close stops moving spooled dead letters to the database, they are kept in the spool for the next run.
+func (d *spooledDeadLetters) Close() {
+	close(d.stop)
+	<-d.done
+}
+
+func (d *spooledDeadLetters) run() {
+	defer close(d.done)
+
+	ticker := time.NewTicker(d.DrainInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			if _, err := d.drain(); err != nil && !models.IsUnavailableError(err) {
+				d.LogError.Printf("dead letter spool could not be drained: %s", err)
+			}
+		}
+	}
+}
+
+// drain moves all spooled dead letters to the database and returns how many were moved.
+// It stops at the first segment which can not be moved, e.g. while the database is still unavailable,
+// dead letters of that segment which were already moved are moved again by the next attempt.
+func (d *spooledDeadLetters) drain() (int, error) {
+	moved := 0
+
+	for d.Spool.Size() > 0 {
+		_, err := d.Spool.Drain(func(records [][]byte) error {
+			for _, record := range records {
+				var deadLetter models.DeadLetter
+				if err := json.Unmarshal(record, &deadLetter); err != nil {
+					d.LogError.Printf("spooled dead letter could not be decoded (%s): %s", record, err)
+					continue
+				}
+
+				_, err := d.DeadLetters.InsertDeadLetter(deadLetter)
+				if models.IsUnavailableError(err) {
+					return err
+				}
+				if err != nil {
+					d.LogError.Printf("spooled dead letter could not be stored and is lost (%s): %s", record, err)
+					continue
+				}
+				moved++
+			}
+			return nil
+		})
+		if err != nil {
+			return moved, err
+		}
+	}
+
+	if moved > 0 {
+		d.LogInfo.Printf("moved %d spooled dead letters to the database\n", moved)
+	}
+
+	return moved, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+	"github.com/miselaytes-anton/airy/internal/models/mocks"
+	"github.com/miselaytes-anton/airy/internal/spool"
+)
+
+func Test_spooledDeadLetters(t *testing.T) {
+	s, err := spool.Open(t.TempDir(), 1024*1024, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	var insertErr error
+	deadLettersMock := mocks.DeadLetterModelMock{
+		DeadLetters: make([]models.DeadLetter, 0),
+		InsertDeadLetterMock: func(d models.DeadLetter, deadLetters *[]models.DeadLetter) (string, error) {
+			if insertErr != nil {
+				return "", insertErr
+			}
+			return mocks.InsertDeadLetterOkMock(d, deadLetters)
+		},
+	}
+
+	spooled := spooledDeadLetters{spooledDeadLettersOpts: spooledDeadLettersOpts{
+		DeadLetters: &deadLettersMock,
+		Spool:       s,
+		LogError:    log.New(io.Discard, "", 0),
+		LogInfo:     log.New(io.Discard, "", 0),
+	}}
+
+	first := models.DeadLetter{Topic: "measurement", Payload: "bedroom something", Reason: "message could not be parsed", ReceivedAt: 1702156335}
+	second := models.DeadLetter{Topic: "measurement", Payload: "bedroom 51.86", Reason: "message could not be parsed", ReceivedAt: 1702156336}
+
+	// while the database is unavailable dead letters are spooled
+	insertErr = &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}
+	for _, d := range []models.DeadLetter{first, second} {
+		if _, err := spooled.InsertDeadLetter(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if moved, err := spooled.drain(); moved != 0 || !models.IsUnavailableError(err) {
+		t.Errorf("expected nothing to be moved while the database is unavailable, got %d: %v", moved, err)
+	}
+
+	// other errors are not spooled, they would fail again
+	insertErr = errors.New("database error")
+	if _, err := spooled.InsertDeadLetter(first); !errors.Is(err, insertErr) {
+		t.Errorf("expected %v, got %v", insertErr, err)
+	}
+
+	insertErr = nil
+	moved, err := spooled.drain()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first.ID, second.ID = "uuid", "uuid"
+	if diff := cmp.Diff([]any{2, []models.DeadLetter{first, second}, int64(0)}, []any{moved, deadLettersMock.DeadLetters, s.Size()}); diff != "" {
+		t.Error(diff)
+	}
+
+	id, err := spooled.InsertDeadLetter(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]any{"uuid", int64(0)}, []any{id, s.Size()}); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const readinessTimeout = 2 * time.Second
+
+type processorHealthOpts struct {
+	// Connected reports whether the MQTT client is connected to the broker.
+	Connected func() bool
+	DB        interface {
+		PingContext(ctx context.Context) error
+	}
+	// Topics are the topics the processor has to be subscribed to in order to be ready.
+	Topics []string
+	Now    func() time.Time
+}
+
+// processorHealth collects the state of the MQTT connection, topic subscriptions and received messages,
+// and serves it on the admin listener.
+type processorHealth struct {
+	processorHealthOpts
+	mu          sync.Mutex
+	subscribed  map[string]bool
+	lastMessage time.Time
+}
+
+type processorStatus struct {
+	Status        string          `json:"status"`
+	MQTTConnected bool            `json:"mqttConnected"`
+	Subscriptions map[string]bool `json:"subscriptions"`
+	Database      string          `json:"database"`
+	// LastMessageAt and SecondsSinceLastMessage are nil when no message was received since the processor started.
+	LastMessageAt           *int64   `json:"lastMessageAt"`
+	SecondsSinceLastMessage *float64 `json:"secondsSinceLastMessage"`
+}
+
+func newProcessorHealth(o processorHealthOpts) *processorHealth {
+	return &processorHealth{
+		processorHealthOpts: o,
+		subscribed:          make(map[string]bool),
+	}
+}
+
+// Subscribed records the result of subscribing to a topic.
+func (h *processorHealth) Subscribed(topic string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribed[topic] = err == nil
+}
+
+// ConnectionLost forgets all subscriptions, they are renewed once the client reconnects.
+func (h *processorHealth) ConnectionLost() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribed = make(map[string]bool)
+}
+
+// Received records that a message was received.
+func (h *processorHealth) Received(at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if at.After(h.lastMessage) {
+		h.lastMessage = at
+	}
+}
+
+// status checks all dependencies, the processor is ready when it is connected, subscribed to all topics and the database is reachable.
+func (h *processorHealth) status(ctx context.Context) processorStatus {
+	s := processorStatus{
+		Status:        "ok",
+		MQTTConnected: h.Connected(),
+		Subscriptions: make(map[string]bool),
+		Database:      "ok",
+	}
+
+	h.mu.Lock()
+	for _, topic := range h.Topics {
+		s.Subscriptions[topic] = h.subscribed[topic]
+		if !h.subscribed[topic] {
+			s.Status = "unavailable"
+		}
+	}
+	if !h.lastMessage.IsZero() {
+		at := h.lastMessage.Unix()
+		ago := h.Now().Sub(h.lastMessage).Seconds()
+		s.LastMessageAt = &at
+		s.SecondsSinceLastMessage = &ago
+	}
+	h.mu.Unlock()
+
+	if !s.MQTTConnected {
+		s.Status = "unavailable"
+	}
+
+	if err := h.DB.PingContext(ctx); err != nil {
+		s.Database = err.Error()
+		s.Status = "unavailable"
+	}
+
+	return s
+}
+
+// handler serves /healthz, which reports that the processor is alive, and /readyz, which reports the status of its dependencies.
+func (h *processorHealth) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		s := h.status(ctx)
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if s.Status != "ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(s)
+	})
+
+	return mux
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/miselaytes-anton/airy/internal/testserver"
+)
+
+type pingerStub struct {
+	err error
+}
+
+func (p pingerStub) PingContext(ctx context.Context) error {
+	return p.err
+}
+
+func Test_processorHealth(t *testing.T) {
+	now := time.Unix(1702156335, 0)
+	lastMessageAt := now.Unix() - 30
+	secondsSinceLastMessage := 30.0
+
+	data := []struct {
+		name         string
+		connected    bool
+		pingErr      error
+		subscribe    func(h *processorHealth)
+		expectedCode int
+		expected     processorStatus
+	}{
+		{
+			"ready",
+			true,
+			nil,
+			func(h *processorHealth) {
+				h.Subscribed("measurement", nil)
+				h.Received(now.Add(-30 * time.Second))
+			},
+			http.StatusOK,
+			processorStatus{Status: "ok", MQTTConnected: true, Subscriptions: map[string]bool{"measurement": true}, Database: "ok", LastMessageAt: &lastMessageAt, SecondsSinceLastMessage: &secondsSinceLastMessage},
+		},
+		{
+			"reconnecting",
+			false,
+			nil,
+			func(h *processorHealth) {
+				h.Subscribed("measurement", nil)
+				h.ConnectionLost()
+			},
+			http.StatusServiceUnavailable,
+			processorStatus{Status: "unavailable", MQTTConnected: false, Subscriptions: map[string]bool{"measurement": false}, Database: "ok"},
+		},
+		{
+			"subscription failed",
+			true,
+			nil,
+			func(h *processorHealth) {
+				h.Subscribed("measurement", errors.New("not authorized"))
+			},
+			http.StatusServiceUnavailable,
+			processorStatus{Status: "unavailable", MQTTConnected: true, Subscriptions: map[string]bool{"measurement": false}, Database: "ok"},
+		},
+		{
+			"database unreachable",
+			true,
+			errors.New("connection refused"),
+			func(h *processorHealth) {
+				h.Subscribed("measurement", nil)
+			},
+			http.StatusServiceUnavailable,
+			processorStatus{Status: "unavailable", MQTTConnected: true, Subscriptions: map[string]bool{"measurement": true}, Database: "connection refused"},
+		},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				health := newProcessorHealth(processorHealthOpts{
+					Connected: func() bool { return d.connected },
+					DB:        pingerStub{err: d.pingErr},
+					Topics:    []string{"measurement"},
+					Now:       func() time.Time { return now },
+				})
+				d.subscribe(health)
+
+				ts := testserver.TestServer{Server: httptest.NewServer(health.handler())}
+				defer ts.Server.Close()
+
+				statusCode, _, body := ts.Get(t, "/readyz")
+
+				if diff := cmp.Diff(d.expectedCode, statusCode); diff != "" {
+					t.Error(diff)
+				}
+
+				var received processorStatus
+				if err := json.Unmarshal(body, &received); err != nil {
+					t.Fatal(err)
+				}
+
+				if diff := cmp.Diff(d.expected, received); diff != "" {
+					t.Error(diff)
+				}
+
+				// the processor is alive regardless of its dependencies
+				statusCode, _, _ = ts.Get(t, "/healthz")
+				if diff := cmp.Diff(http.StatusOK, statusCode); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
+	"time"
 
 	"database/sql"
 	// imports postgres timezones data
@@ -15,6 +21,8 @@ import (
 	"github.com/miselaytes-anton/airy/internal/config"
 	"github.com/miselaytes-anton/airy/internal/log"
 	"github.com/miselaytes-anton/airy/internal/models"
+	"github.com/miselaytes-anton/airy/internal/notify"
+	"github.com/miselaytes-anton/airy/internal/spool"
 )
 
 func enableMqttLogging() {
@@ -24,58 +32,230 @@ func enableMqttLogging() {
 	// mqtt.DEBUG = log.Debug
 }
 
-func connectToDb() (*sql.DB, error) {
-	db, err := sql.Open("postgres", config.GetPostgresAddress())
-	if err != nil {
-		return nil, err
-	}
+func main() {
+	const waithBeforeMqttDisconnectMs = 1000
 
-	err = db.Ping()
+	replay := flag.Bool("replay-dead-letters", false, "replay stored dead letters and exit")
+	backfill := flag.Bool("backfill-rollups", false, "build the rollups of all stored measurements and exit")
 
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:], os.LookupEnv)
 	if err != nil {
-		return nil, err
+		log.Error.Fatal(err)
 	}
 
-	return db, err
-}
+	// the processor does not serve the HTTP API
+	if err := cfg.Validate("Server", "Views"); err != nil {
+		log.Error.Fatal(err)
+	}
+
+	log.Info.Printf("effective configuration:\n%s", cfg.Redacted())
 
-func main() {
-	const (
-		mqttClientID                = "tatadata"
-		measurementTopic            = "measurement"
-		measurementQOS              = 1
-		waithBeforeMqttDisconnectMs = 1000
-	)
 	enableMqttLogging()
 
-	db, err := connectToDb()
+	db, err := sql.Open("postgres", cfg.Postgres.Address)
+	if err != nil {
+		log.Error.Fatal(err)
+	}
+
+	pingErr := db.Ping()
 
+	duplicatePolicy, err := models.ParseDuplicatePolicy(cfg.Processor.DuplicatePolicy)
 	if err != nil {
 		log.Error.Fatal(err)
 	}
 
-	measurements := models.MeasurementModel{DB: db}
+	measurements := models.MeasurementModel{DB: db, DuplicatePolicy: duplicatePolicy}
+	deadLetters := models.DeadLetterModel{DB: db}
+	sensors := models.SensorModel{DB: db}
+	alertRules := models.AlertRuleModel{DB: db}
+	alerts := models.AlertModel{DB: db}
+	rollups := models.RollupModel{DB: db}
 
 	handler := measurementHandler{
-		Measurements: measurements,
+		DeadLetters:  deadLetters,
+		MaxClockSkew: cfg.Processor.MaxClockSkew,
+		Now:          time.Now,
 		LogError:     log.Error,
 		LogInfo:      log.Info,
 	}
 
+	// dead letters are spooled in a directory of their own while the database is unreachable
+	spoolConfig := cfg.Spool
+	deadLetterSpool, err := spool.Open(filepath.Join(spoolConfig.Dir, "dead-letters"), spoolConfig.MaxBytes, spoolConfig.SegmentBytes)
+	if err != nil {
+		log.Error.Fatal(err)
+	}
+
+	if *replay {
+		if pingErr != nil {
+			log.Error.Fatal(pingErr)
+		}
+		spooled := spooledDeadLetters{spooledDeadLettersOpts: spooledDeadLettersOpts{
+			DeadLetters: deadLetters,
+			Spool:       deadLetterSpool,
+			LogError:    log.Error,
+			LogInfo:     log.Info,
+		}}
+		if _, err := spooled.drain(); err != nil {
+			log.Error.Fatal(err)
+		}
+		deadLetterSpool.Close()
+		replayer := deadLetterReplayer{
+			Handler:      handler,
+			Measurements: measurements,
+			DeadLetters:  deadLetters,
+			LogError:     log.Error,
+			LogInfo:      log.Info,
+		}
+		_, _, err := replayer.replay()
+		db.Close()
+		if err != nil {
+			log.Error.Fatal(err)
+		}
+		return
+	}
+
+	if *backfill {
+		if pingErr != nil {
+			log.Error.Fatal(pingErr)
+		}
+		_, err := backfillRollups(rollups, log.Info)
+		db.Close()
+		if err != nil {
+			log.Error.Fatal(err)
+		}
+		return
+	}
+
+	// measurements are spooled until the database is reachable
+	if pingErr != nil {
+		log.Warning.Printf("database is not reachable: %s", pingErr)
+	}
+
+	measurementSpool, err := spool.Open(spoolConfig.Dir, spoolConfig.MaxBytes, spoolConfig.SegmentBytes)
+	if err != nil {
+		log.Error.Fatal(err)
+	}
+
+	if size := measurementSpool.Size(); size > 0 {
+		log.Info.Printf("recovered %d bytes of spooled measurements from %s\n", size, spoolConfig.Dir)
+	}
+
+	if size := deadLetterSpool.Size(); size > 0 {
+		log.Info.Printf("recovered %d bytes of spooled dead letters from %s\n", size, spoolConfig.Dir)
+	}
+
+	spooledDeadLetters := newSpooledDeadLetters(spooledDeadLettersOpts{
+		DeadLetters:   deadLetters,
+		Spool:         deadLetterSpool,
+		DrainInterval: spoolConfig.DrainInterval,
+		LogError:      log.Error,
+		LogInfo:       log.Info,
+	})
+	handler.DeadLetters = spooledDeadLetters
+
+	writerConfig := cfg.Writer
+	metrics := newProcessorMetrics()
+
+	writer := newMeasurementWriter(measurementWriterOpts{
+		Measurements:   instrumentedMeasurements{MeasurementModelInterface: measurements, Metrics: metrics},
+		DeadLetters:    spooledDeadLetters,
+		Topic:          cfg.MQTT.MeasurementTopic,
+		Spool:          measurementSpool,
+		DrainInterval:  spoolConfig.DrainInterval,
+		DrainBudget:    spoolDrainBudget,
+		QueueSize:      writerConfig.QueueSize,
+		BatchSize:      writerConfig.BatchSize,
+		FlushInterval:  writerConfig.FlushInterval,
+		EnqueueTimeout: writerConfig.EnqueueTimeout,
+		LogError:       log.Error,
+		LogInfo:        log.Info,
+	})
+
+	handler.Measurements = writer
+
+	health := newProcessorHealth(processorHealthOpts{
+		DB:     db,
+		Topics: []string{cfg.MQTT.MeasurementTopic},
+		Now:    time.Now,
+	})
+	handler.Messages = health
+	handler.Metrics = metrics
+
 	options := mqttClientOpts{
-		BrokerAddress: config.GetBrokerAdress(),
-		ClientID:      mqttClientID,
+		BrokerAddress: cfg.MQTT.BrokerAddress,
+		ClientID:      cfg.MQTT.ClientID,
 		MessageHandlers: messageHandlers{
-			measurementTopic: {
-				Handler: handler.handle,
-				QOS:     measurementQOS,
+			cfg.MQTT.MeasurementTopic: {
+				// the handler is completed below, notifications are published with this client
+				Handler: func(client mqtt.Client, msg mqtt.Message) { handler.handle(client, msg) },
+				QOS:     byte(cfg.MQTT.QOS),
 			},
 		},
-		LogError: log.Error,
-		LogInfo:  log.Info,
+		Subscriptions: health,
+		Metrics:       metrics,
+		LogError:      log.Error,
+		LogInfo:       log.Info,
 	}
 
 	mqttClient := NewMqttClient(options)
+	health.Connected = mqttClient.IsConnectionOpen
+
+	channels, err := newNotificationChannels(cfg.Notify, mqttClient)
+	if err != nil {
+		log.Error.Fatal(err)
+	}
+
+	dispatcher := notify.NewDispatcher(notify.DispatcherOpts{
+		Channels:  channels,
+		QueueSize: notifyQueueSize,
+		Now:       time.Now,
+		LogError:  log.Error,
+		LogInfo:   log.Info,
+	})
+
+	registry := newSensorRegistry(sensorRegistryOpts{
+		Sensors:       sensors,
+		FlushInterval: cfg.Sensors.FlushInterval,
+		OfflineAfter:  cfg.Sensors.OfflineAfter,
+		Notifications: dispatcher,
+		Now:           time.Now,
+		LogError:      log.Error,
+		LogInfo:       log.Info,
+	})
+
+	handler.Sensors = registry
+	evaluator := newAlertEvaluator(alertEvaluatorOpts{
+		Rules:           alertRules,
+		Alerts:          alerts,
+		RefreshInterval: cfg.Processor.AlertRulesRefreshInterval,
+		QueueSize:       alertQueueSize,
+		Backoff:         alertBackoff,
+		MaxBackoff:      alertMaxBackoff,
+		Notifications:   dispatcher,
+		Bands:           cfg.Bands,
+		Now:             time.Now,
+		LogError:        log.Error,
+		LogInfo:         log.Info,
+	})
+	handler.Alerts = evaluator
+
+	refresher := newRollupRefresher(rollupRefresherOpts{
+		Rollups:  rollups,
+		Interval: cfg.Rollups.RefreshInterval,
+		LogError: log.Error,
+	})
+
+	// health checks and metrics are served while the client is still connecting
+	adminMux := http.NewServeMux()
+	adminMux.Handle("/", health.handler())
+	adminMux.Handle("/metrics", metrics.handler())
+	admin := &http.Server{Addr: cfg.Processor.AdminAddress, ErrorLog: log.Error, Handler: adminMux}
+	go func() {
+		if err := admin.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Error.Printf("admin listener stopped: %s", err)
+		}
+	}()
 
 	if token := mqttClient.Connect(); token.Wait() && token.Error() != nil {
 		log.Error.Fatal(token.Error())
@@ -87,7 +267,17 @@ func main() {
 
 	<-sig
 	log.Info.Println("signal caught - exiting")
-	db.Close()
+	// stop receiving messages first, then flush queued measurements before closing the database
 	mqttClient.Disconnect(waithBeforeMqttDisconnectMs)
+	evaluator.Close()
+	writer.Close()
+	spooledDeadLetters.Close()
+	refresher.Close()
+	registry.Close()
+	dispatcher.Close()
+	measurementSpool.Close()
+	deadLetterSpool.Close()
+	admin.Shutdown(context.Background())
+	db.Close()
 	log.Info.Println("shutdown complete")
 }
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/miselaytes-anton/airy/internal/models"
@@ -10,37 +14,266 @@ import (
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
+// measurementPayloadVersion is the latest supported version of the JSON measurement payload.
+const measurementPayloadVersion = 1
+
+// measurementSink accepts parsed measurements for persistence.
+type measurementSink interface {
+	Write(models.Measurement) error
+}
+
+// sensorTracker records which sensors sent messages.
+type sensorTracker interface {
+	Seen(sensorID string, firmwareVersion string, at time.Time)
+}
+
+// measurementEvaluator checks parsed measurements, e.g. against alert rules.
+type measurementEvaluator interface {
+	Evaluate(models.Measurement)
+}
+
+// messageTracker is told about every received message, e.g. to report the time since the last one.
+type messageTracker interface {
+	Received(at time.Time)
+}
+
 type measurementHandler struct {
-	Measurements models.MeasurementModelInterface
+	Measurements measurementSink
+	DeadLetters  models.DeadLetterModelInterface
+	Sensors      sensorTracker
+	Alerts       measurementEvaluator
+	Messages     messageTracker
+	Metrics      *processorMetrics
+	// MaxClockSkew is how far in the future a device supplied timestamp may be before the measurement is rejected.
+	MaxClockSkew time.Duration
+	Now          func() time.Time
 	LogError     *log.Logger
 	LogInfo      *log.Logger
 }
 
-// parseMeasurementMessage parses a measurement message which comes in the form of "bedroom 51.86 607.44 0.52 100853 27.25 60.22"
+// measurementPayload represents a versioned JSON measurement message, for example
+// {"v": 1, "sensorId": "bedroom", "firmware": "1.2.0", "timestamp": 1702156335, "iaq": 51.86, "co2": 607.44, "voc": 0.52, "pressure": 100853, "temperature": 27.25, "humidity": 60.22}.
+// The firmware version, the timestamp and the metrics are optional, metrics which are left out, e.g. by a device without a VOC sensor, are stored as NULL.
+// Unknown fields are ignored so that newer firmware can send additional data without breaking the processor.
+type measurementPayload struct {
+	Version     *int     `json:"v"`
+	SensorID    string   `json:"sensorId"`
+	Firmware    string   `json:"firmware,omitempty"`
+	Timestamp   int64    `json:"timestamp"`
+	IAQ         *float64 `json:"iaq,omitempty"`
+	CO2         *float64 `json:"co2,omitempty"`
+	VOC         *float64 `json:"voc,omitempty"`
+	Pressure    *float64 `json:"pressure,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	Humidity    *float64 `json:"humidity,omitempty"`
+}
+
+// isJSONMessage reports whether the message looks like a JSON object.
+func isJSONMessage(msg string) bool {
+	return strings.HasPrefix(strings.TrimSpace(msg), "{")
+}
+
+// parseMeasurementMessage parses a measurement message. Both the positional format
+// "bedroom 51.86 607.44 0.52 100853 27.25 60.22" and the JSON format (see measurementPayload) are supported,
+// the format is detected automatically.
 func parseMeasurementMessage(msg string) (models.Measurement, error) {
+	if isJSONMessage(msg) {
+		return parseJSONMeasurementMessage(msg)
+	}
+
+	return parsePositionalMeasurementMessage(msg)
+}
+
+// parseFirmwareVersion returns the firmware version reported in a JSON measurement message, the positional format does not carry one.
+func parseFirmwareVersion(msg string) string {
+	if !isJSONMessage(msg) {
+		return ""
+	}
+
+	var p measurementPayload
+	if err := json.Unmarshal([]byte(msg), &p); err != nil {
+		return ""
+	}
+
+	return p.Firmware
+}
+
+// parsePositionalMeasurementMessage parses a measurement message which comes in the form of "bedroom 51.86 607.44 0.52 100853 27.25 60.22".
+// An optional unix timestamp of the sample can follow the humidity, e.g. "bedroom 51.86 607.44 0.52 100853 27.25 60.22 1702156335".
+func parsePositionalMeasurementMessage(msg string) (models.Measurement, error) {
 	var m models.Measurement
 	if _, err := fmt.Sscanf(msg, "%s %g %g %g %g %g %g", &m.SensorID, &m.IAQ, &m.CO2, &m.VOC, &m.Pressure, &m.Temperature, &m.Humidity); err != nil {
 		return m, err
 	}
 
+	if fields := strings.Fields(msg); len(fields) > 7 {
+		timestamp, err := strconv.ParseInt(fields[7], 10, 64)
+		if err != nil {
+			return m, fmt.Errorf("invalid timestamp: %s, must be a unix timestamp", fields[7])
+		}
+		m.Timestamp = timestamp
+	}
+
 	return m, nil
 }
 
+// parseJSONMeasurementMessage parses a measurement message in the JSON format.
+func parseJSONMeasurementMessage(msg string) (models.Measurement, error) {
+	var p measurementPayload
+	if err := json.Unmarshal([]byte(msg), &p); err != nil {
+		return models.Measurement{}, fmt.Errorf("invalid json payload: %w", err)
+	}
+
+	version := measurementPayloadVersion
+	if p.Version != nil {
+		version = *p.Version
+	}
+
+	if version < 1 || version > measurementPayloadVersion {
+		return models.Measurement{}, fmt.Errorf("unsupported payload version: %d", version)
+	}
+
+	if p.SensorID == "" {
+		return models.Measurement{}, errors.New("missing field: sensorId")
+	}
+
+	if p.Timestamp < 0 {
+		return models.Measurement{}, fmt.Errorf("invalid timestamp: %d, must be a unix timestamp", p.Timestamp)
+	}
+
+	m := models.Measurement{SensorID: p.SensorID, Timestamp: p.Timestamp}
+
+	metrics := []struct {
+		name  string
+		value *float64
+		dst   *float64
+	}{
+		{"iaq", p.IAQ, &m.IAQ},
+		{"co2", p.CO2, &m.CO2},
+		{"voc", p.VOC, &m.VOC},
+		{"pressure", p.Pressure, &m.Pressure},
+		{"temperature", p.Temperature, &m.Temperature},
+		{"humidity", p.Humidity, &m.Humidity},
+	}
+
+	for _, metric := range metrics {
+		if metric.value == nil {
+			m.Missing = append(m.Missing, metric.name)
+			continue
+		}
+		*metric.dst = *metric.value
+	}
+
+	if len(m.Missing) == len(metrics) {
+		return models.Measurement{}, errors.New("missing field: at least one of iaq, co2, voc, pressure, temperature, humidity is required")
+	}
+
+	return m, nil
+}
+
+// applyTimestamp sets the receive time of the measurement and falls back to it when the device did not supply a sample time.
+// Measurements with a sample time too far in the future are rejected.
+func (h measurementHandler) applyTimestamp(m models.Measurement, receivedAt time.Time) (models.Measurement, error) {
+	m.ReceivedAt = receivedAt.Unix()
+
+	if m.Timestamp == 0 {
+		m.Timestamp = m.ReceivedAt
+		return m, nil
+	}
+
+	if skew := time.Unix(m.Timestamp, 0).Sub(receivedAt); skew > h.MaxClockSkew {
+		return m, fmt.Errorf("timestamp %d is %s in the future, max clock skew is %s", m.Timestamp, skew, h.MaxClockSkew)
+	}
+
+	return m, nil
+}
+
+// metricValue returns the value of the metric, nil when it is missing so that it is left out of the payload.
+func metricValue(m models.Measurement, name string) *float64 {
+	value, ok := m.Metric(name)
+	if !ok {
+		return nil
+	}
+	return &value
+}
+
+// encodeMeasurementMessage encodes a measurement in the JSON format accepted by parseMeasurementMessage.
+func encodeMeasurementMessage(m models.Measurement) string {
+	version := measurementPayloadVersion
+	p := measurementPayload{
+		Version:     &version,
+		SensorID:    m.SensorID,
+		Timestamp:   m.Timestamp,
+		IAQ:         metricValue(m, "iaq"),
+		CO2:         metricValue(m, "co2"),
+		VOC:         metricValue(m, "voc"),
+		Pressure:    metricValue(m, "pressure"),
+		Temperature: metricValue(m, "temperature"),
+		Humidity:    metricValue(m, "humidity"),
+	}
+
+	// encoding a struct of strings and numbers can not fail
+	b, _ := json.Marshal(p)
+
+	return string(b)
+}
+
+// process parses a message payload into a measurement ready to be persisted.
+func (h measurementHandler) process(payload string, receivedAt time.Time) (models.Measurement, error) {
+	m, err := parseMeasurementMessage(payload)
+	if err != nil {
+		return m, fmt.Errorf("message could not be parsed: %w", err)
+	}
+
+	// the sensor would be hidden by /api/sensors/status
+	if m.SensorID == models.ReservedSensorID {
+		return m, fmt.Errorf("measurement rejected: %w", models.ErrReservedSensorID)
+	}
+
+	m, err = h.applyTimestamp(m, receivedAt)
+	if err != nil {
+		return m, fmt.Errorf("measurement rejected: %w", err)
+	}
+
+	return m, nil
+}
+
+// deadLetter stores a message which could not be processed, so that it can be replayed later.
+func (h measurementHandler) deadLetter(topic string, payload string, reason error, receivedAt time.Time) {
+	_, err := h.DeadLetters.InsertDeadLetter(models.DeadLetter{
+		Topic:      topic,
+		Payload:    payload,
+		Reason:     reason.Error(),
+		ReceivedAt: receivedAt.Unix(),
+	})
+	if err != nil {
+		h.LogError.Printf("dead letter could not be stored (%s): %s", payload, err)
+	}
+}
+
 func (h measurementHandler) handle(_ mqtt.Client, msg mqtt.Message) {
+	receivedAt := h.Now()
 	payload := string(msg.Payload())
 	h.LogInfo.Printf("received message: %s\n", payload)
-	m, err := parseMeasurementMessage(payload)
+	h.Messages.Received(receivedAt)
+	h.Metrics.messagesReceived.WithLabelValues(msg.Topic()).Inc()
+
+	m, err := h.process(payload, receivedAt)
 	if err != nil {
-		h.LogError.Printf("message could not be parsed (%s): %s", payload, err)
+		h.LogError.Printf("%s (%s)", err, payload)
+		h.Metrics.messagesRejected.WithLabelValues(msg.Topic()).Inc()
+		h.deadLetter(msg.Topic(), payload, err, receivedAt)
 		return
 	}
 
-	m.Timestamp = time.Now().Unix()
+	h.Sensors.Seen(m.SensorID, parseFirmwareVersion(payload), receivedAt)
+	h.Alerts.Evaluate(m)
 
-	h.LogInfo.Printf("inserting measurement: %+v\n", m)
+	h.LogInfo.Printf("queueing measurement: %+v\n", m)
 
-	_, err = h.Measurements.InsertMeasurement(m)
+	err = h.Measurements.Write(m)
 	if err != nil {
-		h.LogError.Printf("measurement could not be inserted into database: %s", err)
+		h.LogError.Printf("measurement could not be queued (%s): %s", payload, err)
+		h.deadLetter(msg.Topic(), payload, fmt.Errorf("measurement could not be queued: %w", err), receivedAt)
 	}
 }
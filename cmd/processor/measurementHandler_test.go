@@ -1,30 +1,62 @@
 package main
 
 import (
-	"errors"
 	"io"
 	"log"
 	"testing"
+	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
 	"github.com/miselaytes-anton/airy/internal/models"
 	"github.com/miselaytes-anton/airy/internal/models/mocks"
 )
 
-func getMeasurementsOkMock(mq models.MeasurementsQuery, measurements *[]models.Measurement) ([]models.Measurement, error) {
-	return *measurements, nil
+type writeMock = func(models.Measurement, *[]models.Measurement) error
+
+type measurementSinkStub struct {
+	Measurements []models.Measurement
+	writeMock
+}
+
+func (s *measurementSinkStub) Write(m models.Measurement) error {
+	return s.writeMock(m, &s.Measurements)
 }
 
-func insertMeasurementOkMock(m models.Measurement, measurements *[]models.Measurement) (string, error) {
+func writeOkMock(m models.Measurement, measurements *[]models.Measurement) error {
 	*measurements = append(*measurements, m)
-	return "uuid", nil
+	return nil
+}
+
+func writeErrorMock(m models.Measurement, measurements *[]models.Measurement) error {
+	return errWriterQueueFull
+}
+
+type sensorTrackerStub struct {
+	Sightings []models.SensorSighting
+}
+
+func (s *sensorTrackerStub) Seen(sensorID string, firmwareVersion string, at time.Time) {
+	s.Sightings = append(s.Sightings, models.SensorSighting{SensorID: sensorID, FirmwareVersion: firmwareVersion, Timestamp: at.Unix()})
+}
+
+type measurementEvaluatorStub struct {
+	Measurements []models.Measurement
+}
+
+func (s *measurementEvaluatorStub) Evaluate(m models.Measurement) {
+	s.Measurements = append(s.Measurements, m)
 }
 
-func insertMeasurementErrorMock(m models.Measurement, measurements *[]models.Measurement) (string, error) {
-	return "", errors.New("database error")
+type messageTrackerStub struct {
+	Messages []time.Time
+}
+
+func (s *messageTrackerStub) Received(at time.Time) {
+	s.Messages = append(s.Messages, at)
 }
 
 type mqttClientStub struct {
@@ -40,6 +72,10 @@ func (m messageStub) Payload() []byte {
 	return m.payload()
 }
 
+func (m messageStub) Topic() string {
+	return "measurement"
+}
+
 func Test_parseMeasurementMessage(t *testing.T) {
 	data := []struct {
 		name     string
@@ -81,6 +117,115 @@ func Test_parseMeasurementMessage(t *testing.T) {
 			},
 			"strconv.ParseFloat: parsing \"\": invalid syntax",
 		},
+		{
+			"valid json message",
+			`{"v": 1, "sensorId": "bedroom", "iaq": 51.86, "co2": 607.44, "voc": 0.52, "pressure": 100853, "temperature": 27.25, "humidity": 60.22}`,
+			models.Measurement{
+				SensorID:    "bedroom",
+				IAQ:         51.86,
+				CO2:         607.44,
+				VOC:         0.52,
+				Pressure:    100853,
+				Temperature: 27.25,
+				Humidity:    60.22,
+			},
+			"",
+		},
+		{
+			"json message without version, unknown fields and leading whitespace",
+			` {"sensorId": "bedroom", "humidity": 60.22, "temperature": 27.25, "pressure": 100853, "voc": 0.52, "co2": 607.44, "iaq": 51.86, "rssi": -60}`,
+			models.Measurement{
+				SensorID:    "bedroom",
+				IAQ:         51.86,
+				CO2:         607.44,
+				VOC:         0.52,
+				Pressure:    100853,
+				Temperature: 27.25,
+				Humidity:    60.22,
+			},
+			"",
+		},
+		{
+			"valid message with timestamp",
+			"bedroom 51.86 607.44 0.52 100853 27.25 60.22 1702156335",
+			models.Measurement{
+				SensorID:    "bedroom",
+				Timestamp:   1702156335,
+				IAQ:         51.86,
+				CO2:         607.44,
+				VOC:         0.52,
+				Pressure:    100853,
+				Temperature: 27.25,
+				Humidity:    60.22,
+			},
+			"",
+		},
+		{
+			"message with invalid timestamp",
+			"bedroom 51.86 607.44 0.52 100853 27.25 60.22 yesterday",
+			models.Measurement{
+				SensorID:    "bedroom",
+				IAQ:         51.86,
+				CO2:         607.44,
+				VOC:         0.52,
+				Pressure:    100853,
+				Temperature: 27.25,
+				Humidity:    60.22,
+			},
+			"invalid timestamp: yesterday, must be a unix timestamp",
+		},
+		{
+			"valid json message with timestamp",
+			`{"v": 1, "sensorId": "bedroom", "timestamp": 1702156335, "iaq": 51.86, "co2": 607.44, "voc": 0.52, "pressure": 100853, "temperature": 27.25, "humidity": 60.22}`,
+			models.Measurement{
+				SensorID:    "bedroom",
+				Timestamp:   1702156335,
+				IAQ:         51.86,
+				CO2:         607.44,
+				VOC:         0.52,
+				Pressure:    100853,
+				Temperature: 27.25,
+				Humidity:    60.22,
+			},
+			"",
+		},
+		{
+			"json message with unsupported version",
+			`{"v": 2, "sensorId": "bedroom", "iaq": 51.86, "co2": 607.44, "voc": 0.52, "pressure": 100853, "temperature": 27.25, "humidity": 60.22}`,
+			models.Measurement{},
+			"unsupported payload version: 2",
+		},
+		{
+			"json message without sensorId",
+			`{"v": 1, "iaq": 51.86, "co2": 607.44, "voc": 0.52, "pressure": 100853, "temperature": 27.25, "humidity": 60.22}`,
+			models.Measurement{},
+			"missing field: sensorId",
+		},
+		{
+			"json message without some metrics",
+			`{"v": 1, "sensorId": "bedroom", "iaq": 51.86, "co2": 607.44, "pressure": 100853, "temperature": 27.25}`,
+			models.Measurement{
+				SensorID:    "bedroom",
+				IAQ:         51.86,
+				CO2:         607.44,
+				Pressure:    100853,
+				Temperature: 27.25,
+				Missing:     []string{"voc", "humidity"},
+			},
+			"",
+		},
+		{
+			"json message without metrics",
+			`{"v": 1, "sensorId": "bedroom", "firmware": "1.2.0"}`,
+			models.Measurement{},
+			"missing field: at least one of iaq, co2, voc, pressure, temperature, humidity is required",
+		},
+		{
+			"invalid json message",
+			`{"v": 1, "sensorId": "bedroom"`,
+			models.Measurement{},
+			"invalid json payload: unexpected end of JSON input",
+		},
 	}
 
 	for _, d := range data {
@@ -107,11 +252,15 @@ func Test_parseMeasurementMessage(t *testing.T) {
 }
 
 func Test_handle(t *testing.T) {
+	now := time.Unix(1702156335, 0)
+
 	data := []struct {
-		name                  string
-		message               string
-		expected              []models.Measurement
-		insertMeasurementMock mocks.InsertMeasurementMock
+		name      string
+		message   string
+		expected  []models.Measurement
+		writeMock writeMock
+		// expectedSightings is the number of times the sensor is tracked and the measurement evaluated
+		expectedSightings int
 	}{
 		{
 			"valid message",
@@ -124,26 +273,97 @@ func Test_handle(t *testing.T) {
 				Pressure:    100853,
 				Temperature: 27.25,
 				Humidity:    60.22,
+				Timestamp:   now.Unix(),
+				ReceivedAt:  now.Unix(),
+			}},
+			writeOkMock,
+			1,
+		},
+		{
+			"valid json message",
+			`{"v": 1, "sensorId": "bedroom", "iaq": 51.86, "co2": 607.44, "voc": 0.52, "pressure": 100853, "temperature": 27.25, "humidity": 60.22}`,
+			[]models.Measurement{{
+				SensorID:    "bedroom",
+				IAQ:         51.86,
+				CO2:         607.44,
+				VOC:         0.52,
+				Pressure:    100853,
+				Temperature: 27.25,
+				Humidity:    60.22,
+				Timestamp:   now.Unix(),
+				ReceivedAt:  now.Unix(),
+			}},
+			writeOkMock,
+			1,
+		},
+		{
+			"valid message with device timestamp",
+			"bedroom 51.86 607.44 0.52 100853 27.25 60.22 1702156000",
+			[]models.Measurement{{
+				SensorID:    "bedroom",
+				IAQ:         51.86,
+				CO2:         607.44,
+				VOC:         0.52,
+				Pressure:    100853,
+				Temperature: 27.25,
+				Humidity:    60.22,
+				Timestamp:   1702156000,
+				ReceivedAt:  now.Unix(),
 			}},
-			insertMeasurementOkMock,
+			writeOkMock,
+			1,
+		},
+		{
+			"valid message with device timestamp within clock skew",
+			"bedroom 51.86 607.44 0.52 100853 27.25 60.22 1702156365",
+			[]models.Measurement{{
+				SensorID:    "bedroom",
+				IAQ:         51.86,
+				CO2:         607.44,
+				VOC:         0.52,
+				Pressure:    100853,
+				Temperature: 27.25,
+				Humidity:    60.22,
+				Timestamp:   1702156365,
+				ReceivedAt:  now.Unix(),
+			}},
+			writeOkMock,
+			1,
+		},
+		{
+			"device timestamp too far in the future",
+			"bedroom 51.86 607.44 0.52 100853 27.25 60.22 1702156396",
+			make([]models.Measurement, 0),
+			writeOkMock,
+			0,
 		},
 		{
 			"empty message",
 			"",
 			make([]models.Measurement, 0),
-			insertMeasurementOkMock,
+			writeOkMock,
+			0,
 		},
 		{
 			"invalid message",
 			"bedroom something",
 			make([]models.Measurement, 0),
-			insertMeasurementOkMock,
+			writeOkMock,
+			0,
+		},
+		{
+			"reserved sensor id",
+			"status 51.86 607.44 0.52 100853 27.25 60.22",
+			make([]models.Measurement, 0),
+			writeOkMock,
+			0,
 		},
 		{
-			"valid message, database error",
+			"valid message, queue full",
 			"bedroom 51.86 607.44 0.52 100853 27.25 60.22",
 			make([]models.Measurement, 0),
-			insertMeasurementErrorMock,
+			writeErrorMock,
+			1,
 		},
 	}
 
@@ -151,13 +371,27 @@ func Test_handle(t *testing.T) {
 		t.Run(
 			d.name,
 			func(t *testing.T) {
-				measurementsMock := mocks.MeasurementModelMock{
-					Measurements:          make([]models.Measurement, 0),
-					InsertMeasurementMock: d.insertMeasurementMock,
-					GetMeasurementsMock:   getMeasurementsOkMock,
+				measurementsMock := measurementSinkStub{
+					Measurements: make([]models.Measurement, 0),
+					writeMock:    d.writeMock,
+				}
+				deadLettersMock := mocks.DeadLetterModelMock{
+					DeadLetters:          make([]models.DeadLetter, 0),
+					InsertDeadLetterMock: mocks.InsertDeadLetterOkMock,
 				}
+				sensorsStub := sensorTrackerStub{}
+				alertsStub := measurementEvaluatorStub{}
+				messagesStub := messageTrackerStub{}
+				metrics := newProcessorMetrics()
 				handler := measurementHandler{
 					Measurements: &measurementsMock,
+					DeadLetters:  &deadLettersMock,
+					Sensors:      &sensorsStub,
+					Alerts:       &alertsStub,
+					Messages:     &messagesStub,
+					Metrics:      metrics,
+					MaxClockSkew: time.Minute,
+					Now:          func() time.Time { return now },
 					LogError:     log.New(io.Discard, "", 0),
 					LogInfo:      log.New(io.Discard, "", 0),
 				}
@@ -167,11 +401,101 @@ func Test_handle(t *testing.T) {
 
 				handler.handle(mqttClientStub{}, messageStub)
 
-				if diff := cmp.Diff(d.expected, measurementsMock.Measurements, cmpopts.IgnoreFields(models.Measurement{}, "Timestamp")); diff != "" {
+				// every message counts as activity, even if it could not be parsed
+				if diff := cmp.Diff([]time.Time{now}, messagesStub.Messages); diff != "" {
+					t.Error(diff)
+				}
+
+				if diff := cmp.Diff(1.0, testutil.ToFloat64(metrics.messagesReceived.WithLabelValues("measurement"))); diff != "" {
+					t.Error(diff)
+				}
+
+				rejected := 0.0
+				if d.expectedSightings == 0 {
+					rejected = 1
+				}
+				if diff := cmp.Diff(rejected, testutil.ToFloat64(metrics.messagesRejected.WithLabelValues("measurement"))); diff != "" {
+					t.Error(diff)
+				}
+
+				if diff := cmp.Diff(d.expected, measurementsMock.Measurements); diff != "" {
+					t.Error(diff)
+				}
+
+				// sensors of parsed messages are tracked, even if the measurement could not be queued
+				if diff := cmp.Diff(d.expectedSightings, len(sensorsStub.Sightings)); diff != "" {
+					t.Error(diff)
+				}
+
+				if diff := cmp.Diff(d.expectedSightings, len(alertsStub.Measurements)); diff != "" {
+					t.Error(diff)
+				}
+
+				// every message is either queued or stored as a dead letter
+				if len(measurementsMock.Measurements) > 0 {
+					if diff := cmp.Diff(0, len(deadLettersMock.DeadLetters)); diff != "" {
+						t.Error(diff)
+					}
+					return
+				}
+
+				if diff := cmp.Diff(1, len(deadLettersMock.DeadLetters)); diff != "" {
+					t.Fatal(diff)
+				}
+
+				deadLetter := deadLettersMock.DeadLetters[0]
+				if diff := cmp.Diff(models.DeadLetter{ID: "uuid", Topic: "measurement", Payload: d.message, ReceivedAt: now.Unix()}, deadLetter, cmpopts.IgnoreFields(models.DeadLetter{}, "Reason")); diff != "" {
 					t.Error(diff)
 				}
+			},
+		)
+	}
+}
+
+func Test_parseFirmwareVersion(t *testing.T) {
+	data := []struct {
+		name     string
+		message  string
+		expected string
+	}{
+		{
+			"json message with firmware",
+			`{"v": 1, "sensorId": "bedroom", "firmware": "1.2.0", "iaq": 51.86, "co2": 607.44, "voc": 0.52, "pressure": 100853, "temperature": 27.25, "humidity": 60.22}`,
+			"1.2.0",
+		},
+		{
+			"json message without firmware",
+			`{"v": 1, "sensorId": "bedroom", "iaq": 51.86, "co2": 607.44, "voc": 0.52, "pressure": 100853, "temperature": 27.25, "humidity": 60.22}`,
+			"",
+		},
+		{
+			"positional message",
+			"bedroom 51.86 607.44 0.52 100853 27.25 60.22",
+			"",
+		},
+	}
 
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				if diff := cmp.Diff(d.expected, parseFirmwareVersion(d.message)); diff != "" {
+					t.Error(diff)
+				}
 			},
 		)
 	}
 }
+
+func Test_encodeMeasurementMessage(t *testing.T) {
+	measurement := models.Measurement{SensorID: "bedroom", Timestamp: 1702156335, CO2: 607.44, Humidity: 0, Missing: []string{"iaq", "voc", "pressure", "temperature"}}
+
+	m, err := parseMeasurementMessage(encodeMeasurementMessage(measurement))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(measurement, m); diff != "" {
+		t.Error(diff)
+	}
+}
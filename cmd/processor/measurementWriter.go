@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+)
+
+// spoolDrainBudget is how long spooled measurements are inserted at a time, queued measurements wait meanwhile.
+const spoolDrainBudget = 2 * time.Second
+
+var errWriterQueueFull = errors.New("measurement queue is full")
+var errWriterClosed = errors.New("measurement writer is closed")
+
+// recordSpool durably stores encoded records, e.g. measurements, while the database is unreachable.
+type recordSpool interface {
+	Append(records [][]byte) error
+	Drain(fn func(records [][]byte) error) (bool, error)
+	Size() int64
+}
+
+type measurementWriterOpts struct {
+	Measurements models.MeasurementModelInterface
+	// DeadLetters stores measurements which could not be inserted.
+	DeadLetters models.DeadLetterModelInterface
+	// Topic is the MQTT topic recorded with dead letters.
+	Topic string
+	// Spool stores measurements while the database is unreachable.
+	Spool recordSpool
+	// DrainInterval is how often spooled measurements are retried.
+	DrainInterval time.Duration
+	// DrainBudget is how long a drain may insert spooled measurements, the rest is drained on the next tick.
+	DrainBudget time.Duration
+	// QueueSize is the maximum number of measurements waiting to be written.
+	QueueSize int
+	// BatchSize is the number of queued measurements which triggers a flush.
+	BatchSize int
+	// FlushInterval is the maximum time a measurement waits in the queue before it is flushed.
+	FlushInterval time.Duration
+	// EnqueueTimeout is how long Write blocks on a full queue before giving up.
+	EnqueueTimeout time.Duration
+	LogError       *log.Logger
+	LogInfo        *log.Logger
+}
+
+// measurementWriter buffers measurements in a bounded queue and inserts them into the database in batches.
+// When the queue is full Write blocks for up to EnqueueTimeout and then rejects the measurement with errWriterQueueFull,
+// so a slow database slows down message handling instead of growing memory without bounds.
+// While the database is unreachable batches are appended to the spool, which is drained in order once the database is back.
+type measurementWriter struct {
+	measurementWriterOpts
+	queue  chan models.Measurement
+	done   chan struct{}
+	mu     sync.RWMutex
+	closed bool
+}
+
+// newMeasurementWriter creates a measurement writer and starts flushing in the background.
+func newMeasurementWriter(o measurementWriterOpts) *measurementWriter {
+	w := &measurementWriter{
+		measurementWriterOpts: o,
+		queue:                 make(chan models.Measurement, o.QueueSize),
+		done:                  make(chan struct{}),
+	}
+
+	go w.run()
+
+	return w
+}
+
+// Write adds a measurement to the queue.
+func (w *measurementWriter) Write(m models.Measurement) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		return errWriterClosed
+	}
+
+	select {
+	case w.queue <- m:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(w.EnqueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case w.queue <- m:
+		return nil
+	case <-timer.C:
+		return errWriterQueueFull
+	}
+}
+
+// Close stops accepting measurements and blocks until all queued measurements are flushed.
+func (w *measurementWriter) Close() {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	<-w.done
+}
+
+func (w *measurementWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.FlushInterval)
+	defer ticker.Stop()
+
+	drainTicker := time.NewTicker(w.DrainInterval)
+	defer drainTicker.Stop()
+
+	batch := make([]models.Measurement, 0, w.BatchSize)
+
+	for {
+		select {
+		case m, ok := <-w.queue:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+			batch = append(batch, m)
+			if len(batch) >= w.BatchSize {
+				batch = w.flush(batch)
+			}
+		case <-ticker.C:
+			batch = w.flush(batch)
+		case <-drainTicker.C:
+			w.drain()
+		}
+	}
+}
+
+// flush inserts the batch and returns an empty batch reusing the underlying array.
+func (w *measurementWriter) flush(batch []models.Measurement) []models.Measurement {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	// keep measurements in order, newer measurements wait until the spool is drained
+	if w.Spool.Size() > 0 {
+		w.spool(batch)
+		return batch[:0]
+	}
+
+	start := time.Now()
+	result, err := w.Measurements.InsertMeasurements(batch)
+	switch {
+	case err == nil:
+		w.LogInfo.Printf("inserted %d measurements (%d duplicates) in %s\n", result.Inserted, result.Duplicates, time.Since(start))
+	case models.IsUnavailableError(err):
+		w.LogError.Printf("database is unavailable, spooling %d measurements: %s", len(batch), err)
+		w.spool(batch)
+	default:
+		w.LogError.Printf("%d measurements could not be inserted into database: %s", len(batch), err)
+		w.deadLetter(batch, err)
+	}
+
+	return batch[:0]
+}
+
+// spool appends the batch to the spool.
+func (w *measurementWriter) spool(batch []models.Measurement) {
+	records := make([][]byte, 0, len(batch))
+	for _, m := range batch {
+		record, err := json.Marshal(m)
+		if err != nil {
+			w.LogError.Printf("measurement could not be encoded (%+v): %s", m, err)
+			continue
+		}
+		records = append(records, record)
+	}
+
+	if err := w.Spool.Append(records); err != nil {
+		w.LogError.Printf("%d measurements could not be spooled and are lost: %s", len(records), err)
+	}
+}
+
+// drain inserts spooled measurements from the oldest on until the spool is empty or the budget is used up,
+// so that the spool empties even while new batches are appended to it. It is a no-op while the database is unavailable.
+func (w *measurementWriter) drain() {
+	if w.Spool.Size() == 0 {
+		return
+	}
+
+	deadline := time.Now().Add(w.DrainBudget)
+	for w.Spool.Size() > 0 && time.Now().Before(deadline) {
+		drained, err := w.Spool.Drain(w.insertSpooled)
+		if err != nil && !models.IsUnavailableError(err) {
+			w.LogError.Printf("spool could not be drained: %s", err)
+		}
+		if err != nil || !drained {
+			return
+		}
+	}
+
+	if w.Spool.Size() == 0 {
+		w.LogInfo.Println("spool is drained")
+	}
+}
+
+// insertSpooled inserts the records of a spool segment, measurements which can not be inserted are stored as dead letters.
+// It fails while the database is unavailable, so that the segment is kept.
+func (w *measurementWriter) insertSpooled(records [][]byte) error {
+	batch := make([]models.Measurement, 0, len(records))
+	for _, record := range records {
+		var m models.Measurement
+		if err := json.Unmarshal(record, &m); err != nil {
+			w.LogError.Printf("spooled measurement could not be decoded (%s): %s", record, err)
+			continue
+		}
+		batch = append(batch, m)
+	}
+
+	result, err := w.Measurements.InsertMeasurements(batch)
+	if err != nil && !models.IsUnavailableError(err) {
+		w.LogError.Printf("%d spooled measurements could not be inserted into database: %s", len(batch), err)
+		w.deadLetter(batch, err)
+		return nil
+	}
+
+	if err == nil {
+		w.LogInfo.Printf("inserted %d spooled measurements (%d duplicates)\n", result.Inserted, result.Duplicates)
+	}
+
+	return err
+}
+
+// deadLetter stores measurements of a failed batch as dead letters, so that they can be replayed later.
+func (w *measurementWriter) deadLetter(batch []models.Measurement, reason error) {
+	for _, m := range batch {
+		payload := encodeMeasurementMessage(m)
+		_, err := w.DeadLetters.InsertDeadLetter(models.DeadLetter{
+			Topic:      w.Topic,
+			Payload:    payload,
+			Reason:     fmt.Sprintf("measurement could not be inserted: %s", reason),
+			ReceivedAt: m.ReceivedAt,
+		})
+		if err != nil {
+			w.LogError.Printf("dead letter could not be stored (%s): %s", payload, err)
+		}
+	}
+}
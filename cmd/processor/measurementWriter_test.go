@@ -0,0 +1,387 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+	"github.com/miselaytes-anton/airy/internal/models/mocks"
+	"github.com/miselaytes-anton/airy/internal/spool"
+)
+
+func insertMeasurementsOkMock(batch []models.Measurement, measurements *[]models.Measurement) (models.InsertResult, error) {
+	*measurements = append(*measurements, batch...)
+	return models.InsertResult{Inserted: len(batch)}, nil
+}
+
+func insertMeasurementsDuplicateMock(batch []models.Measurement, measurements *[]models.Measurement) (models.InsertResult, error) {
+	return models.InsertResult{Duplicates: len(batch)}, nil
+}
+
+func insertMeasurementsErrorMock(batch []models.Measurement, measurements *[]models.Measurement) (models.InsertResult, error) {
+	return models.InsertResult{}, errors.New("database error")
+}
+
+func newTestMeasurementWriter(t *testing.T, measurements models.MeasurementModelInterface, deadLetters models.DeadLetterModelInterface, queueSize int, batchSize int, flushInterval time.Duration) *measurementWriter {
+	s, err := spool.Open(t.TempDir(), 1024*1024, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return newMeasurementWriter(measurementWriterOpts{
+		Measurements:   measurements,
+		DeadLetters:    deadLetters,
+		Topic:          "measurement",
+		Spool:          s,
+		DrainInterval:  10 * time.Millisecond,
+		DrainBudget:    time.Second,
+		QueueSize:      queueSize,
+		BatchSize:      batchSize,
+		FlushInterval:  flushInterval,
+		EnqueueTimeout: 10 * time.Millisecond,
+		LogError:       log.New(io.Discard, "", 0),
+		LogInfo:        log.New(io.Discard, "", 0),
+	})
+}
+
+func Test_measurementWriter(t *testing.T) {
+	measurements := []models.Measurement{
+		{SensorID: "bedroom", Timestamp: 1},
+		{SensorID: "bedroom", Timestamp: 2},
+		{SensorID: "livingroom", Timestamp: 1},
+	}
+
+	data := []struct {
+		name                   string
+		batchSize              int
+		flushInterval          time.Duration
+		insertMeasurementsMock mocks.InsertMeasurementsMock
+		expected               []models.Measurement
+		expectedDeadLetters    int
+	}{
+		{
+			"flush by batch size",
+			1,
+			time.Hour,
+			insertMeasurementsOkMock,
+			measurements,
+			0,
+		},
+		{
+			"flush on close",
+			100,
+			time.Hour,
+			insertMeasurementsOkMock,
+			measurements,
+			0,
+		},
+		{
+			"database error",
+			1,
+			time.Hour,
+			insertMeasurementsErrorMock,
+			make([]models.Measurement, 0),
+			len(measurements),
+		},
+		{
+			"duplicates",
+			100,
+			time.Hour,
+			insertMeasurementsDuplicateMock,
+			make([]models.Measurement, 0),
+			0,
+		},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				measurementsMock := mocks.MeasurementModelMock{
+					Measurements:           make([]models.Measurement, 0),
+					InsertMeasurementsMock: d.insertMeasurementsMock,
+				}
+				deadLettersMock := mocks.DeadLetterModelMock{
+					DeadLetters:          make([]models.DeadLetter, 0),
+					InsertDeadLetterMock: mocks.InsertDeadLetterOkMock,
+				}
+				writer := newTestMeasurementWriter(t, &measurementsMock, &deadLettersMock, 10, d.batchSize, d.flushInterval)
+
+				for _, m := range measurements {
+					if err := writer.Write(m); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				writer.Close()
+
+				if diff := cmp.Diff(d.expected, measurementsMock.Measurements); diff != "" {
+					t.Error(diff)
+				}
+
+				if diff := cmp.Diff(d.expectedDeadLetters, len(deadLettersMock.DeadLetters)); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
+
+func Test_measurementWriter_flushInterval(t *testing.T) {
+	inserted := make(chan []models.Measurement, 1)
+	measurementsMock := mocks.MeasurementModelMock{
+		InsertMeasurementsMock: func(batch []models.Measurement, _ *[]models.Measurement) (models.InsertResult, error) {
+			inserted <- append([]models.Measurement(nil), batch...)
+			return models.InsertResult{Inserted: len(batch)}, nil
+		},
+	}
+	writer := newTestMeasurementWriter(t, &measurementsMock, nil, 10, 100, 10*time.Millisecond)
+	defer writer.Close()
+
+	m := models.Measurement{SensorID: "bedroom", Timestamp: 1}
+	if err := writer.Write(m); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case batch := <-inserted:
+		if diff := cmp.Diff([]models.Measurement{m}, batch); diff != "" {
+			t.Error(diff)
+		}
+	case <-time.After(time.Second):
+		t.Error("measurement was not flushed within the flush interval")
+	}
+}
+
+func Test_measurementWriter_backpressure(t *testing.T) {
+	release := make(chan struct{})
+	measurementsMock := mocks.MeasurementModelMock{
+		InsertMeasurementsMock: func(batch []models.Measurement, _ *[]models.Measurement) (models.InsertResult, error) {
+			<-release
+			return models.InsertResult{Inserted: len(batch)}, nil
+		},
+	}
+	writer := newTestMeasurementWriter(t, &measurementsMock, nil, 1, 1, time.Hour)
+
+	// the first measurement is taken by the blocked flush, the second one fills the queue
+	var err error
+	for i := 0; i < 3 && err == nil; i++ {
+		err = writer.Write(models.Measurement{SensorID: "bedroom", Timestamp: int64(i)})
+	}
+
+	if !errors.Is(err, errWriterQueueFull) {
+		t.Errorf("expected %v, got %v", errWriterQueueFull, err)
+	}
+
+	close(release)
+	writer.Close()
+
+	if err := writer.Write(models.Measurement{}); !errors.Is(err, errWriterClosed) {
+		t.Errorf("expected %v, got %v", errWriterClosed, err)
+	}
+}
+
+func Test_measurementWriter_spool(t *testing.T) {
+	var mu sync.Mutex
+	available := false
+	inserted := make([]models.Measurement, 0)
+
+	measurementsMock := mocks.MeasurementModelMock{
+		InsertMeasurementsMock: func(batch []models.Measurement, _ *[]models.Measurement) (models.InsertResult, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if !available {
+				return models.InsertResult{}, &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}
+			}
+			inserted = append(inserted, batch...)
+			return models.InsertResult{Inserted: len(batch)}, nil
+		},
+	}
+	writer := newTestMeasurementWriter(t, &measurementsMock, nil, 10, 1, time.Hour)
+	defer writer.Close()
+
+	write := func(timestamp int64) {
+		if err := writer.Write(models.Measurement{SensorID: "bedroom", Timestamp: timestamp}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// database is down, measurements go to the spool
+	write(1)
+	write(2)
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	available = true
+	mu.Unlock()
+
+	// newer measurements are inserted after the spooled ones
+	write(3)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		n := len(inserted)
+		mu.Unlock()
+		if n == 3 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	timestamps := make([]int64, 0)
+	for _, m := range inserted {
+		timestamps = append(timestamps, m.Timestamp)
+	}
+
+	if diff := cmp.Diff([]int64{1, 2, 3}, timestamps); diff != "" {
+		t.Error(diff)
+	}
+}
+
+// memorySpool is a spool in memory which starts a segment with every append, like a spool being drained does.
+type memorySpool struct {
+	mu       sync.Mutex
+	segments [][][]byte
+	size     int64
+}
+
+func (s *memorySpool) Append(records [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.segments = append(s.segments, records)
+	for _, record := range records {
+		s.size += int64(len(record))
+	}
+	return nil
+}
+
+func (s *memorySpool) Drain(fn func(records [][]byte) error) (bool, error) {
+	s.mu.Lock()
+	if len(s.segments) == 0 {
+		s.mu.Unlock()
+		return false, nil
+	}
+	oldest := s.segments[0]
+	s.mu.Unlock()
+
+	if err := fn(oldest); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.segments = s.segments[1:]
+	for _, record := range oldest {
+		s.size -= int64(len(record))
+	}
+	return true, nil
+}
+
+func (s *memorySpool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+func Test_measurementWriter_spoolDrainsUnderLoad(t *testing.T) {
+	var mu sync.Mutex
+	available := false
+	inserted := make([]models.Measurement, 0)
+
+	measurementsMock := mocks.MeasurementModelMock{
+		InsertMeasurementsMock: func(batch []models.Measurement, _ *[]models.Measurement) (models.InsertResult, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if !available {
+				return models.InsertResult{}, &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}
+			}
+			inserted = append(inserted, batch...)
+			return models.InsertResult{Inserted: len(batch)}, nil
+		},
+	}
+	writer := newMeasurementWriter(measurementWriterOpts{
+		Measurements:   &measurementsMock,
+		Topic:          "measurement",
+		Spool:          &memorySpool{},
+		DrainInterval:  10 * time.Millisecond,
+		DrainBudget:    time.Second,
+		QueueSize:      100,
+		BatchSize:      1,
+		FlushInterval:  time.Hour,
+		EnqueueTimeout: 10 * time.Millisecond,
+		LogError:       log.New(io.Discard, "", 0),
+		LogInfo:        log.New(io.Discard, "", 0),
+	})
+
+	// measurements keep arriving faster than one spool segment per drain interval
+	stop := make(chan struct{})
+	written := make(chan int64)
+	go func() {
+		var timestamp int64
+		for {
+			select {
+			case <-stop:
+				written <- timestamp
+				return
+			default:
+			}
+			if err := writer.Write(models.Measurement{SensorID: "bedroom", Timestamp: timestamp + 1}); err == nil {
+				timestamp++
+			}
+			time.Sleep(100 * time.Microsecond)
+		}
+	}()
+
+	// database is down, the spool grows
+	time.Sleep(50 * time.Millisecond)
+	if writer.Spool.Size() == 0 {
+		t.Fatal("expected measurements to be spooled")
+	}
+
+	mu.Lock()
+	available = true
+	mu.Unlock()
+
+	deadline := time.Now().Add(time.Second)
+	for writer.Spool.Size() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the spool to be drained, %d bytes left", writer.Spool.Size())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// once the spool is drained, measurements are inserted directly
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	last := <-written
+	writer.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if diff := cmp.Diff(int64(0), writer.Spool.Size()); diff != "" {
+		t.Error(diff)
+	}
+	for i, m := range inserted {
+		if m.Timestamp != int64(i+1) {
+			t.Fatalf("expected measurements in order, got %d at %d", m.Timestamp, i)
+		}
+	}
+	if diff := cmp.Diff(last, int64(len(inserted))); diff != "" {
+		t.Error(diff)
+	}
+}
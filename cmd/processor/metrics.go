@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+)
+
+// processorMetrics are the Prometheus metrics of the processor.
+type processorMetrics struct {
+	registry         *prometheus.Registry
+	messagesReceived *prometheus.CounterVec
+	messagesRejected *prometheus.CounterVec
+	insertDuration   *prometheus.HistogramVec
+	duplicates       prometheus.Counter
+	connectionsLost  prometheus.Counter
+	reconnects       prometheus.Counter
+}
+
+func newProcessorMetrics() *processorMetrics {
+	m := &processorMetrics{
+		registry: prometheus.NewRegistry(),
+		messagesReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "airy_processor_messages_received_total",
+			Help: "Number of MQTT messages received.",
+		}, []string{"topic"}),
+		messagesRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "airy_processor_messages_rejected_total",
+			Help: "Number of MQTT messages which could not be parsed or validated and were stored as dead letters.",
+		}, []string{"topic"}),
+		insertDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "airy_processor_insert_duration_seconds",
+			Help:    "Duration of measurement batch inserts.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"status"}),
+		duplicates: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "airy_processor_measurements_duplicates_total",
+			Help: "Number of inserted measurements whose sensor and timestamp were already stored, handled by the duplicate policy.",
+		}),
+		connectionsLost: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "airy_processor_mqtt_connections_lost_total",
+			Help: "Number of times the connection to the MQTT broker was lost.",
+		}),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "airy_processor_mqtt_reconnect_attempts_total",
+			Help: "Number of attempts to reconnect to the MQTT broker.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		m.messagesReceived,
+		m.messagesRejected,
+		m.insertDuration,
+		m.duplicates,
+		m.connectionsLost,
+		m.reconnects,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// handler serves the metrics in the Prometheus text format.
+func (m *processorMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// instrumentedMeasurements records the duration of measurement inserts and the duplicates among the inserted measurements.
+type instrumentedMeasurements struct {
+	models.MeasurementModelInterface
+	Metrics *processorMetrics
+}
+
+func (i instrumentedMeasurements) InsertMeasurements(measurements []models.Measurement) (models.InsertResult, error) {
+	start := time.Now()
+	result, err := i.MeasurementModelInterface.InsertMeasurements(measurements)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	i.Metrics.insertDuration.WithLabelValues(status).Observe(time.Since(start).Seconds())
+	i.Metrics.duplicates.Add(float64(result.Duplicates))
+
+	return result, err
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+	"github.com/miselaytes-anton/airy/internal/models/mocks"
+)
+
+func Test_instrumentedMeasurements(t *testing.T) {
+	metrics := newProcessorMetrics()
+	measurementsMock := mocks.MeasurementModelMock{
+		Measurements:           make([]models.Measurement, 0),
+		InsertMeasurementsMock: insertMeasurementsOkMock,
+	}
+	measurements := instrumentedMeasurements{MeasurementModelInterface: &measurementsMock, Metrics: metrics}
+
+	result, err := measurements.InsertMeasurements([]models.Measurement{{SensorID: "bedroom", Timestamp: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(models.InsertResult{Inserted: 1}, result); diff != "" {
+		t.Error(diff)
+	}
+
+	measurementsMock.InsertMeasurementsMock = insertMeasurementsDuplicateMock
+	if _, err := measurements.InsertMeasurements([]models.Measurement{{SensorID: "bedroom", Timestamp: 1}, {SensorID: "bedroom", Timestamp: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	measurementsMock.InsertMeasurementsMock = insertMeasurementsErrorMock
+	if _, err := measurements.InsertMeasurements([]models.Measurement{{SensorID: "bedroom", Timestamp: 2}}); err == nil {
+		t.Error("expected an error")
+	}
+
+	// one histogram for each status
+	if diff := cmp.Diff(2, testutil.CollectAndCount(metrics.insertDuration, "airy_processor_insert_duration_seconds")); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff(2.0, testutil.ToFloat64(metrics.duplicates)); diff != "" {
+		t.Error(diff)
+	}
+}
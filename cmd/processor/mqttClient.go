@@ -12,10 +12,18 @@ type messageHandlers map[string]struct {
 	QOS     byte
 }
 
+// subscriptionTracker is told about subscriptions and lost connections.
+type subscriptionTracker interface {
+	Subscribed(topic string, err error)
+	ConnectionLost()
+}
+
 type mqttClientOpts struct {
 	BrokerAddress   string
 	ClientID        string
 	MessageHandlers messageHandlers
+	Subscriptions   subscriptionTracker
+	Metrics         *processorMetrics
 	LogError        *log.Logger
 	LogInfo         *log.Logger
 }
@@ -44,6 +52,8 @@ func NewMqttClient(o mqttClientOpts) mqtt.Client {
 	}
 	opts.OnConnectionLost = func(_ mqtt.Client, err error) {
 		o.LogInfo.Printf("Connection lost: %s\n", err)
+		o.Subscriptions.ConnectionLost()
+		o.Metrics.connectionsLost.Inc()
 	}
 	opts.OnConnect = func(c mqtt.Client) {
 		o.LogInfo.Println("Connection established")
@@ -55,6 +65,7 @@ func NewMqttClient(o mqttClientOpts) mqtt.Client {
 			// in other handlers does cause problems its best to just assume we should not block
 			go func(topic string) {
 				_ = t.Wait() // Can also use '<-t.Done()' in releases > 1.2.0
+				o.Subscriptions.Subscribed(topic, t.Error())
 				if t.Error() != nil {
 					o.LogError.Printf("Error subscribing: %s\n", t.Error())
 				} else {
@@ -65,6 +76,7 @@ func NewMqttClient(o mqttClientOpts) mqtt.Client {
 	}
 	opts.OnReconnecting = func(_ mqtt.Client, _ *mqtt.ClientOptions) {
 		o.LogInfo.Println("Attempting to reconnect")
+		o.Metrics.reconnects.Inc()
 	}
 
 	// Connect to the broker
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"text/template"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/miselaytes-anton/airy/internal/config"
+	"github.com/miselaytes-anton/airy/internal/notify"
+)
+
+const (
+	notifyTimeout    = 10 * time.Second
+	notifyMaxBackoff = 5 * time.Minute
+	notifyQueueSize  = 100
+)
+
+// newNotificationChannels creates a channel for every configured notification destination.
+// MQTT notifications are published with the client the processor receives measurements with.
+func newNotificationChannels(c config.NotifyConfig, client mqtt.Client) ([]notify.Channel, error) {
+	notifiers := make(map[string]notify.Notifier)
+
+	if c.WebhookURL != "" {
+		t, err := parseTemplate("NOTIFY_WEBHOOK_TEMPLATE", c.WebhookTemplate)
+		if err != nil {
+			return nil, err
+		}
+		notifiers["webhook"] = notify.Webhook{URL: c.WebhookURL, Template: t}
+	}
+
+	if c.SMTPAddress != "" {
+		if c.SMTPFrom == "" || len(c.SMTPTo) == 0 {
+			return nil, fmt.Errorf("NOTIFY_SMTP_FROM and NOTIFY_SMTP_TO are required when NOTIFY_SMTP_ADDRESS is set")
+		}
+		subject, err := parseTemplate("NOTIFY_SMTP_SUBJECT_TEMPLATE", c.SMTPSubjectTemplate)
+		if err != nil {
+			return nil, err
+		}
+		body, err := parseTemplate("NOTIFY_SMTP_BODY_TEMPLATE", c.SMTPBodyTemplate)
+		if err != nil {
+			return nil, err
+		}
+		notifiers["smtp"] = notify.SMTP{
+			Address:         c.SMTPAddress,
+			Username:        c.SMTPUsername,
+			Password:        c.SMTPPassword,
+			From:            c.SMTPFrom,
+			To:              c.SMTPTo,
+			SubjectTemplate: subject,
+			BodyTemplate:    body,
+		}
+	}
+
+	if c.MQTTTopic != "" {
+		t, err := parseTemplate("NOTIFY_MQTT_TEMPLATE", c.MQTTTemplate)
+		if err != nil {
+			return nil, err
+		}
+		notifiers["mqtt"] = notify.MQTT{Client: client, Topic: c.MQTTTopic, QOS: 1, Template: t}
+	}
+
+	channels := make([]notify.Channel, 0)
+	for _, name := range []string{"webhook", "smtp", "mqtt"} {
+		notifier, ok := notifiers[name]
+		if !ok {
+			continue
+		}
+		channels = append(channels, notify.Channel{
+			Name:         name,
+			Notifier:     notifier,
+			Attempts:     c.RetryAttempts,
+			Backoff:      c.RetryBackoff,
+			MaxBackoff:   notifyMaxBackoff,
+			Timeout:      notifyTimeout,
+			DedupeWindow: c.DedupeWindow,
+		})
+	}
+
+	return channels, nil
+}
+
+// parseTemplate parses a notification template, an empty source leaves the default format of the channel.
+func parseTemplate(name string, source string) (*template.Template, error) {
+	if source == "" {
+		return nil, nil
+	}
+
+	t, err := template.New(name).Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid template: %w", name, err)
+	}
+
+	return t, nil
+}
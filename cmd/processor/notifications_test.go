@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/miselaytes-anton/airy/internal/config"
+)
+
+func Test_newNotificationChannels(t *testing.T) {
+	data := []struct {
+		name          string
+		config        config.NotifyConfig
+		expectedNames []string
+		expectError   bool
+	}{
+		{"none", config.NotifyConfig{}, []string{}, false},
+		{
+			"all",
+			config.NotifyConfig{WebhookURL: "http://localhost/hook", SMTPAddress: "localhost:25", SMTPFrom: "airy@example.com", SMTPTo: []string{"anton@example.com"}, MQTTTopic: "airy/notifications"},
+			[]string{"webhook", "smtp", "mqtt"},
+			false,
+		},
+		{"smtp without recipients", config.NotifyConfig{SMTPAddress: "localhost:25", SMTPFrom: "airy@example.com"}, nil, true},
+		{"invalid template", config.NotifyConfig{WebhookURL: "http://localhost/hook", WebhookTemplate: "{{.Summary"}, nil, true},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				d.config.RetryAttempts = 3
+				d.config.RetryBackoff = time.Second
+
+				channels, err := newNotificationChannels(d.config, nil)
+
+				if diff := cmp.Diff(d.expectError, err != nil); diff != "" {
+					t.Fatalf("unexpected error %v: %s", err, diff)
+				}
+				if err != nil {
+					return
+				}
+
+				names := make([]string, 0)
+				for _, c := range channels {
+					names = append(names, c.Name)
+				}
+				if diff := cmp.Diff(d.expectedNames, names); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
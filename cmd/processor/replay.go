@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+)
+
+type deadLetterReplayer struct {
+	Handler      measurementHandler
+	Measurements models.MeasurementModelInterface
+	DeadLetters  models.DeadLetterModelInterface
+	LogError     *log.Logger
+	LogInfo      *log.Logger
+}
+
+// replay processes all stored dead letters again, e.g. after a parser fix or a database outage.
+// Dead letters which are inserted successfully are deleted, the others are kept for a later attempt.
+func (r deadLetterReplayer) replay() (replayed int, failed int, err error) {
+	deadLetters, err := r.DeadLetters.GetAll(models.DeadLettersQuery{StartEpoch: 0, EndEpoch: math.MaxInt32})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, d := range deadLetters {
+		m, err := r.Handler.process(d.Payload, time.Unix(d.ReceivedAt, 0))
+		if err != nil {
+			r.LogError.Printf("dead letter %s could not be replayed: %s", d.ID, err)
+			failed++
+			continue
+		}
+
+		id, err := r.Measurements.InsertMeasurement(m)
+		switch {
+		case errors.Is(err, models.ErrDuplicateMeasurement):
+			// the measurement was already stored, so the dead letter is resolved as well
+			r.LogInfo.Printf("dead letter %s is a duplicate of a stored measurement\n", d.ID)
+		case err != nil:
+			r.LogError.Printf("dead letter %s could not be inserted into database: %s", d.ID, err)
+			failed++
+			continue
+		default:
+			r.LogInfo.Printf("dead letter %s replayed as measurement %s\n", d.ID, id)
+		}
+
+		err = r.DeadLetters.Delete(d.ID)
+		if err != nil {
+			return replayed, failed, err
+		}
+
+		replayed++
+	}
+
+	r.LogInfo.Printf("replayed %d dead letters, %d failed\n", replayed, failed)
+
+	return replayed, failed, nil
+}
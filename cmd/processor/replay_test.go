@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+	"github.com/miselaytes-anton/airy/internal/models/mocks"
+)
+
+func Test_replay(t *testing.T) {
+	valid := models.DeadLetter{
+		ID:         "valid",
+		Topic:      "measurement",
+		Payload:    "bedroom 51.86 607.44 0.52 100853 27.25 60.22",
+		Reason:     "measurement could not be queued: measurement queue is full",
+		ReceivedAt: 1702156335,
+	}
+	invalid := models.DeadLetter{
+		ID:         "invalid",
+		Topic:      "measurement",
+		Payload:    "bedroom something",
+		Reason:     "message could not be parsed: strconv.ParseFloat: parsing \"\": invalid syntax",
+		ReceivedAt: 1702156335,
+	}
+
+	duplicate := models.DeadLetter{
+		ID:         "duplicate",
+		Topic:      "measurement",
+		Payload:    "bedroom 51.86 607.44 0.52 100853 27.25 60.22 1702156000",
+		Reason:     "measurement could not be inserted: connection refused",
+		ReceivedAt: 1702156335,
+	}
+
+	measurementsMock := mocks.MeasurementModelMock{
+		Measurements: make([]models.Measurement, 0),
+		InsertMeasurementMock: func(m models.Measurement, measurements *[]models.Measurement) (string, error) {
+			if m.Timestamp == 1702156000 {
+				return "", models.ErrDuplicateMeasurement
+			}
+			*measurements = append(*measurements, m)
+			return "uuid", nil
+		},
+	}
+	deadLettersMock := mocks.DeadLetterModelMock{
+		DeadLetters:           []models.DeadLetter{valid, invalid, duplicate},
+		GetAllDeadLettersMock: mocks.GetAllDeadLettersOkMock,
+		DeleteDeadLetterMock:  mocks.DeleteDeadLetterOkMock,
+	}
+
+	replayer := deadLetterReplayer{
+		Handler: measurementHandler{
+			MaxClockSkew: time.Minute,
+			Now:          time.Now,
+			LogError:     log.New(io.Discard, "", 0),
+			LogInfo:      log.New(io.Discard, "", 0),
+		},
+		Measurements: &measurementsMock,
+		DeadLetters:  &deadLettersMock,
+		LogError:     log.New(io.Discard, "", 0),
+		LogInfo:      log.New(io.Discard, "", 0),
+	}
+
+	replayed, failed, err := replayer.replay()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]int{2, 1}, []int{replayed, failed}); diff != "" {
+		t.Error(diff)
+	}
+
+	expected := []models.Measurement{{
+		SensorID:    "bedroom",
+		IAQ:         51.86,
+		CO2:         607.44,
+		VOC:         0.52,
+		Pressure:    100853,
+		Temperature: 27.25,
+		Humidity:    60.22,
+		Timestamp:   valid.ReceivedAt,
+		ReceivedAt:  valid.ReceivedAt,
+	}}
+	if diff := cmp.Diff(expected, measurementsMock.Measurements); diff != "" {
+		t.Error(diff)
+	}
+
+	if diff := cmp.Diff([]models.DeadLetter{invalid}, deadLettersMock.DeadLetters); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+)
+
+// rollupDay is the span rollups are backfilled in, the coarsest rollup consists of whole days.
+const rollupDay = 24 * 3600
+
+type rollupRefresherOpts struct {
+	Rollups models.RollupModelInterface
+	// Interval is how often the rollups of changed measurements are rebuilt.
+	Interval time.Duration
+	LogError *log.Logger
+}
+
+// rollupRefresher rebuilds the rollups of inserted and updated measurements in the background,
+// so that the rollups lag behind the measurements by at most the interval.
+type rollupRefresher struct {
+	rollupRefresherOpts
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newRollupRefresher creates a rollup refresher and starts refreshing in the background.
+func newRollupRefresher(o rollupRefresherOpts) *rollupRefresher {
+	r := &rollupRefresher{
+		rollupRefresherOpts: o,
+		stop:                make(chan struct{}),
+		done:                make(chan struct{}),
+	}
+
+	go r.run()
+
+	return r
+}
+
+// Close stops the refresher after a last refresh.
+func (r *rollupRefresher) Close() {
+	close(r.stop)
+	<-r.done
+}
+
+func (r *rollupRefresher) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			r.refresh()
+			return
+		case <-ticker.C:
+			r.refresh()
+		}
+	}
+}
+
+// refresh rebuilds the pending rollups, buckets stay pending when the database is unreachable.
+func (r *rollupRefresher) refresh() {
+	if _, err := r.Rollups.Refresh(); err != nil {
+		r.LogError.Printf("rollups could not be refreshed: %s", err)
+	}
+}
+
+// backfillRollups builds the rollups of all stored measurements day by day, e.g. after the rollups were introduced.
+// Days are built from the last to the first and every built day is recorded, so that the server queries the rollups
+// of the days built so far and an interrupted backfill can be run again. It returns the number of days built.
+func backfillRollups(rollups models.RollupModelInterface, logInfo *log.Logger) (int, error) {
+	first, last, ok, err := rollups.GetRange()
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		logInfo.Println("there are no measurements to build rollups of")
+		// measurements stored from now on are rolled up by the processor
+		return 0, rollups.SetBackfilled(0)
+	}
+
+	days := 0
+	firstDay := first - first%rollupDay
+	for start := last - last%rollupDay; start >= firstDay; start -= rollupDay {
+		if err := rollups.Build(start, start+rollupDay); err != nil {
+			return days, err
+		}
+
+		// there are no measurements before the first day
+		backfilled := start
+		if start == firstDay {
+			backfilled = 0
+		}
+		if err := rollups.SetBackfilled(backfilled); err != nil {
+			return days, err
+		}
+
+		days++
+		logInfo.Printf("built rollups of %s\n", time.Unix(start, 0).UTC().Format("2006-01-02"))
+	}
+
+	logInfo.Printf("built rollups of %d days\n", days)
+
+	return days, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/miselaytes-anton/airy/internal/models/mocks"
+)
+
+func Test_rollupRefresher(t *testing.T) {
+	refreshed := make(chan struct{}, 10)
+	rollupsMock := mocks.RollupModelMock{
+		RefreshRollupsMock: func(built *[][2]int64) (int, error) {
+			refreshed <- struct{}{}
+			return mocks.RefreshRollupsErrorMock(built)
+		},
+	}
+
+	refresher := newRollupRefresher(rollupRefresherOpts{
+		Rollups:  &rollupsMock,
+		Interval: time.Millisecond,
+		LogError: log.New(io.Discard, "", 0),
+	})
+
+	// a failing refresh is retried with the next tick
+	<-refreshed
+	<-refreshed
+	refresher.Close()
+}
+
+func Test_backfillRollups(t *testing.T) {
+	data := []struct {
+		name       string
+		first      int64
+		last       int64
+		ok         bool
+		expected   [][2]int64
+		backfilled []int64
+	}{
+		{"days", 3600, 2*rollupDay + 60, true, [][2]int64{{2 * rollupDay, 3 * rollupDay}, {rollupDay, 2 * rollupDay}, {0, rollupDay}}, []int64{2 * rollupDay, rollupDay, 0}},
+		{"single measurement", rollupDay, rollupDay, true, [][2]int64{{rollupDay, 2 * rollupDay}}, []int64{0}},
+		{"no measurements", 0, 0, false, nil, []int64{0}},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				rollupsMock := mocks.RollupModelMock{
+					BuildRollupsMock:         mocks.BuildRollupsOkMock,
+					SetRollupsBackfilledMock: mocks.SetRollupsBackfilledOkMock,
+					GetRollupsRangeMock: func(*[][2]int64) (int64, int64, bool, error) {
+						return d.first, d.last, d.ok, nil
+					},
+				}
+
+				days, err := backfillRollups(&rollupsMock, log.New(io.Discard, "", 0))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if diff := cmp.Diff(d.expected, rollupsMock.Built); diff != "" {
+					t.Error(diff)
+				}
+				if diff := cmp.Diff(d.backfilled, rollupsMock.Backfilled); diff != "" {
+					t.Error(diff)
+				}
+				if diff := cmp.Diff(len(d.expected), days); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+	"github.com/miselaytes-anton/airy/internal/notify"
+)
+
+type sensorRegistryOpts struct {
+	Sensors models.SensorModelInterface
+	// FlushInterval is how often last seen times and firmware versions are persisted and sensors are checked for silence.
+	FlushInterval time.Duration
+	// OfflineAfter is how long a sensor may be silent before it is considered offline.
+	OfflineAfter time.Duration
+	// Notifications receives sensors going offline and coming back online, it may be nil.
+	Notifications notificationDispatcher
+	Now           func() time.Time
+	LogError      *log.Logger
+	LogInfo       *log.Logger
+}
+
+// sensorTransition is a change of the online status of a sensor.
+type sensorTransition struct {
+	SensorID  string
+	Status    string
+	Timestamp int64
+}
+
+// sensorRegistry keeps track of the sensors which sent messages and persists their sightings in batches,
+// so that a message does not cost an additional database write. Sensors which were not seen before are
+// registered right away.
+//
+// The registry also tracks liveness: a sensor which did not send a message for OfflineAfter goes offline,
+// and comes back online with its next message. Transitions are logged and persisted with the sensor.
+type sensorRegistry struct {
+	sensorRegistryOpts
+	mu      sync.Mutex
+	pending map[string]models.SensorSighting
+	// known are sensors which were registered by this process.
+	known map[string]bool
+	// lastSeen and status are the liveness state of every sensor seen or loaded from the database.
+	lastSeen    map[string]int64
+	status      map[string]string
+	loaded      bool
+	transitions []sensorTransition
+	// unknown signals that a sensor which is not registered yet was seen.
+	unknown chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// newSensorRegistry creates a sensor registry and starts persisting sightings in the background.
+func newSensorRegistry(o sensorRegistryOpts) *sensorRegistry {
+	r := &sensorRegistry{
+		sensorRegistryOpts: o,
+		pending:            make(map[string]models.SensorSighting),
+		known:              make(map[string]bool),
+		lastSeen:           make(map[string]int64),
+		status:             make(map[string]string),
+		unknown:            make(chan struct{}, 1),
+		stop:               make(chan struct{}),
+		done:               make(chan struct{}),
+	}
+
+	go r.run()
+
+	return r
+}
+
+// Seen records that a sensor sent a message at the given time.
+func (r *sensorRegistry) Seen(sensorID string, firmwareVersion string, at time.Time) {
+	r.mu.Lock()
+	r.add(models.SensorSighting{SensorID: sensorID, FirmwareVersion: firmwareVersion, Timestamp: at.Unix()})
+	if at.Unix() > r.lastSeen[sensorID] {
+		r.lastSeen[sensorID] = at.Unix()
+	}
+	if r.status[sensorID] != models.SensorStatusOnline {
+		r.transition(sensorID, models.SensorStatusOnline, at.Unix())
+	}
+	known := r.known[sensorID]
+	r.mu.Unlock()
+
+	if !known {
+		select {
+		case r.unknown <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// add merges a sighting into the pending ones, it must be called with mu held.
+func (r *sensorRegistry) add(s models.SensorSighting) {
+	p, ok := r.pending[s.SensorID]
+	if !ok {
+		r.pending[s.SensorID] = s
+		return
+	}
+
+	if s.Timestamp > p.Timestamp {
+		p.Timestamp = s.Timestamp
+	}
+	if s.FirmwareVersion != "" {
+		p.FirmwareVersion = s.FirmwareVersion
+	}
+	r.pending[s.SensorID] = p
+}
+
+// transition changes the status of a sensor, it must be called with mu held.
+func (r *sensorRegistry) transition(sensorID string, status string, at int64) {
+	previous := r.status[sensorID]
+	r.status[sensorID] = status
+	r.transitions = append(r.transitions, sensorTransition{SensorID: sensorID, Status: status, Timestamp: at})
+
+	// a sensor seen for the first time is not worth a notification, only recoveries and outages are
+	if r.Notifications != nil && (status == models.SensorStatusOffline || previous == models.SensorStatusOffline) {
+		r.Notifications.Dispatch(notify.Notification{
+			Key:       "sensor:" + sensorID,
+			Kind:      notify.KindSensor,
+			Status:    status,
+			SensorID:  sensorID,
+			Timestamp: at,
+		})
+	}
+
+	if status == models.SensorStatusOffline {
+		r.LogError.Printf("sensor %s is offline, last seen %s ago", sensorID, time.Unix(at, 0).Sub(time.Unix(r.lastSeen[sensorID], 0)))
+		return
+	}
+	r.LogInfo.Printf("sensor %s is %s\n", sensorID, status)
+}
+
+// Close stops the registry and persists pending sightings.
+func (r *sensorRegistry) Close() {
+	close(r.stop)
+	<-r.done
+}
+
+func (r *sensorRegistry) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.FlushInterval)
+	defer ticker.Stop()
+
+	r.load()
+
+	for {
+		select {
+		case <-r.stop:
+			r.flush()
+			return
+		case <-r.unknown:
+			r.flush()
+		case <-ticker.C:
+			r.load()
+			r.check()
+			r.flush()
+		}
+	}
+}
+
+// load restores the liveness state of registered sensors, so that sensors which went silent while the processor
+// was not running are detected as well. It is retried until the database is reachable.
+func (r *sensorRegistry) load() {
+	r.mu.Lock()
+	loaded := r.loaded
+	r.mu.Unlock()
+
+	if loaded {
+		return
+	}
+
+	sensors, err := r.Sensors.GetAll()
+	if err != nil {
+		r.LogError.Printf("sensors could not be loaded: %s", err)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range sensors {
+		r.known[s.ID] = true
+		if _, ok := r.status[s.ID]; ok {
+			continue
+		}
+		r.status[s.ID] = s.Status
+		r.lastSeen[s.ID] = s.LastSeen
+	}
+	r.loaded = true
+}
+
+// check moves online sensors which were silent for longer than OfflineAfter offline.
+func (r *sensorRegistry) check() {
+	now := r.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for sensorID, status := range r.status {
+		if status != models.SensorStatusOnline {
+			continue
+		}
+		if now.Sub(time.Unix(r.lastSeen[sensorID], 0)) > r.OfflineAfter {
+			r.transition(sensorID, models.SensorStatusOffline, now.Unix())
+		}
+	}
+}
+
+// flush persists pending sightings and status transitions. When the database is not reachable they are kept for the next attempt.
+func (r *sensorRegistry) flush() {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[string]models.SensorSighting)
+	r.mu.Unlock()
+
+	if len(pending) > 0 {
+		r.flushSightings(pending)
+	}
+
+	r.mu.Lock()
+	transitions := r.transitions
+	r.transitions = nil
+	r.mu.Unlock()
+
+	for i, t := range transitions {
+		err := r.Sensors.SetStatus(t.SensorID, t.Status, t.Timestamp)
+		if errors.Is(err, models.ErrSensorNotFound) {
+			// the sensor was deleted in the meantime
+			continue
+		}
+		if err != nil {
+			r.LogError.Printf("status of sensor %s could not be stored: %s", t.SensorID, err)
+			r.mu.Lock()
+			r.transitions = append(transitions[i:], r.transitions...)
+			r.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (r *sensorRegistry) flushSightings(pending map[string]models.SensorSighting) {
+	sightings := make([]models.SensorSighting, 0, len(pending))
+	for _, s := range pending {
+		sightings = append(sightings, s)
+	}
+
+	err := r.Sensors.RegisterSightings(sightings)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err != nil {
+		r.LogError.Printf("%d sensor sightings could not be stored: %s", len(sightings), err)
+		for _, s := range sightings {
+			r.add(s)
+		}
+		return
+	}
+
+	for _, s := range sightings {
+		if !r.known[s.SensorID] {
+			r.known[s.SensorID] = true
+			r.LogInfo.Printf("sensor %s registered\n", s.SensorID)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+	"github.com/miselaytes-anton/airy/internal/models/mocks"
+)
+
+// lockedSensorModelMock guards a sensor model mock which is used by the registry in the background.
+type lockedSensorModelMock struct {
+	mu sync.Mutex
+	mocks.SensorModelMock
+}
+
+func (m *lockedSensorModelMock) GetAll() ([]models.Sensor, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.SensorModelMock.GetAll()
+}
+
+func (m *lockedSensorModelMock) RegisterSightings(sightings []models.SensorSighting) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.SensorModelMock.RegisterSightings(sightings)
+}
+
+func (m *lockedSensorModelMock) SetStatus(id string, status string, changedAt int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.SensorModelMock.SetStatus(id, status, changedAt)
+}
+
+func (m *lockedSensorModelMock) sensors() []models.Sensor {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]models.Sensor(nil), m.Sensors...)
+}
+
+func newTestSensorRegistry(sensors models.SensorModelInterface, flushInterval time.Duration, now func() time.Time, notifications notificationDispatcher) *sensorRegistry {
+	return newSensorRegistry(sensorRegistryOpts{
+		Sensors:       sensors,
+		FlushInterval: flushInterval,
+		OfflineAfter:  time.Minute,
+		Notifications: notifications,
+		Now:           now,
+		LogError:      log.New(io.Discard, "", 0),
+		LogInfo:       log.New(io.Discard, "", 0),
+	})
+}
+
+func Test_sensorRegistry(t *testing.T) {
+	sensorsMock := lockedSensorModelMock{SensorModelMock: mocks.SensorModelMock{
+		Sensors:               []models.Sensor{{ID: "bedroom", FirmwareVersion: "1.0.0", FirstSeen: 1, LastSeen: 1, Status: models.SensorStatusOffline}},
+		GetAllSensorsMock:     mocks.GetAllSensorsOkMock,
+		RegisterSightingsMock: mocks.RegisterSightingsOkMock,
+		SetSensorStatusMock:   mocks.SetSensorStatusOkMock,
+	}}
+
+	registry := newTestSensorRegistry(&sensorsMock, time.Hour, time.Now, nil)
+
+	registry.Seen("bedroom", "1.1.0", time.Unix(10, 0))
+	registry.Seen("bedroom", "", time.Unix(20, 0))
+	registry.Seen("kitchen", "", time.Unix(15, 0))
+	registry.Close()
+
+	expected := []models.Sensor{
+		{ID: "bedroom", FirmwareVersion: "1.1.0", FirstSeen: 1, LastSeen: 20, Status: models.SensorStatusOnline, StatusChangedAt: 10},
+		{ID: "kitchen", FirstSeen: 15, LastSeen: 15, Status: models.SensorStatusOnline, StatusChangedAt: 15},
+	}
+	if diff := cmp.Diff(expected, sensorsMock.sensors()); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_sensorRegistry_unknownSensor(t *testing.T) {
+	var mu sync.Mutex
+	registered := make(chan []models.SensorSighting, 1)
+	available := false
+
+	sensorsMock := mocks.SensorModelMock{
+		GetAllSensorsMock: mocks.GetAllSensorsOkMock,
+		RegisterSightingsMock: func(sightings []models.SensorSighting, _ *[]models.Sensor) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if !available {
+				return mocks.RegisterSightingsErrorMock(sightings, nil)
+			}
+			registered <- sightings
+			return nil
+		},
+		SetSensorStatusMock: func(string, string, int64, *[]models.Sensor) error { return nil },
+	}
+
+	registry := newTestSensorRegistry(&sensorsMock, time.Hour, time.Now, nil)
+	defer registry.Close()
+
+	// the first attempt fails, the sighting is kept and registered with the next unknown sensor
+	registry.Seen("kitchen", "", time.Unix(1, 0))
+	time.Sleep(20 * time.Millisecond)
+
+	mu.Lock()
+	available = true
+	mu.Unlock()
+
+	registry.Seen("hallway", "", time.Unix(2, 0))
+
+	select {
+	case sightings := <-registered:
+		if diff := cmp.Diff(2, len(sightings)); diff != "" {
+			t.Error(diff)
+		}
+	case <-time.After(time.Second):
+		t.Error("unknown sensors were not registered before the flush interval")
+	}
+}
+
+func Test_sensorRegistry_liveness(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Unix(1702156335, 0)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+
+	sensorsMock := lockedSensorModelMock{SensorModelMock: mocks.SensorModelMock{
+		Sensors: []models.Sensor{
+			{ID: "bedroom", LastSeen: now.Unix(), Status: models.SensorStatusOnline},
+			// went silent while the processor was not running
+			{ID: "livingroom", LastSeen: now.Unix() - 3600, Status: models.SensorStatusOnline},
+			{ID: "hallway", Status: models.SensorStatusUnknown},
+		},
+		GetAllSensorsMock:     mocks.GetAllSensorsOkMock,
+		RegisterSightingsMock: mocks.RegisterSightingsOkMock,
+		SetSensorStatusMock:   mocks.SetSensorStatusOkMock,
+	}}
+
+	recorder := notificationRecorder{}
+	registry := newTestSensorRegistry(&sensorsMock, 5*time.Millisecond, clock, &recorder)
+	defer registry.Close()
+
+	statuses := func() map[string]string {
+		statuses := make(map[string]string)
+		for _, s := range sensorsMock.sensors() {
+			statuses[s.ID] = s.Status
+		}
+		return statuses
+	}
+
+	waitFor := func(expected map[string]string) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			if cmp.Equal(expected, statuses()) {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Error(cmp.Diff(expected, statuses()))
+	}
+
+	waitFor(map[string]string{"bedroom": "online", "livingroom": "offline", "hallway": "unknown"})
+
+	advance(30 * time.Second)
+	registry.Seen("bedroom", "", clock())
+	advance(45 * time.Second)
+
+	// bedroom was seen 45 seconds ago, which is within the silence window
+	time.Sleep(20 * time.Millisecond)
+	waitFor(map[string]string{"bedroom": "online", "livingroom": "offline", "hallway": "unknown"})
+
+	advance(time.Minute)
+	waitFor(map[string]string{"bedroom": "offline", "livingroom": "offline", "hallway": "unknown"})
+
+	registry.Seen("livingroom", "", clock())
+	waitFor(map[string]string{"bedroom": "offline", "livingroom": "online", "hallway": "unknown"})
+
+	notified := make([]string, 0)
+	for _, n := range recorder.dispatched() {
+		notified = append(notified, n.Key+" "+n.Status)
+	}
+	if diff := cmp.Diff([]string{"sensor:livingroom offline", "sensor:bedroom offline", "sensor:livingroom online"}, notified); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/julienschmidt/httprouter"
+	"github.com/miselaytes-anton/airy/internal/models"
+	"github.com/miselaytes-anton/airy/internal/urlquery"
+)
+
+type alertsListQuery struct {
+	From   *int64  `validate:"required,gte=0,lte=2147483647"`
+	To     *int64  `validate:"required,gtfield=From,lte=2147483647"`
+	Status *string `validate:"omitempty,oneof=firing resolved"`
+}
+
+func parseAlertsListQuery(r *http.Request) (*alertsListQuery, error) {
+	values := r.URL.Query()
+	from, err := urlquery.ReadInt64FromQuery(values, "from")
+	if err != nil {
+		return nil, err
+	}
+	to, err := urlquery.ReadInt64FromQuery(values, "to")
+	if err != nil {
+		return nil, err
+	}
+	return &alertsListQuery{
+		From:   from,
+		To:     to,
+		Status: urlquery.ReadStringFromQuery(values, "status"),
+	}, nil
+}
+
+func (s *Server) handleAlertsList() http.HandlerFunc {
+	validate := validator.New(validator.WithRequiredStructEnabled())
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseAlertsListQuery(r)
+		if err != nil {
+			s.jsonError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		err = validate.Struct(q)
+		if err != nil {
+			s.jsonValidationError(w, err)
+			return
+		}
+
+		query := models.AlertsQuery{
+			StartEpoch: *q.From,
+			EndEpoch:   *q.To,
+		}
+		if q.Status != nil {
+			query.Status = *q.Status
+		}
+
+		alerts, err := s.Alerts.GetAll(query)
+		if err != nil {
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(alerts)
+		if err != nil {
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (s *Server) handleAlertRulesList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rules, err := s.AlertRules.GetAll()
+		if err != nil {
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(rules)
+		if err != nil {
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (s *Server) handleAlertRulesCreate() http.HandlerFunc {
+	type request struct {
+		Name       string   `json:"name" validate:"max=255"`
+		SensorID   string   `json:"sensorId" validate:"max=255"`
+		Metric     string   `json:"metric" validate:"required,oneof=iaq co2 voc pressure temperature humidity"`
+		Comparison string   `json:"comparison" validate:"required,oneof=above below"`
+		Threshold  *float64 `json:"threshold" validate:"required"`
+		Duration   int64    `json:"duration" validate:"gte=0,lte=2147483647"`
+		Hysteresis float64  `json:"hysteresis" validate:"gte=0"`
+	}
+
+	type response = models.AlertRule
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request request
+		err := s.readJson(w, r, &request)
+		if err != nil {
+			s.jsonError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		err = validate.Struct(request)
+		if err != nil {
+			s.jsonValidationError(w, err)
+			return
+		}
+
+		if request.SensorID != "" && !s.checkSensorID(w, "sensorId", request.SensorID) {
+			return
+		}
+
+		rule, err := s.AlertRules.InsertAlertRule(models.AlertRule{
+			Name:       request.Name,
+			SensorID:   request.SensorID,
+			Metric:     request.Metric,
+			Comparison: request.Comparison,
+			Threshold:  *request.Threshold,
+			Duration:   request.Duration,
+			Hysteresis: request.Hysteresis,
+		})
+		if err != nil {
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		var response response = rule
+
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (s *Server) handleAlertRulesUpdate() http.HandlerFunc {
+	type request struct {
+		Name       *string  `json:"name,omitempty" validate:"omitempty,max=255"`
+		SensorID   *string  `json:"sensorId,omitempty" validate:"omitempty,max=255"`
+		Metric     *string  `json:"metric,omitempty" validate:"omitempty,oneof=iaq co2 voc pressure temperature humidity"`
+		Comparison *string  `json:"comparison,omitempty" validate:"omitempty,oneof=above below"`
+		Threshold  *float64 `json:"threshold,omitempty"`
+		Duration   *int64   `json:"duration,omitempty" validate:"omitempty,gte=0,lte=2147483647"`
+		Hysteresis *float64 `json:"hysteresis,omitempty" validate:"omitempty,gte=0"`
+	}
+
+	type response = models.AlertRule
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request request
+		err := s.readJson(w, r, &request)
+		if err != nil {
+			s.jsonError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		err = validate.Struct(request)
+		if err != nil {
+			s.jsonValidationError(w, err)
+			return
+		}
+
+		if request.SensorID != nil && *request.SensorID != "" && !s.checkSensorID(w, "sensorId", *request.SensorID) {
+			return
+		}
+
+		params := httprouter.ParamsFromContext(r.Context())
+
+		rule, err := s.AlertRules.Get(params.ByName("id"))
+		if err != nil {
+			if errors.Is(err, models.ErrAlertRuleNotFound) {
+				s.jsonError(w, err, http.StatusNotFound)
+				return
+			}
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		if request.Name != nil {
+			rule.Name = *request.Name
+		}
+		if request.SensorID != nil {
+			rule.SensorID = *request.SensorID
+		}
+		if request.Metric != nil {
+			rule.Metric = *request.Metric
+		}
+		if request.Comparison != nil {
+			rule.Comparison = *request.Comparison
+		}
+		if request.Threshold != nil {
+			rule.Threshold = *request.Threshold
+		}
+		if request.Duration != nil {
+			rule.Duration = *request.Duration
+		}
+		if request.Hysteresis != nil {
+			rule.Hysteresis = *request.Hysteresis
+		}
+
+		rule, err = s.AlertRules.UpdateAlertRule(rule)
+		if err != nil {
+			if errors.Is(err, models.ErrAlertRuleNotFound) {
+				s.jsonError(w, err, http.StatusNotFound)
+				return
+			}
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		response := response(rule)
+
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (s *Server) handleAlertRulesDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		err := s.AlertRules.DeleteAlertRule(params.ByName("id"))
+		if err != nil {
+			if errors.Is(err, models.ErrAlertRuleNotFound) {
+				s.jsonError(w, err, http.StatusNotFound)
+				return
+			}
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+	"github.com/miselaytes-anton/airy/internal/models/mocks"
+	"github.com/miselaytes-anton/airy/internal/testserver"
+)
+
+func newAlertsTestServer(rulesMock *mocks.AlertRuleModelMock, alertsMock *mocks.AlertModelMock) testserver.TestServer {
+	sensorsMock := mocks.SensorModelMock{
+		Sensors:       []models.Sensor{{ID: "bedroom"}, {ID: "livingroom"}},
+		GetSensorMock: mocks.GetSensorOkMock,
+	}
+
+	router := httprouter.New()
+	server := Server{
+		Router:     router,
+		Sensors:    &sensorsMock,
+		AlertRules: rulesMock,
+		Alerts:     alertsMock,
+		LogError:   log.New(io.Discard, "", 0),
+		LogInfo:    log.New(io.Discard, "", 0),
+	}
+
+	server.routes()
+
+	return testserver.TestServer{Server: httptest.NewServer(router)}
+}
+
+func Test_handleAlertsList(t *testing.T) {
+	alerts := []models.Alert{{
+		ID:        "uuid",
+		RuleID:    "rule",
+		SensorID:  "bedroom",
+		Metric:    "co2",
+		Value:     1100,
+		Status:    models.AlertStatusFiring,
+		StartedAt: 1,
+	}}
+
+	alertsMock := mocks.AlertModelMock{
+		Alerts:           alerts,
+		GetAllAlertsMock: mocks.GetAllAlertsOkMock,
+	}
+
+	ts := newAlertsTestServer(&mocks.AlertRuleModelMock{}, &alertsMock)
+	defer ts.Server.Close()
+
+	requests := []struct {
+		name             string
+		urlPath          string
+		expectedCode     int
+		getAllAlertsMock mocks.GetAllAlertsMock
+	}{
+		{
+			"valid query",
+			"/api/alerts?from=0&to=2",
+			http.StatusOK,
+			mocks.GetAllAlertsOkMock,
+		},
+		{
+			"valid query with status",
+			"/api/alerts?from=0&to=2&status=firing",
+			http.StatusOK,
+			mocks.GetAllAlertsOkMock,
+		},
+		{
+			"invalid status",
+			"/api/alerts?from=0&to=2&status=pending",
+			http.StatusBadRequest,
+			mocks.GetAllAlertsOkMock,
+		},
+		{
+			"missing to",
+			"/api/alerts?from=0",
+			http.StatusBadRequest,
+			mocks.GetAllAlertsOkMock,
+		},
+		{
+			"database error",
+			"/api/alerts?from=0&to=2",
+			http.StatusInternalServerError,
+			mocks.GetAllAlertsErrorMock,
+		},
+	}
+
+	for _, d := range requests {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				alertsMock.GetAllAlertsMock = d.getAllAlertsMock
+				statusCode, _, body := ts.Get(t, d.urlPath)
+
+				if diff := cmp.Diff(d.expectedCode, statusCode); diff != "" {
+					t.Error(diff)
+				}
+
+				if statusCode != http.StatusOK {
+					return
+				}
+
+				received := make([]models.Alert, 0)
+				if err := json.Unmarshal(body, &received); err != nil {
+					t.Fatal(err)
+				}
+
+				if diff := cmp.Diff(alerts, received); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
+
+func Test_handleAlertRulesCreate(t *testing.T) {
+	rulesMock := mocks.AlertRuleModelMock{
+		AlertRules:          make([]models.AlertRule, 0),
+		InsertAlertRuleMock: mocks.InsertAlertRuleOkMock,
+	}
+
+	ts := newAlertsTestServer(&rulesMock, &mocks.AlertModelMock{})
+	defer ts.Server.Close()
+
+	requests := []struct {
+		name          string
+		request       string
+		expectedCode  int
+		expectedError string
+	}{
+		{
+			"valid request",
+			`{"name": "stuffy bedroom", "sensorId": "bedroom", "metric": "co2", "comparison": "above", "threshold": 1000, "duration": 600, "hysteresis": 50}`,
+			http.StatusOK,
+			"",
+		},
+		{
+			"valid request for all sensors",
+			`{"metric": "humidity", "comparison": "above", "threshold": 65}`,
+			http.StatusOK,
+			"",
+		},
+		{
+			"unknown sensor",
+			`{"sensorId": "kitchen", "metric": "co2", "comparison": "above", "threshold": 1000}`,
+			http.StatusBadRequest,
+			"sensorId did not pass validation rules: unknown sensor kitchen",
+		},
+		{
+			"unknown metric",
+			`{"metric": "noise", "comparison": "above", "threshold": 1000}`,
+			http.StatusBadRequest,
+			"metric did not pass validation rules: oneof iaq co2 voc pressure temperature humidity",
+		},
+		{
+			"missing threshold",
+			`{"metric": "co2", "comparison": "above"}`,
+			http.StatusBadRequest,
+			"threshold did not pass validation rules: required",
+		},
+		{
+			"negative duration",
+			`{"metric": "co2", "comparison": "above", "threshold": 1000, "duration": -1}`,
+			http.StatusBadRequest,
+			"duration did not pass validation rules: gte 0",
+		},
+	}
+
+	for _, d := range requests {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				statusCode, _, body := ts.Post(t, "/api/alerts/rules", []byte(d.request))
+
+				if diff := cmp.Diff(d.expectedCode, statusCode); diff != "" {
+					t.Error(diff)
+				}
+
+				if d.expectedError == "" {
+					return
+				}
+
+				responseError := new(ResponseError)
+				if err := json.Unmarshal(body, &responseError); err != nil {
+					t.Fatal(err)
+				}
+
+				if diff := cmp.Diff(d.expectedError, responseError.Error); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+
+	expected := []models.AlertRule{
+		{ID: "uuid", Name: "stuffy bedroom", SensorID: "bedroom", Metric: "co2", Comparison: "above", Threshold: 1000, Duration: 600, Hysteresis: 50},
+		{ID: "uuid", Metric: "humidity", Comparison: "above", Threshold: 65},
+	}
+	if diff := cmp.Diff(expected, rulesMock.AlertRules); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_handleAlertRulesUpdate(t *testing.T) {
+	rulesMock := mocks.AlertRuleModelMock{
+		AlertRules:          []models.AlertRule{{ID: "rule", SensorID: "bedroom", Metric: "co2", Comparison: "above", Threshold: 1000}},
+		GetAlertRuleMock:    mocks.GetAlertRuleOkMock,
+		UpdateAlertRuleMock: mocks.UpdateAlertRuleOkMock,
+	}
+
+	ts := newAlertsTestServer(&rulesMock, &mocks.AlertModelMock{})
+	defer ts.Server.Close()
+
+	statusCode, _, _ := ts.Patch(t, "/api/alerts/rules/rule", []byte(`{"threshold": 1200, "sensorId": ""}`))
+	if diff := cmp.Diff(http.StatusOK, statusCode); diff != "" {
+		t.Error(diff)
+	}
+
+	expected := []models.AlertRule{{ID: "rule", Metric: "co2", Comparison: "above", Threshold: 1200}}
+	if diff := cmp.Diff(expected, rulesMock.AlertRules); diff != "" {
+		t.Error(diff)
+	}
+
+	statusCode, _, _ = ts.Patch(t, "/api/alerts/rules/unknown", []byte(`{"threshold": 1200}`))
+	if diff := cmp.Diff(http.StatusNotFound, statusCode); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_handleAlertRulesDelete(t *testing.T) {
+	rulesMock := mocks.AlertRuleModelMock{
+		AlertRules:          []models.AlertRule{{ID: "rule"}},
+		DeleteAlertRuleMock: mocks.DeleteAlertRuleOkMock,
+	}
+
+	ts := newAlertsTestServer(&rulesMock, &mocks.AlertModelMock{})
+	defer ts.Server.Close()
+
+	statusCode, _, _ := ts.Delete(t, "/api/alerts/rules/rule")
+	if diff := cmp.Diff(http.StatusNoContent, statusCode); diff != "" {
+		t.Error(diff)
+	}
+
+	statusCode, _, _ = ts.Delete(t, "/api/alerts/rules/rule")
+	if diff := cmp.Diff(http.StatusNotFound, statusCode); diff != "" {
+		t.Error(diff)
+	}
+}
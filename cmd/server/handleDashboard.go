@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/render"
+	"github.com/go-echarts/go-echarts/v2/templates"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+)
+
+//go:embed dashboard.html
+var dashboardHTML string
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(dashboardHTML))
+
+// chartTemplate renders a chart without the surrounding page, the dashboard loads the scripts of all charts once.
+var chartTemplate = render.MustTemplate("base", []string{templates.BaseTpl})
+
+// chartFunctionMarker marks JavaScript functions in chart options, go-echarts removes it when rendering a page.
+var chartFunctionMarker = regexp.MustCompile(`(__f__")|("__f__)|(__f__)`)
+
+// periodPerView is how far the previous and next links of a view move, as years, months and days.
+var periodPerView = map[string][3]int{
+	"day":   {0, 0, 1},
+	"week":  {0, 0, 7},
+	"month": {0, 1, 0},
+	"year":  {1, 0, 0},
+}
+
+type dashboardOption struct {
+	Value    string
+	Label    string
+	Selected bool
+}
+
+type dashboardPage struct {
+	Scripts []string
+	Charts  []template.HTML
+	// Period describes the shown time range, e.g. "26 Mar 2023 00:00 – 2 Apr 2023 23:59".
+	Period         string
+	Previous, Next string
+	Views          []dashboardOption
+	Date           string
+	From, To       string
+	Resolutions    []dashboardOption
+	Aggregations   []dashboardOption
+	Sensors        []dashboardOption
+	Metrics        []dashboardOption
+	Timezone       string
+	// EventTypes are suggested when an event is added.
+	EventTypes []string
+	// Now and TimeZone let the event form take times in the timezone of the dashboard,
+	// TimeZone is the IANA name the browser resolves the offset of every entered time with.
+	Now      string
+	TimeZone string
+}
+
+// renderChartSnippet renders the chart as a container and a script which draws it.
+func renderChartSnippet(chart *charts.Line) (template.HTML, error) {
+	chart.Validate()
+
+	var buf bytes.Buffer
+	if err := chartTemplate.ExecuteTemplate(&buf, "base", chart); err != nil {
+		return "", err
+	}
+
+	return template.HTML(chartFunctionMarker.ReplaceAll(buf.Bytes(), nil)), nil
+}
+
+// shiftDate moves the date by the given years, months and days. Unlike time.AddDate the day is kept within
+// the month, so that one month before March 31 is February 29 rather than March 2.
+func shiftDate(date time.Time, years int, months int, days int) time.Time {
+	if years == 0 && months == 0 {
+		return date.AddDate(0, 0, days)
+	}
+
+	firstOfMonth := time.Date(date.Year()+years, date.Month()+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+
+	return time.Date(firstOfMonth.Year(), firstOfMonth.Month(), min(date.Day(), lastDay), 0, 0, 0, 0, time.UTC).AddDate(0, 0, days)
+}
+
+// shiftPeriod returns the query parameters of the period before (-1) or after (1) the shown one, other parameters are kept.
+func shiftPeriod(values url.Values, q graphsQuery, view string, date time.Time, direction int) url.Values {
+	shifted := url.Values{}
+	for key, value := range values {
+		shifted[key] = value
+	}
+
+	if q.From != nil && q.To != nil {
+		days := int(q.To.Sub(*q.From).Hours()/24) + 1
+		shifted.Set("from", q.From.AddDate(0, 0, direction*days).Format(dateFormat))
+		shifted.Set("to", q.To.AddDate(0, 0, direction*days).Format(dateFormat))
+		return shifted
+	}
+
+	period := periodPerView[view]
+	shifted.Set("view", view)
+	shifted.Set("date", shiftDate(date, direction*period[0], direction*period[1], direction*period[2]).Format(dateFormat))
+
+	return shifted
+}
+
+// formatResolution describes a resolution in seconds, e.g. "10 min" or "6 h".
+func formatResolution(resolution int) string {
+	if resolution%3600 == 0 {
+		return fmt.Sprintf("%d h", resolution/3600)
+	}
+	if resolution%60 == 0 {
+		return fmt.Sprintf("%d min", resolution/60)
+	}
+	return fmt.Sprintf("%d s", resolution)
+}
+
+// makeDashboardPage returns the controls and charts of the dashboard for the loaded graphs.
+func (s *Server) makeDashboardPage(values url.Values, data graphs) (dashboardPage, error) {
+	q := data.query
+	location := data.now.Location()
+
+	view := s.Views.Default
+	if q.View != nil {
+		view = *q.View
+	}
+
+	date := time.Date(data.now.Year(), data.now.Month(), data.now.Day(), 0, 0, 0, 0, time.UTC)
+	if q.Date != nil {
+		date = *q.Date
+	}
+
+	page := dashboardPage{
+		Period: fmt.Sprintf(
+			"%s – %s",
+			time.Unix(data.startEpoch, 0).In(location).Format("2 Jan 2006 15:04"),
+			time.Unix(data.endEpoch, 0).In(location).Format("2 Jan 2006 15:04"),
+		),
+		Previous:   "?" + shiftPeriod(values, q, view, date, -1).Encode(),
+		Next:       "?" + shiftPeriod(values, q, view, date, 1).Encode(),
+		Date:       date.Format(dateFormat),
+		EventTypes: make([]string, 0),
+		Now:        data.now.Format("2006-01-02T15:04"),
+		TimeZone:   location.String(),
+	}
+
+	if q.From != nil && q.To != nil {
+		page.From = q.From.Format(dateFormat)
+		page.To = q.To.Format(dateFormat)
+		page.Date = ""
+		view = ""
+	}
+
+	if q.Timezone != nil {
+		page.Timezone = *q.Timezone
+	}
+
+	for _, v := range []string{"day", "week", "month", "year"} {
+		page.Views = append(page.Views, dashboardOption{Value: v, Label: v, Selected: v == view})
+	}
+
+	page.Resolutions = append(page.Resolutions, dashboardOption{Value: "", Label: fmt.Sprintf("auto (%s)", formatResolution(data.resolution)), Selected: q.Resolution == nil})
+	options := resolutions
+	if q.Resolution != nil && !slices.Contains(options, *q.Resolution) {
+		options = append(slices.Clone(options), *q.Resolution)
+		slices.Sort(options)
+	}
+	for _, r := range options {
+		page.Resolutions = append(page.Resolutions, dashboardOption{Value: fmt.Sprint(r), Label: formatResolution(r), Selected: q.Resolution != nil && *q.Resolution == r})
+	}
+
+	// the average is the default, so that it is left out of the query
+	for _, a := range models.Aggregations {
+		value := a
+		if models.Aggregation(a) == models.AggregationAvg {
+			value = ""
+		}
+		page.Aggregations = append(page.Aggregations, dashboardOption{Value: value, Label: a, Selected: q.Aggregation == nil && value == "" || q.Aggregation != nil && *q.Aggregation == a})
+	}
+
+	for _, sensor := range data.allSensors {
+		label := sensor.DisplayName
+		if label == "" {
+			label = sensor.ID
+		}
+		page.Sensors = append(page.Sensors, dashboardOption{Value: sensor.ID, Label: label, Selected: len(q.Sensors) == 0 || slices.Contains(q.Sensors, sensor.ID)})
+	}
+
+	for _, m := range graphMetrics {
+		page.Metrics = append(page.Metrics, dashboardOption{Value: m.metric, Label: m.title, Selected: len(q.Metrics) == 0 || slices.Contains(q.Metrics, m.metric)})
+	}
+
+	for _, event := range data.events {
+		if !slices.Contains(page.EventTypes, event.EventType) {
+			page.EventTypes = append(page.EventTypes, event.EventType)
+		}
+	}
+	sort.Strings(page.EventTypes)
+
+	for _, chart := range data.charts(s.Bands) {
+		snippet, err := renderChartSnippet(chart)
+		if err != nil {
+			return dashboardPage{}, err
+		}
+		page.Charts = append(page.Charts, snippet)
+
+		for _, script := range chart.JSAssets.Values {
+			if !slices.Contains(page.Scripts, script) {
+				page.Scripts = append(page.Scripts, script)
+			}
+		}
+	}
+
+	return page, nil
+}
+
+func (s *Server) handleDashboard() http.HandlerFunc {
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, ok := s.loadGraphs(w, r, validate)
+		if !ok {
+			return
+		}
+
+		page, err := s.makeDashboardPage(r.URL.Query(), data)
+		if err != nil {
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := dashboardTemplate.Execute(&buf, page); err != nil {
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		buf.WriteTo(w)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/miselaytes-anton/airy/internal/config"
+	"github.com/miselaytes-anton/airy/internal/models"
+	"github.com/miselaytes-anton/airy/internal/models/mocks"
+	"github.com/miselaytes-anton/airy/internal/testserver"
+)
+
+func Test_handleDashboard(t *testing.T) {
+	eventsMock := mocks.EventModelMock{
+		Events:     []models.Event{{StartTimestamp: 1, LocationID: "bedroom", EventType: "window:open"}},
+		GetAllMock: mocks.GetAllEventsOkMock,
+	}
+
+	measurementsMock := mocks.MeasurementModelMock{
+		Measurements:        []models.Measurement{{Timestamp: 1, SensorID: "bedroom", IAQ: 150, CO2: 900}},
+		GetMeasurementsMock: mocks.GetMeasurementsOkMock,
+	}
+
+	sensorsMock := mocks.SensorModelMock{
+		Sensors: []models.Sensor{
+			{ID: "bedroom", DisplayName: "Bedroom", LastSeen: time.Now().Unix(), Status: models.SensorStatusOnline},
+			{ID: "livingroom", LastSeen: time.Now().Unix() - 3600, Status: models.SensorStatusOffline},
+		},
+		GetAllSensorsMock: mocks.GetAllSensorsOkMock,
+		GetSensorMock:     mocks.GetSensorOkMock,
+	}
+
+	router := httprouter.New()
+	server := Server{
+		Router:       router,
+		Events:       &eventsMock,
+		Measurements: &measurementsMock,
+		Sensors:      &sensorsMock,
+		OfflineAfter: 5 * time.Minute,
+		Location:     time.UTC,
+		Views:        config.Default().Views,
+		LogError:     log.New(io.Discard, "", 0),
+		LogInfo:      log.New(io.Discard, "", 0),
+	}
+
+	server.routes()
+
+	ts := testserver.TestServer{Server: httptest.NewServer(router)}
+	defer ts.Server.Close()
+
+	requests := []struct {
+		name         string
+		urlPath      string
+		expectedCode int
+		expectedBody []string
+	}{
+		{
+			"no query",
+			"/dashboard",
+			http.StatusOK,
+			[]string{`value="bedroom" checked> Bedroom`, `<option value="window:open">`, `<option value="" selected>avg</option>`},
+		},
+		{
+			"envelope",
+			"/dashboard?agg=envelope",
+			http.StatusOK,
+			[]string{`<option value="envelope" selected>envelope</option>`, `<option value="">avg</option>`},
+		},
+		{
+			"day view, date",
+			"/dashboard?view=day&date=2020-01-01",
+			http.StatusOK,
+			[]string{`href="?date=2019-12-31&amp;view=day"`, `href="?date=2020-01-02&amp;view=day"`},
+		},
+		{
+			"custom range",
+			"/dashboard?from=2020-01-01&to=2020-01-10",
+			http.StatusOK,
+			[]string{`href="?from=2019-12-22&amp;to=2019-12-31"`, `name="from" value="2020-01-01"`},
+		},
+		{
+			"sensors and metrics",
+			"/dashboard?sensor=livingroom&metric=co2",
+			http.StatusOK,
+			[]string{`value="bedroom"> Bedroom`, `value="co2" checked> CO2`, `value="iaq"> IAQ`},
+		},
+		{
+			"timezone",
+			"/dashboard?tz=America/New_York",
+			http.StatusOK,
+			[]string{`const timeZone = "America/New_York";`, `<input type="hidden" name="tz" value="America/New_York">`},
+		},
+		{
+			"invalid sensor",
+			"/dashboard?sensor=kitchen",
+			http.StatusBadRequest,
+			[]string{"sensor did not pass validation rules: unknown sensor kitchen"},
+		},
+		{
+			"invalid view",
+			"/dashboard?view=decade",
+			http.StatusBadRequest,
+			[]string{},
+		},
+	}
+
+	for _, d := range requests {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				statusCode, _, body := ts.Get(t, d.urlPath)
+				if diff := cmp.Diff(d.expectedCode, statusCode); diff != "" {
+					t.Error(diff)
+				}
+				for _, expected := range d.expectedBody {
+					if !strings.Contains(string(body), expected) {
+						t.Errorf("expected body to contain %q", expected)
+					}
+				}
+			},
+		)
+	}
+}
+
+func Test_shiftPeriod(t *testing.T) {
+	date := func(value string) *time.Time {
+		d, _ := time.Parse(dateFormat, value)
+		return &d
+	}
+
+	data := []struct {
+		name      string
+		q         graphsQuery
+		view      string
+		date      string
+		direction int
+		expected  url.Values
+	}{
+		{"previous day", graphsQuery{}, "day", "2020-03-01", -1, url.Values{"view": {"day"}, "date": {"2020-02-29"}}},
+		{"next week", graphsQuery{}, "week", "2020-12-28", 1, url.Values{"view": {"week"}, "date": {"2021-01-04"}}},
+		{"previous month, end of month", graphsQuery{}, "month", "2020-03-31", -1, url.Values{"view": {"month"}, "date": {"2020-02-29"}}},
+		{"next year, leap day", graphsQuery{}, "year", "2020-02-29", 1, url.Values{"view": {"year"}, "date": {"2021-02-28"}}},
+		{"next range", graphsQuery{From: date("2020-01-01"), To: date("2020-01-07")}, "", "2020-01-01", 1, url.Values{"from": {"2020-01-08"}, "to": {"2020-01-14"}}},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				shifted := shiftPeriod(url.Values{}, d.q, d.view, *date(d.date), d.direction)
+				if diff := cmp.Diff(d.expected, shifted); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/miselaytes-anton/airy/internal/models"
+	"github.com/miselaytes-anton/airy/internal/urlquery"
+)
+
+type deadLettersListQuery struct {
+	From *int64 `validate:"required,gte=0,lte=2147483647"`
+	To   *int64 `validate:"required,gtfield=From,lte=2147483647"`
+}
+
+func parseDeadLettersListQuery(r *http.Request) (*deadLettersListQuery, error) {
+	values := r.URL.Query()
+	from, err := urlquery.ReadInt64FromQuery(values, "from")
+	if err != nil {
+		return nil, err
+	}
+	to, err := urlquery.ReadInt64FromQuery(values, "to")
+	if err != nil {
+		return nil, err
+	}
+	return &deadLettersListQuery{
+		From: from,
+		To:   to,
+	}, nil
+}
+
+func (s *Server) handleDeadLettersList() http.HandlerFunc {
+	validate := validator.New(validator.WithRequiredStructEnabled())
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseDeadLettersListQuery(r)
+		if err != nil {
+			s.jsonError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		err = validate.Struct(q)
+
+		if err != nil {
+			s.jsonValidationError(w, err)
+			return
+		}
+
+		deadLetters, err := s.DeadLetters.GetAll(models.DeadLettersQuery{
+			StartEpoch: *q.From,
+			EndEpoch:   *q.To,
+		})
+		if err != nil {
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(deadLetters)
+		if err != nil {
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+	"github.com/miselaytes-anton/airy/internal/models/mocks"
+	"github.com/miselaytes-anton/airy/internal/testserver"
+)
+
+func Test_handleDeadLettersList(t *testing.T) {
+	deadLetters := []models.DeadLetter{{
+		ID:         "uuid",
+		Topic:      "measurement",
+		Payload:    "bedroom something",
+		Reason:     "message could not be parsed",
+		ReceivedAt: 1,
+	}}
+
+	deadLettersMock := mocks.DeadLetterModelMock{
+		DeadLetters:           deadLetters,
+		GetAllDeadLettersMock: mocks.GetAllDeadLettersOkMock,
+	}
+
+	router := httprouter.New()
+	server := Server{
+		Router:      router,
+		DeadLetters: &deadLettersMock,
+		LogError:    log.New(io.Discard, "", 0),
+		LogInfo:     log.New(io.Discard, "", 0),
+	}
+
+	server.routes()
+
+	ts := testserver.TestServer{Server: httptest.NewServer(router)}
+	defer ts.Server.Close()
+
+	t.Run("valid query", func(t *testing.T) {
+		statusCode, _, body := ts.Get(t, "/api/dead-letters?from=0&to=2")
+
+		if diff := cmp.Diff(http.StatusOK, statusCode); diff != "" {
+			t.Error(diff)
+		}
+
+		var received []models.DeadLetter
+		if err := json.Unmarshal(body, &received); err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(deadLetters, received); diff != "" {
+			t.Error(diff)
+		}
+	})
+
+	invalidRequests := []struct {
+		name                  string
+		urlPath               string
+		expectedCode          int
+		expectedError         ResponseError
+		getAllDeadLettersMock mocks.GetAllDeadLettersMock
+	}{
+		{
+			"invalid from",
+			"/api/dead-letters?from=hello&to=2",
+			http.StatusBadRequest,
+			ResponseError{
+				Status: "Bad Request",
+				Error:  "could not parse 'from', expected an integer, got 'hello'",
+			},
+			mocks.GetAllDeadLettersOkMock,
+		},
+		{
+			"missing to",
+			"/api/dead-letters?from=1",
+			http.StatusBadRequest,
+			ResponseError{
+				Status: "Bad Request",
+				Error:  "to did not pass validation rules: required",
+			},
+			mocks.GetAllDeadLettersOkMock,
+		},
+		{
+			"database error",
+			"/api/dead-letters?from=1&to=2",
+			http.StatusInternalServerError,
+			ResponseError{
+				Status: "Internal Server Error",
+				Error:  "internal server error occured",
+			},
+			mocks.GetAllDeadLettersErrorMock,
+		},
+	}
+
+	for _, d := range invalidRequests {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				deadLettersMock.GetAllDeadLettersMock = d.getAllDeadLettersMock
+
+				statusCode, _, body := ts.Get(t, d.urlPath)
+
+				if diff := cmp.Diff(d.expectedCode, statusCode); diff != "" {
+					t.Error(diff)
+				}
+
+				responseError := new(ResponseError)
+				if err := json.Unmarshal(body, &responseError); err != nil {
+					t.Fatal(err)
+				}
+
+				if diff := cmp.Diff(d.expectedError, *responseError); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
@@ -70,7 +70,7 @@ func (s *Server) handleEventsCreate() http.HandlerFunc {
 	type request struct {
 		StartTimestamp int64  `json:"startTimestamp" validate:"required,gt=0,lte=2147483647"`
 		EndTimestamp   int64  `json:"endTimestamp,omitempty" validate:"omitempty,gtfield=StartTimestamp,lte=2147483647"`
-		LocationID     string `json:"locationId" validate:"required,oneof=bedroom livingroom"`
+		LocationID     string `json:"locationId" validate:"required"`
 		EventType      string `json:"eventType" validate:"required"`
 	}
 
@@ -94,6 +94,10 @@ func (s *Server) handleEventsCreate() http.HandlerFunc {
 			return
 		}
 
+		if !s.checkSensorID(w, "locationId", request.LocationID) {
+			return
+		}
+
 		event := models.Event{
 			StartTimestamp: request.StartTimestamp,
 			EndTimestamp:   request.EndTimestamp,
@@ -128,7 +132,7 @@ func (s *Server) handleEventsUpdate() http.HandlerFunc {
 	type request struct {
 		StartTimestamp *int64  `json:"startTimestamp,omitempty" validate:"omitempty,gt=0,lte=2147483647"`
 		EndTimestamp   *int64  `json:"endTimestamp,omitempty" validate:"omitempty,gt=0,lte=2147483647"`
-		LocationID     *string `json:"locationId,omitempty" validate:"omitempty,oneof=bedroom livingroom"`
+		LocationID     *string `json:"locationId,omitempty" validate:"omitempty"`
 		EventType      *string `json:"eventType,omitempty" validate:"omitempty"`
 	}
 
@@ -150,6 +154,10 @@ func (s *Server) handleEventsUpdate() http.HandlerFunc {
 			return
 		}
 
+		if request.LocationID != nil && !s.checkSensorID(w, "locationId", *request.LocationID) {
+			return
+		}
+
 		params := httprouter.ParamsFromContext(r.Context())
 
 		event, err := s.Events.Get(params.ByName("id"))
@@ -176,10 +176,17 @@ func Test_handleEventsCreate(t *testing.T) {
 		InsertEventMock: mocks.InsertEventOkMock,
 	}
 
+	sensorsMock := mocks.SensorModelMock{
+		Sensors:           []models.Sensor{{ID: "bedroom"}, {ID: "livingroom"}},
+		GetAllSensorsMock: mocks.GetAllSensorsOkMock,
+		GetSensorMock:     mocks.GetSensorOkMock,
+	}
+
 	router := httprouter.New()
 	server := Server{
 		Router:   router,
 		Events:   &eventsMock,
+		Sensors:  &sensorsMock,
 		LogError: log.New(io.Discard, "", 0),
 		LogInfo:  log.New(io.Discard, "", 0),
 	}
@@ -269,6 +276,21 @@ func Test_handleEventsCreate(t *testing.T) {
 			mocks.InsertEventErrorMock,
 			Request{},
 		},
+		{
+			"unknown locationId",
+			"/api/events",
+			http.StatusBadRequest,
+			ResponseError{
+				Status: "Bad Request",
+				Error:  "locationId did not pass validation rules: unknown sensor kitchen",
+			},
+			mocks.InsertEventOkMock,
+			Request{
+				StartTimestamp: 1,
+				LocationID:     "kitchen",
+				EventType:      "window:open",
+			},
+		},
 	}
 
 	for _, d := range invalidRequests {
@@ -316,10 +338,17 @@ func Test_handleEventsUpdate(t *testing.T) {
 		UpdateEventMock: mocks.UpdateEventOkMock,
 	}
 
+	sensorsMock := mocks.SensorModelMock{
+		Sensors:           []models.Sensor{{ID: "bedroom"}, {ID: "livingroom"}},
+		GetAllSensorsMock: mocks.GetAllSensorsOkMock,
+		GetSensorMock:     mocks.GetSensorOkMock,
+	}
+
 	router := httprouter.New()
 	server := Server{
 		Router:   router,
 		Events:   &eventsMock,
+		Sensors:  &sensorsMock,
 		LogError: log.New(io.Discard, "", 0),
 		LogInfo:  log.New(io.Discard, "", 0),
 	}
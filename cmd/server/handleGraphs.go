@@ -1,7 +1,11 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"hash/fnv"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/go-echarts/go-echarts/v2/charts"
@@ -9,60 +13,231 @@ import (
 	"github.com/go-echarts/go-echarts/v2/types"
 	"github.com/go-playground/validator/v10"
 
+	"github.com/miselaytes-anton/airy/internal/comfort"
+	"github.com/miselaytes-anton/airy/internal/config"
 	"github.com/miselaytes-anton/airy/internal/dateutil"
 	"github.com/miselaytes-anton/airy/internal/models"
+	"github.com/miselaytes-anton/airy/internal/plot"
 	"github.com/miselaytes-anton/airy/internal/urlquery"
 )
 
-type valueGetter func(measurement models.Measurement) float64
+type valueGetter func(measurement models.Measurement) (float64, bool)
 type lineItemsPerSensor map[string][]opts.LineData
 type markLinesPerSensor map[string][]opts.MarkLineNameXAxisItem
+type markAreasPerSensor map[string][][]markAreaItem
+type envelopesPerSensor map[string]envelopeItems
 type measurementsPerSensor map[string][]models.Measurement
 type eventsPerSensor map[string][]models.Event
 type viewConfig struct {
-	resolution       int
 	startEpochOffset int64
 	endEpochOffset   int64
 }
 
 var defaultsPerView = map[string]viewConfig{
 	"day": {
-		resolution:       600,
 		startEpochOffset: 23 * 3600,
 		endEpochOffset:   3600 - 1,
 	},
-	"week": {
-		resolution:       3600,
-		startEpochOffset: 24 * 3600 * 7,
-		endEpochOffset:   3600 - 1,
-	},
 }
 
-func generateLineItemsFromMeasurements(measurementsPerSensor measurementsPerSensor, getValue valueGetter) lineItemsPerSensor {
+// markAreaItem is one corner of a shaded area, echarts expects an area as a pair of items.
+// A missing coordinate extends the area to the edge of the chart.
+type markAreaItem struct {
+	Name      string          `json:"name,omitempty"`
+	XAxis     interface{}     `json:"xAxis,omitempty"`
+	YAxis     interface{}     `json:"yAxis,omitempty"`
+	ItemStyle *opts.ItemStyle `json:"itemStyle,omitempty"`
+	Label     *opts.Label     `json:"label,omitempty"`
+}
+
+// envelopeItems are the lowest values and the distance to the highest values,
+// echarts stacks the distance onto the lowest values to shade the band between them.
+type envelopeItems struct {
+	lower []opts.LineData
+	width []opts.LineData
+}
+
+// eventColors are the colors of the event mark areas, events of the same type are always shaded in the same color.
+var eventColors = []string{"#5470c6", "#91cc75", "#fac858", "#ee6666", "#73c0de", "#3ba272", "#fc8452", "#9a60b4", "#ea7ccc"}
+
+// graphMetric is a metric shown as a chart.
+type graphMetric struct {
+	metric string
+	title  string
+}
+
+// value returns the value of the metric, false when the measurement has none.
+func (g graphMetric) value(m models.Measurement) (float64, bool) {
+	return m.Metric(g.metric)
+}
+
+// graphMetrics are the metrics shown by default, in the order of the charts.
+var graphMetrics = []graphMetric{
+	{"co2", "CO2"},
+	{"voc", "VOC"},
+	{"iaq", "IAQ"},
+	{"humidity", "Humidity"},
+	{"temperature", "Temperature"},
+}
+
+// dateFormat is the format of dates in query parameters.
+const dateFormat = "2006-01-02"
+
+// resolutions are the steps a default resolution is picked from, in seconds.
+var resolutions = []int{60, 300, 600, 900, 1800, 3600, 3 * 3600, 6 * 3600, 12 * 3600, 24 * 3600}
+
+// chartTime formats the epoch as wall clock time in the location.
+// The browser shows times with an offset in its own timezone, so the offset is left out,
+// as a consequence the repeated hour overlaps on the day the clocks are set back.
+func chartTime(epoch int64, location *time.Location) string {
+	return time.Unix(epoch, 0).In(location).Format("2006-01-02 15:04:05")
+}
+
+func generateLineItemsFromMeasurements(measurementsPerSensor measurementsPerSensor, getValue valueGetter, location *time.Location) lineItemsPerSensor {
 	items := make(lineItemsPerSensor)
 
 	for sensorID, measurements := range measurementsPerSensor {
 		for _, measurement := range measurements {
-			items[sensorID] = append(items[sensorID], opts.LineData{Value: []interface{}{time.Unix(measurement.Timestamp, 0), getValue(measurement)}})
+			value, ok := getValue(measurement)
+			if !ok {
+				continue
+			}
+			items[sensorID] = append(items[sensorID], opts.LineData{Value: []interface{}{chartTime(measurement.Timestamp, location), value}})
 		}
 	}
 
 	return items
 }
 
-func generateMarkLinesFromEvents(eventsPerSensor eventsPerSensor) markLinesPerSensor {
-	items := make(markLinesPerSensor)
+// generateEnvelopesFromMeasurements returns the bands between the lowest and highest values,
+// measurements without them, i.e. not aggregated as an envelope or without a value of the metric, have no band.
+func generateEnvelopesFromMeasurements(measurementsPerSensor measurementsPerSensor, getValue valueGetter, location *time.Location) envelopesPerSensor {
+	envelopes := make(envelopesPerSensor)
+
+	for sensorID, measurements := range measurementsPerSensor {
+		for _, measurement := range measurements {
+			if measurement.Min == nil || measurement.Max == nil {
+				continue
+			}
+
+			lower, ok := getValue(*measurement.Min)
+			if !ok {
+				continue
+			}
+			upper, ok := getValue(*measurement.Max)
+			if !ok {
+				continue
+			}
+
+			t := chartTime(measurement.Timestamp, location)
+			e := envelopes[sensorID]
+			e.lower = append(e.lower, opts.LineData{Value: []interface{}{t, lower}})
+			e.width = append(e.width, opts.LineData{Value: []interface{}{t, upper - lower}})
+			envelopes[sensorID] = e
+		}
+	}
+
+	return envelopes
+}
+
+func getEventColor(eventType string) string {
+	h := fnv.New32a()
+	h.Write([]byte(eventType))
+
+	return eventColors[h.Sum32()%uint32(len(eventColors))]
+}
+
+// getEventRange returns the time range of the event within startEpoch and endEpoch, events which did not end yet last until now.
+// Events without a duration within the range can not be shaded, false is returned for them.
+func getEventRange(event models.Event, startEpoch int64, endEpoch int64, now int64) (int64, int64, bool) {
+	start := max(event.StartTimestamp, startEpoch)
+	end := event.EndTimestamp
+	if end == 0 {
+		end = now
+	}
+	end = min(end, endEpoch)
+
+	return start, end, end > start
+}
+
+// generateMarkAreasFromEvents shades the time range of every event within startEpoch and endEpoch.
+// Events without a duration can not be shaded, they are marked with a line instead.
+func generateMarkAreasFromEvents(eventsPerSensor eventsPerSensor, markLines markLinesPerSensor, startEpoch int64, endEpoch int64, now int64, location *time.Location) markAreasPerSensor {
+	items := make(markAreasPerSensor)
 
 	for sensorID, events := range eventsPerSensor {
 		for _, event := range events {
-			items[sensorID] = append(items[sensorID], opts.MarkLineNameXAxisItem{Name: event.EventType, XAxis: time.Unix(event.StartTimestamp, 0)})
+			start, end, ok := getEventRange(event, startEpoch, endEpoch, now)
+			if !ok {
+				markLines[sensorID] = append(markLines[sensorID], opts.MarkLineNameXAxisItem{Name: event.EventType, XAxis: chartTime(event.StartTimestamp, location)})
+				continue
+			}
+
+			items[sensorID] = append(items[sensorID], []markAreaItem{
+				{
+					Name:      event.EventType,
+					XAxis:     chartTime(start, location),
+					ItemStyle: &opts.ItemStyle{Color: getEventColor(event.EventType), Opacity: 0.2},
+				},
+				{XAxis: chartTime(end, location)},
+			})
+		}
+	}
+
+	return items
+}
+
+// bandsSeriesName is the name of the series the comfort bands are drawn with.
+const bandsSeriesName = "comfort bands"
+
+// generateMarkAreasFromBands shades the value range of every band across the whole time axis.
+func generateMarkAreasFromBands(bands comfort.Bands) [][]markAreaItem {
+	items := make([][]markAreaItem, 0, len(bands))
+
+	for _, band := range bands {
+		start := markAreaItem{
+			Name:      band.Name,
+			ItemStyle: &opts.ItemStyle{Color: band.Color, Opacity: 0.1},
+			Label:     &opts.Label{Show: true, Position: "insideRight", Formatter: "{b}"},
+		}
+		end := markAreaItem{}
+
+		if band.Min != nil {
+			start.YAxis = *band.Min
 		}
+		if band.Max != nil {
+			end.YAxis = *band.Max
+		}
+
+		items = append(items, []markAreaItem{start, end})
 	}
 
 	return items
 }
 
-func makeChart(items lineItemsPerSensor, markLines markLinesPerSensor, title string, startEpoch int64, endEpoch int64) *charts.Line {
+// withMarkAreas adds the time ranges to a series, go-echarts only supports mark areas spanning the whole x axis.
+func withMarkAreas(markAreas [][]markAreaItem) charts.SeriesOpts {
+	return func(s *charts.SingleSeries) {
+		if s.MarkAreas == nil {
+			s.MarkAreas = &opts.MarkAreas{}
+		}
+		for _, markArea := range markAreas {
+			s.MarkAreas.Data = append(s.MarkAreas.Data, markArea)
+		}
+	}
+}
+
+// generateMarkLinesFromSensors marks the last message of offline sensors, so that a gap in the graph can be told apart from a missing sensor.
+func generateMarkLinesFromSensors(sensors []models.Sensor, markLines markLinesPerSensor, startEpoch int64, endEpoch int64, location *time.Location) {
+	for _, sensor := range sensors {
+		if sensor.Status != models.SensorStatusOffline || sensor.LastSeen < startEpoch || sensor.LastSeen > endEpoch {
+			continue
+		}
+		markLines[sensor.ID] = append(markLines[sensor.ID], opts.MarkLineNameXAxisItem{Name: "offline", XAxis: chartTime(sensor.LastSeen, location)})
+	}
+}
+
+func makeChart(sensors []models.Sensor, items lineItemsPerSensor, envelopes envelopesPerSensor, markLines markLinesPerSensor, markAreas markAreasPerSensor, bands comfort.Bands, title string, startEpoch int64, endEpoch int64, location *time.Location) *charts.Line {
 	// create a new line instance
 	line := charts.NewLine()
 	// set some global options like Title/Legend/ToolTip or anything else
@@ -76,14 +251,23 @@ func makeChart(items lineItemsPerSensor, markLines markLinesPerSensor, title str
 		charts.WithXAxisOpts(opts.XAxis{
 			Name: "Time",
 			Type: "time",
-			Min:  time.Unix(startEpoch, 0),
-			Max:  time.Unix(endEpoch, 0),
+			Min:  chartTime(startEpoch, location),
+			Max:  chartTime(endEpoch, location),
 		}),
 		charts.WithTooltipOpts(opts.Tooltip{Show: true, Trigger: "axis", TriggerOn: "click"}),
 	)
 
+	// series shown in the legend, the bands are not
+	legend := make([]string, 0)
+
 	// Create line graphs for each sensor with keys ordered alphabetically
-	for _, sensorID := range SENSOR_IDS {
+	for _, sensor := range sensors {
+		sensorID := sensor.ID
+		name := sensor.DisplayName
+		if name == "" {
+			name = sensorID
+		}
+
 		seriesOptions := []charts.SeriesOpts{
 			charts.WithLineChartOpts(opts.LineChart{Smooth: true}),
 			charts.WithMarkLineStyleOpts(opts.MarkLineStyle{Symbol: []string{"none"}, Label: &opts.Label{Show: true, Formatter: "{b}"}}),
@@ -91,20 +275,63 @@ func makeChart(items lineItemsPerSensor, markLines markLinesPerSensor, title str
 		for _, markLine := range markLines[sensorID] {
 			seriesOptions = append(seriesOptions, charts.WithMarkLineNameXAxisItemOpts(markLine))
 		}
+		seriesOptions = append(seriesOptions,
+			charts.WithMarkAreaStyleOpts(opts.MarkAreaStyle{Label: &opts.Label{Show: true, Formatter: "{b}"}}),
+			withMarkAreas(markAreas[sensorID]),
+		)
+
+		legend = append(legend, name)
+		// options are passed to AddSeries, SetSeriesOptions would apply them to all series added so far
+		line.AddSeries(name, items[sensorID], seriesOptions...)
+	}
+
+	// envelopes are added after all lines, so that the lines keep the colors of the theme
+	for i, sensor := range sensors {
+		envelope, ok := envelopes[sensor.ID]
+		if !ok {
+			continue
+		}
+
+		name := sensor.DisplayName
+		if name == "" {
+			name = sensor.ID
+		}
+		lineChart := opts.LineChart{Smooth: true, Stack: sensor.ID + "-envelope", Symbol: "none"}
+
+		legend = append(legend, name+" min", name+" range")
+		line.AddSeries(name+" min", envelope.lower,
+			charts.WithLineChartOpts(lineChart),
+			charts.WithLineStyleOpts(opts.LineStyle{Color: "transparent"}),
+		)
+		line.AddSeries(name+" range", envelope.width,
+			charts.WithLineChartOpts(lineChart),
+			charts.WithLineStyleOpts(opts.LineStyle{Color: "transparent"}),
+			charts.WithAreaStyleOpts(opts.AreaStyle{Color: plot.SeriesColor(i), Opacity: 0.2}),
+		)
+	}
 
-		line.AddSeries(sensorID, items[sensorID]).
-			SetSeriesOptions(
-				seriesOptions...,
-			)
+	// bands belong to the chart rather than to a sensor, so they are drawn with an empty series of their own,
+	// which is added last to keep the colors of the theme and left out of the legend so that it can not be toggled
+	if len(bands) > 0 {
+		line.AddSeries(bandsSeriesName, []opts.LineData{}, withMarkAreas(generateMarkAreasFromBands(bands)))
 	}
+	line.SetGlobalOptions(charts.WithLegendOpts(opts.Legend{Show: true, Data: legend}))
 
 	return line
 }
 
 type graphsQuery struct {
-	View       *string `validate:"omitempty,oneof=day week"`
-	Date       *time.Time
-	Resolution *int `validate:"omitempty,gt=0,lte=86400"`
+	View       *string    `validate:"omitempty,oneof=day week month year,excluded_with=From"`
+	Date       *time.Time `validate:"excluded_with=From"`
+	From       *time.Time `validate:"required_with=To"`
+	To         *time.Time `validate:"required_with=From"`
+	Resolution *int       `validate:"omitempty,gt=0,lte=86400"`
+	Timezone   *string    `validate:"omitempty,timezone"`
+	// Aggregation combines the measurements within the resolution, envelope shades the range between the lowest and highest values.
+	Aggregation *string `validate:"omitempty,oneof=avg min max median p95 first last count envelope"`
+	// Sensors and Metrics limit the graphs, all are shown when they are empty.
+	Sensors []string `validate:"dive,required"`
+	Metrics []string `validate:"dive,oneof=co2 voc iaq humidity temperature"`
 }
 
 // parseGraphsQuery parses the query parameters for the graphs endpoint.
@@ -119,21 +346,42 @@ func parseGraphsQuery(r *http.Request) (*graphsQuery, error) {
 		return nil, err
 	}
 
-	date, err := urlquery.ReadDateFromQuery(values, "date", "2006-01-02")
+	date, err := urlquery.ReadDateFromQuery(values, "date", dateFormat)
+
+	if err != nil {
+		return nil, err
+	}
 
+	from, err := urlquery.ReadDateFromQuery(values, "from", dateFormat)
 	if err != nil {
 		return nil, err
 	}
 
+	to, err := urlquery.ReadDateFromQuery(values, "to", dateFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	if from != nil && to != nil && to.Before(*from) {
+		return nil, errors.New("'to' must not be before 'from'")
+	}
+
 	return &graphsQuery{
-		View:       view,
-		Date:       date,
-		Resolution: resolution,
+		View:        view,
+		Date:        date,
+		From:        from,
+		To:          to,
+		Resolution:  resolution,
+		Timezone:    urlquery.ReadStringFromQuery(values, "tz"),
+		Aggregation: urlquery.ReadStringFromQuery(values, "agg"),
+		Sensors:     values["sensor"],
+		Metrics:     values["metric"],
 	}, nil
 }
 
 // getEpochs returns the start and end epoch for the given date and view.
-func getEpochs(date time.Time, view string, now time.Time, location time.Location) (int64, int64) {
+// Calendar days are taken in the location, so they may be 23 or 25 hours long.
+func getEpochs(date time.Time, view string, now time.Time, location *time.Location) (int64, int64) {
 	var startEpoch, endEpoch int64
 
 	switch view {
@@ -144,27 +392,50 @@ func getEpochs(date time.Time, view string, now time.Time, location time.Locatio
 			endEpoch = now.Unix() + defaultsPerView["day"].endEpochOffset
 		} else {
 			// Show calendar day.
-			startEpoch = dateutil.GetStartOfDay(date, &location).Unix()
-			endEpoch = dateutil.GetEndOfDay(date, &location).Unix()
+			startEpoch = dateutil.GetStartOfDay(date, location).Unix()
+			endEpoch = dateutil.GetEndOfDay(date, location).Unix()
 		}
 	case "week":
-		// Show last 7 calendar days before the date and 1 hour after.
-		startEpoch = dateutil.GetStartOfDay(date, &location).Unix() - defaultsPerView["week"].startEpochOffset
-		endEpoch = dateutil.GetEndOfDay(date, &location).Unix()
+		// Show last 7 calendar days before the date and the date itself.
+		startEpoch = dateutil.AddDate(date, 0, 0, -7, location).Unix()
+		endEpoch = dateutil.GetEndOfDay(date, location).Unix()
+	case "month":
+		startEpoch = dateutil.AddDate(date, 0, -1, 0, location).Unix()
+		endEpoch = dateutil.GetEndOfDay(date, location).Unix()
+	case "year":
+		startEpoch = dateutil.AddDate(date, -1, 0, 0, location).Unix()
+		endEpoch = dateutil.GetEndOfDay(date, location).Unix()
 	}
 
 	return startEpoch, endEpoch
 }
 
+// getDefaultResolution returns the smallest of the resolutions which shows the span with at most maxPoints points,
+// longer spans are shown in whole days.
+func getDefaultResolution(startEpoch int64, endEpoch int64, maxPoints int) int {
+	span := endEpoch - startEpoch + 1
+
+	for _, resolution := range resolutions {
+		if span <= int64(resolution*maxPoints) {
+			return resolution
+		}
+	}
+
+	maxSpan := int64(24 * 3600 * maxPoints)
+	days := (span + maxSpan - 1) / maxSpan
+
+	return int(days) * 24 * 3600
+}
+
 // makeModelsQueries returns the models.MeasurementsQuery and models.EventsQuery for the given graphsQuery.
-func makeModelsQueries(q graphsQuery, now time.Time, location time.Location) (models.MeasurementsQuery, models.EventsQuery) {
+func makeModelsQueries(q graphsQuery, sensorIDs []string, now time.Time, location *time.Location, views config.ViewsConfig) (models.MeasurementsQuery, models.EventsQuery) {
 	var startEpoch, endEpoch int64
 	var view string
 	var date time.Time
 	var resolution int
 
 	if q.View == nil {
-		view = "day"
+		view = views.Default
 	} else {
 		view = *q.View
 	}
@@ -175,26 +446,41 @@ func makeModelsQueries(q graphsQuery, now time.Time, location time.Location) (mo
 		date = *q.Date
 	}
 
+	if q.From != nil && q.To != nil {
+		// Show the calendar days from and to, both included.
+		startEpoch = dateutil.GetStartOfDay(*q.From, location).Unix()
+		endEpoch = dateutil.GetEndOfDay(*q.To, location).Unix()
+	} else {
+		startEpoch, endEpoch = getEpochs(date, view, now, location)
+	}
+
 	if q.Resolution == nil {
-		resolution = defaultsPerView[view].resolution
+		resolution = getDefaultResolution(startEpoch, endEpoch, views.MaxPoints)
 	} else {
 		resolution = *q.Resolution
 	}
 
-	startEpoch, endEpoch = getEpochs(date, view, now, location)
+	var aggregation models.Aggregation
+	if q.Aggregation != nil {
+		aggregation = models.Aggregation(*q.Aggregation)
+	}
 
 	return models.MeasurementsQuery{
-			StartEpoch: startEpoch,
-			EndEpoch:   endEpoch,
-			Resolution: resolution,
-			SensorIDs:  SENSOR_IDS,
-		}, models.EventsQuery{
-			StartEpoch: startEpoch,
-			EndEpoch:   endEpoch,
-		}
+		StartEpoch:  startEpoch,
+		EndEpoch:    endEpoch,
+		Resolution:  resolution,
+		SensorIDs:   sensorIDs,
+		Aggregation: aggregation,
+	}, models.EventsQuery{
+		StartEpoch: startEpoch,
+		EndEpoch:   endEpoch,
+	}
 }
 
-func renderGraphs(w http.ResponseWriter, measurements []models.Measurement, events []models.Event, startEpoch int64, endEpoch int64) {
+// makeCharts returns a chart for every metric, sensors are drawn in their order.
+func makeCharts(sensors []models.Sensor, measurements []models.Measurement, events []models.Event, bands comfort.Bands, metrics []graphMetric, startEpoch int64, endEpoch int64, now time.Time) []*charts.Line {
+	location := now.Location()
+
 	measurementsPerSensor := make(measurementsPerSensor)
 
 	for _, measurement := range measurements {
@@ -205,72 +491,149 @@ func renderGraphs(w http.ResponseWriter, measurements []models.Measurement, even
 	for _, event := range events {
 		eventsPerSensor[event.LocationID] = append(eventsPerSensor[event.LocationID], event)
 	}
-	markLinesPerSensor := generateMarkLinesFromEvents(eventsPerSensor)
+	markLinesPerSensor := make(markLinesPerSensor)
+	markAreasPerSensor := generateMarkAreasFromEvents(eventsPerSensor, markLinesPerSensor, startEpoch, endEpoch, now.Unix(), location)
+	generateMarkLinesFromSensors(sensors, markLinesPerSensor, startEpoch, endEpoch, location)
+
+	lines := make([]*charts.Line, 0, len(metrics))
+	for _, m := range metrics {
+		lineItems := generateLineItemsFromMeasurements(measurementsPerSensor, m.value, location)
+		envelopes := generateEnvelopesFromMeasurements(measurementsPerSensor, m.value, location)
+		lines = append(lines, makeChart(sensors, lineItems, envelopes, markLinesPerSensor, markAreasPerSensor, bands.Metric(m.metric), m.title, startEpoch, endEpoch, location))
+	}
 
-	co2LineItems := generateLineItemsFromMeasurements(measurementsPerSensor, func(m models.Measurement) float64 { return m.CO2 })
-	co2Chart := makeChart(co2LineItems, markLinesPerSensor, "CO2", startEpoch, endEpoch)
-	co2Chart.Render(w)
+	return lines
+}
 
-	vocLineItems := generateLineItemsFromMeasurements(measurementsPerSensor, func(m models.Measurement) float64 { return m.VOC })
-	vocChart := makeChart(vocLineItems, markLinesPerSensor, "VOC", startEpoch, endEpoch)
-	vocChart.Render(w)
+// selectGraphMetrics returns the graph metrics with the given names, all of them when no names are given.
+func selectGraphMetrics(names []string) []graphMetric {
+	if len(names) == 0 {
+		return graphMetrics
+	}
 
-	iaqLineItems := generateLineItemsFromMeasurements(measurementsPerSensor, func(m models.Measurement) float64 { return m.IAQ })
-	iaqChart := makeChart(iaqLineItems, markLinesPerSensor, "IAQ", startEpoch, endEpoch)
-	iaqChart.Render(w)
+	selected := make([]graphMetric, 0, len(names))
+	for _, m := range graphMetrics {
+		for _, name := range names {
+			if m.metric == name {
+				selected = append(selected, m)
+				break
+			}
+		}
+	}
 
-	humidityLineItems := generateLineItemsFromMeasurements(measurementsPerSensor, func(m models.Measurement) float64 { return m.Humidity })
-	humidityChart := makeChart(humidityLineItems, markLinesPerSensor, "Humidity", startEpoch, endEpoch)
-	humidityChart.Render(w)
+	return selected
+}
 
-	temperatureLineItems := generateLineItemsFromMeasurements(measurementsPerSensor, func(m models.Measurement) float64 { return m.Temperature })
-	temperatureChart := makeChart(temperatureLineItems, markLinesPerSensor, "Temperature", startEpoch, endEpoch)
-	temperatureChart.Render(w)
+// graphs is the data shown by the graphs and the dashboard.
+type graphs struct {
+	query        graphsQuery
+	sensors      []models.Sensor
+	measurements []models.Measurement
+	events       []models.Event
+	// allSensors are all registered sensors, sensors is limited to the requested ones.
+	allSensors []models.Sensor
+	startEpoch int64
+	endEpoch   int64
+	resolution int
+	now        time.Time
 }
 
-func (s *Server) handleGraphs() http.HandlerFunc {
+// charts returns the charts of the requested metrics.
+func (g graphs) charts(bands comfort.Bands) []*charts.Line {
+	return makeCharts(g.sensors, g.measurements, g.events, bands, selectGraphMetrics(g.query.Metrics), g.startEpoch, g.endEpoch, g.now)
+}
 
-	validate := validator.New(validator.WithRequiredStructEnabled())
+// loadGraphs parses the graphs query parameters and loads the data to show, errors are responded and false is returned.
+func (s *Server) loadGraphs(w http.ResponseWriter, r *http.Request, validate *validator.Validate) (graphs, bool) {
+	graphsQuery, err := parseGraphsQuery(r)
+	if err != nil {
+		s.jsonError(w, err, http.StatusBadRequest)
+		return graphs{}, false
+	}
 
-	// todo: preload
-	amsterdam, loadLocationErr := time.LoadLocation("Europe/Amsterdam")
+	err = validate.Struct(graphsQuery)
 
-	return func(w http.ResponseWriter, r *http.Request) {
-		if loadLocationErr != nil {
-			s.jsonError(w, loadLocationErr, http.StatusInternalServerError)
-			return
-		}
-
-		var now = time.Now().In(amsterdam)
+	if err != nil {
+		s.jsonValidationError(w, err)
+		return graphs{}, false
+	}
 
-		graphsQuery, err := parseGraphsQuery(r)
+	location := s.Location
+	if graphsQuery.Timezone != nil {
+		// the timezone is already validated against the timezone database
+		location, err = time.LoadLocation(*graphsQuery.Timezone)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+			s.jsonError(w, err, http.StatusBadRequest)
+			return graphs{}, false
 		}
+	}
 
-		err = validate.Struct(graphsQuery)
+	var now = time.Now().In(location)
 
-		if err != nil {
-			s.jsonValidationError(w, err)
-			return
-		}
+	allSensors, err := s.Sensors.GetAll()
+	if err != nil {
+		s.jsonError(w, err, http.StatusInternalServerError)
+		return graphs{}, false
+	}
 
-		measurementsQuery, eventsQuery := makeModelsQueries(*graphsQuery, now, *amsterdam)
+	sensors := make([]models.Sensor, 0, len(allSensors))
+	sensorIDs := make([]string, 0, len(allSensors))
+	for i, sensor := range allSensors {
+		allSensors[i].Status = sensorStatus(sensor, s.OfflineAfter, now)
+		if len(graphsQuery.Sensors) > 0 && !slices.Contains(graphsQuery.Sensors, sensor.ID) {
+			continue
+		}
+		sensorIDs = append(sensorIDs, sensor.ID)
+		sensors = append(sensors, allSensors[i])
+	}
 
-		measurements, err := s.Measurements.GetMeasurements(measurementsQuery)
-		if err != nil {
-			s.jsonError(w, err, http.StatusInternalServerError)
-			return
+	for _, sensorID := range graphsQuery.Sensors {
+		if !slices.Contains(sensorIDs, sensorID) {
+			s.jsonError(w, fmt.Errorf("sensor did not pass validation rules: unknown sensor %s", sensorID), http.StatusBadRequest)
+			return graphs{}, false
 		}
+	}
 
-		events, err := s.Events.GetAll(eventsQuery)
+	measurementsQuery, eventsQuery := makeModelsQueries(*graphsQuery, sensorIDs, now, location, s.Views)
 
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+	measurements, err := s.Measurements.GetMeasurements(measurementsQuery)
+	if err != nil {
+		s.jsonError(w, err, http.StatusInternalServerError)
+		return graphs{}, false
+	}
+
+	events, err := s.Events.GetAll(eventsQuery)
+
+	if err != nil {
+		s.jsonError(w, err, http.StatusInternalServerError)
+		return graphs{}, false
+	}
+
+	return graphs{
+		query:        *graphsQuery,
+		sensors:      sensors,
+		measurements: measurements,
+		events:       events,
+		allSensors:   allSensors,
+		startEpoch:   measurementsQuery.StartEpoch,
+		endEpoch:     measurementsQuery.EndEpoch,
+		resolution:   measurementsQuery.Resolution,
+		now:          now,
+	}, true
+}
+
+func (s *Server) handleGraphs() http.HandlerFunc {
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, ok := s.loadGraphs(w, r, validate)
+		if !ok {
 			return
 		}
 
-		renderGraphs(w, measurements, events, measurementsQuery.StartEpoch, measurementsQuery.EndEpoch)
+		for _, chart := range data.charts(s.Bands) {
+			chart.Render(w)
+		}
 	}
 }
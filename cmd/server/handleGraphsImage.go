@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/miselaytes-anton/airy/internal/comfort"
+	"github.com/miselaytes-anton/airy/internal/models"
+	"github.com/miselaytes-anton/airy/internal/plot"
+	"github.com/miselaytes-anton/airy/internal/urlquery"
+)
+
+// imageContentTypes are the content types of the supported image formats.
+var imageContentTypes = map[string]string{
+	".svg": "image/svg+xml",
+	".png": "image/png",
+}
+
+type graphsImageQuery struct {
+	Width  *int `validate:"omitempty,gte=200,lte=4000"`
+	Height *int `validate:"omitempty,gte=100,lte=4000"`
+}
+
+// makePlotChart returns the chart of a single metric, drawn the same way as the browser charts.
+func makePlotChart(data graphs, m graphMetric, bands comfort.Bands, width int, height int) plot.Chart {
+	chart := plot.Chart{
+		Title:    m.title,
+		Width:    width,
+		Height:   height,
+		Start:    data.startEpoch,
+		End:      data.endEpoch,
+		Location: data.now.Location(),
+	}
+
+	measurementsPerSensor := make(measurementsPerSensor)
+	for _, measurement := range data.measurements {
+		measurementsPerSensor[measurement.SensorID] = append(measurementsPerSensor[measurement.SensorID], measurement)
+	}
+
+	for _, sensor := range data.sensors {
+		name := sensor.DisplayName
+		if name == "" {
+			name = sensor.ID
+		}
+
+		series := plot.Series{Name: name}
+		for _, measurement := range measurementsPerSensor[sensor.ID] {
+			if value, ok := m.value(measurement); ok {
+				series.Points = append(series.Points, plot.Point{Epoch: measurement.Timestamp, Value: value})
+			}
+			// the range is shaded like on the browser charts when measurements are aggregated as an envelope
+			if measurement.Min == nil || measurement.Max == nil {
+				continue
+			}
+			lower, lowerOk := m.value(*measurement.Min)
+			upper, upperOk := m.value(*measurement.Max)
+			if lowerOk && upperOk {
+				series.Envelope = append(series.Envelope, plot.Range{Epoch: measurement.Timestamp, Min: lower, Max: upper})
+			}
+		}
+		chart.Series = append(chart.Series, series)
+	}
+
+	for _, event := range data.events {
+		// events are shown with the sensor of their location, like on the browser charts
+		if !slices.ContainsFunc(data.sensors, func(sensor models.Sensor) bool { return sensor.ID == event.LocationID }) {
+			continue
+		}
+
+		start, end, ok := getEventRange(event, data.startEpoch, data.endEpoch, data.now.Unix())
+		if !ok {
+			chart.Markers = append(chart.Markers, plot.Marker{Name: event.EventType, Epoch: event.StartTimestamp})
+			continue
+		}
+		chart.Areas = append(chart.Areas, plot.Area{Name: event.EventType, Color: getEventColor(event.EventType), Start: start, End: end})
+	}
+
+	for _, sensor := range data.sensors {
+		if sensor.Status == models.SensorStatusOffline {
+			chart.Markers = append(chart.Markers, plot.Marker{Name: "offline", Epoch: sensor.LastSeen})
+		}
+	}
+
+	for _, band := range bands.Metric(m.metric) {
+		chart.Bands = append(chart.Bands, plot.Band{Name: band.Name, Color: band.Color, Min: band.Min, Max: band.Max})
+	}
+
+	return chart
+}
+
+func (s *Server) handleGraphsImage() http.HandlerFunc {
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		image := params.ByName("image")
+		format := path.Ext(image)
+
+		contentType, ok := imageContentTypes[format]
+		if !ok {
+			s.jsonError(w, fmt.Errorf("unknown image format %q, expected .svg or .png", format), http.StatusNotFound)
+			return
+		}
+
+		metrics := selectGraphMetrics([]string{strings.TrimSuffix(image, format)})
+		if len(metrics) == 0 {
+			s.jsonError(w, fmt.Errorf("unknown metric %q", strings.TrimSuffix(image, format)), http.StatusNotFound)
+			return
+		}
+
+		values := r.URL.Query()
+		var q graphsImageQuery
+		var err error
+
+		if q.Width, err = urlquery.ReadIntFromQuery(values, "width"); err != nil {
+			s.jsonError(w, err, http.StatusBadRequest)
+			return
+		}
+		if q.Height, err = urlquery.ReadIntFromQuery(values, "height"); err != nil {
+			s.jsonError(w, err, http.StatusBadRequest)
+			return
+		}
+		if err := validate.Struct(q); err != nil {
+			s.jsonValidationError(w, err)
+			return
+		}
+
+		width, height := 800, 400
+		if q.Width != nil {
+			width = *q.Width
+		}
+		if q.Height != nil {
+			height = *q.Height
+		}
+
+		data, ok := s.loadGraphs(w, r, validate)
+		if !ok {
+			return
+		}
+
+		chart := makePlotChart(data, metrics[0], s.Bands, width, height)
+
+		var buf bytes.Buffer
+		if format == ".svg" {
+			err = chart.SVG(&buf)
+		} else {
+			err = chart.PNG(&buf)
+		}
+		if err != nil {
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		buf.WriteTo(w)
+	}
+}
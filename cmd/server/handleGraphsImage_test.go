@@ -0,0 +1,130 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/miselaytes-anton/airy/internal/comfort"
+	"github.com/miselaytes-anton/airy/internal/config"
+	"github.com/miselaytes-anton/airy/internal/models"
+	"github.com/miselaytes-anton/airy/internal/models/mocks"
+	"github.com/miselaytes-anton/airy/internal/plot"
+	"github.com/miselaytes-anton/airy/internal/testserver"
+)
+
+func Test_handleGraphsImage(t *testing.T) {
+	eventsMock := mocks.EventModelMock{
+		Events:     []models.Event{{StartTimestamp: 1, LocationID: "bedroom", EventType: "window:open"}},
+		GetAllMock: mocks.GetAllEventsOkMock,
+	}
+
+	measurementsMock := mocks.MeasurementModelMock{
+		Measurements:        []models.Measurement{{Timestamp: 1, SensorID: "bedroom", IAQ: 150, CO2: 900}},
+		GetMeasurementsMock: mocks.GetMeasurementsOkMock,
+	}
+
+	sensorsMock := mocks.SensorModelMock{
+		Sensors:           []models.Sensor{{ID: "bedroom", DisplayName: "Bedroom", LastSeen: time.Now().Unix()}},
+		GetAllSensorsMock: mocks.GetAllSensorsOkMock,
+		GetSensorMock:     mocks.GetSensorOkMock,
+	}
+
+	router := httprouter.New()
+	server := Server{
+		Router:       router,
+		Events:       &eventsMock,
+		Measurements: &measurementsMock,
+		Sensors:      &sensorsMock,
+		OfflineAfter: 5 * time.Minute,
+		Location:     time.UTC,
+		Views:        config.Default().Views,
+		Bands:        comfort.Default(),
+		LogError:     log.New(io.Discard, "", 0),
+		LogInfo:      log.New(io.Discard, "", 0),
+	}
+
+	server.routes()
+
+	ts := testserver.TestServer{Server: httptest.NewServer(router)}
+	defer ts.Server.Close()
+
+	requests := []struct {
+		name                string
+		urlPath             string
+		expectedCode        int
+		expectedContentType string
+	}{
+		{"svg", "/api/graphs/co2.svg", http.StatusOK, "image/svg+xml"},
+		{"png", "/api/graphs/iaq.png?view=week&date=2020-01-01&sensor=bedroom", http.StatusOK, "image/png"},
+		{"size", "/api/graphs/humidity.png?width=400&height=200", http.StatusOK, "image/png"},
+		{"unknown metric", "/api/graphs/pressure.svg", http.StatusNotFound, "application/json; charset=utf-8"},
+		{"unknown format", "/api/graphs/co2.gif", http.StatusNotFound, "application/json; charset=utf-8"},
+		{"invalid width", "/api/graphs/co2.svg?width=10", http.StatusBadRequest, "application/json; charset=utf-8"},
+		{"invalid height", "/api/graphs/co2.svg?height=tall", http.StatusBadRequest, "application/json; charset=utf-8"},
+		{"invalid view", "/api/graphs/co2.svg?view=decade", http.StatusBadRequest, "application/json; charset=utf-8"},
+	}
+
+	for _, d := range requests {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				statusCode, header, _ := ts.Get(t, d.urlPath)
+				if diff := cmp.Diff([]interface{}{d.expectedCode, d.expectedContentType}, []interface{}{statusCode, header.Get("Content-Type")}); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
+
+func Test_makePlotChart(t *testing.T) {
+	data := graphs{
+		sensors: []models.Sensor{
+			{ID: "bedroom", DisplayName: "Bedroom", Status: models.SensorStatusOnline},
+			{ID: "livingroom", LastSeen: 150, Status: models.SensorStatusOffline},
+		},
+		measurements: []models.Measurement{
+			{Timestamp: 100, SensorID: "bedroom", CO2: 900, Min: &models.Measurement{CO2: 800}, Max: &models.Measurement{CO2: 1100}},
+			{Timestamp: 100, SensorID: "livingroom", CO2: 500},
+		},
+		events: []models.Event{
+			{StartTimestamp: 50, EndTimestamp: 150, LocationID: "bedroom", EventType: "window:open"},
+			{StartTimestamp: 120, EndTimestamp: 120, LocationID: "livingroom", EventType: "door:open"},
+			{StartTimestamp: 120, LocationID: "kitchen", EventType: "heating:on"},
+		},
+		startEpoch: 100,
+		endEpoch:   200,
+		now:        time.Unix(300, 0).UTC(),
+	}
+
+	chart := makePlotChart(data, graphMetrics[0], comfort.Default(), 800, 400)
+
+	expected := plot.Chart{
+		Title:    "CO2",
+		Width:    800,
+		Height:   400,
+		Start:    100,
+		End:      200,
+		Location: time.UTC,
+		Series: []plot.Series{
+			{Name: "Bedroom", Points: []plot.Point{{Epoch: 100, Value: 900}}, Envelope: []plot.Range{{Epoch: 100, Min: 800, Max: 1100}}},
+			{Name: "livingroom", Points: []plot.Point{{Epoch: 100, Value: 500}}},
+		},
+		Areas:   []plot.Area{{Name: "window:open", Color: getEventColor("window:open"), Start: 100, End: 150}},
+		Markers: []plot.Marker{{Name: "door:open", Epoch: 120}, {Name: "offline", Epoch: 150}},
+	}
+	for _, band := range comfort.Default().Metric("co2") {
+		expected.Bands = append(expected.Bands, plot.Band{Name: band.Name, Color: band.Color, Min: band.Min, Max: band.Max})
+	}
+
+	if diff := cmp.Diff(expected, chart, cmp.Comparer(func(a, b *time.Location) bool { return a.String() == b.String() })); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -6,10 +6,14 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/go-echarts/go-echarts/v2/opts"
 	"github.com/google/go-cmp/cmp"
 	"github.com/julienschmidt/httprouter"
 
+	"github.com/miselaytes-anton/airy/internal/comfort"
+	"github.com/miselaytes-anton/airy/internal/config"
 	"github.com/miselaytes-anton/airy/internal/models"
 	"github.com/miselaytes-anton/airy/internal/models/mocks"
 	"github.com/miselaytes-anton/airy/internal/testserver"
@@ -43,11 +47,24 @@ func Test_handleGraphs(t *testing.T) {
 		GetMeasurementsMock: mocks.GetMeasurementsOkMock,
 	}
 
+	sensorsMock := mocks.SensorModelMock{
+		Sensors: []models.Sensor{
+			{ID: "bedroom", DisplayName: "Bedroom", LastSeen: time.Now().Unix(), Status: models.SensorStatusOnline},
+			{ID: "livingroom", LastSeen: time.Now().Unix() - 3600, Status: models.SensorStatusOffline},
+		},
+		GetAllSensorsMock: mocks.GetAllSensorsOkMock,
+		GetSensorMock:     mocks.GetSensorOkMock,
+	}
+
 	router := httprouter.New()
 	server := Server{
 		Router:       router,
 		Events:       &eventsMock,
 		Measurements: &measurementsMock,
+		Sensors:      &sensorsMock,
+		OfflineAfter: 5 * time.Minute,
+		Location:     time.UTC,
+		Views:        config.Default().Views,
 		LogError:     log.New(io.Discard, "", 0),
 		LogInfo:      log.New(io.Discard, "", 0),
 	}
@@ -97,9 +114,89 @@ func Test_handleGraphs(t *testing.T) {
 			"/api/graphs?view=week&date=2020-01-01&resolution=86400",
 			http.StatusOK,
 		},
+		{
+			"timezone",
+			"/api/graphs?view=week&date=2023-03-26&tz=America/New_York",
+			http.StatusOK,
+		},
+		{
+			"invalid timezone",
+			"/api/graphs?tz=Mars/Olympus",
+			http.StatusBadRequest,
+		},
+		{
+			"month view, date",
+			"/api/graphs?view=month&date=2020-03-31",
+			http.StatusOK,
+		},
+		{
+			"year view",
+			"/api/graphs?view=year",
+			http.StatusOK,
+		},
+		{
+			"custom range",
+			"/api/graphs?from=2020-01-01&to=2020-03-31",
+			http.StatusOK,
+		},
+		{
+			"custom range, single day",
+			"/api/graphs?from=2020-01-01&to=2020-01-01&resolution=60",
+			http.StatusOK,
+		},
+		{
+			"sensors and metrics",
+			"/api/graphs?sensor=bedroom&sensor=livingroom&metric=co2&metric=humidity",
+			http.StatusOK,
+		},
+		{
+			"envelope",
+			"/api/graphs?agg=envelope",
+			http.StatusOK,
+		},
+		{
+			"invalid aggregation",
+			"/api/graphs?agg=mode",
+			http.StatusBadRequest,
+		},
+		{
+			"invalid sensor",
+			"/api/graphs?sensor=kitchen",
+			http.StatusBadRequest,
+		},
+		{
+			"invalid metric",
+			"/api/graphs?metric=pressure",
+			http.StatusBadRequest,
+		},
 		{
 			"invalid view",
-			"/api/graphs?view=month",
+			"/api/graphs?view=decade",
+			http.StatusBadRequest,
+		},
+		{
+			"invalid range:to before from",
+			"/api/graphs?from=2020-03-31&to=2020-01-01",
+			http.StatusBadRequest,
+		},
+		{
+			"invalid range:from only",
+			"/api/graphs?from=2020-01-01",
+			http.StatusBadRequest,
+		},
+		{
+			"invalid range:to only",
+			"/api/graphs?to=2020-01-01",
+			http.StatusBadRequest,
+		},
+		{
+			"invalid range:with view",
+			"/api/graphs?view=week&from=2020-01-01&to=2020-03-31",
+			http.StatusBadRequest,
+		},
+		{
+			"invalid range:with date",
+			"/api/graphs?date=2020-01-01&from=2020-01-01&to=2020-03-31",
 			http.StatusBadRequest,
 		},
 		{
@@ -128,11 +225,293 @@ func Test_handleGraphs(t *testing.T) {
 		t.Run(
 			d.name,
 			func(t *testing.T) {
-				statusCode, _, _ := ts.Get(t, d.urlPath)
+				statusCode, header, _ := ts.Get(t, d.urlPath)
 				if diff := cmp.Diff(d.expectedCode, statusCode); diff != "" {
 					t.Error(diff)
 				}
+				if statusCode != http.StatusOK {
+					if diff := cmp.Diff("application/json; charset=utf-8", header.Get("Content-Type")); diff != "" {
+						t.Error(diff)
+					}
+				}
 			},
 		)
 	}
 }
+
+func Test_generateMarkLinesFromSensors(t *testing.T) {
+	sensors := []models.Sensor{
+		{ID: "bedroom", LastSeen: 150, Status: models.SensorStatusOnline},
+		{ID: "hallway", LastSeen: 50, Status: models.SensorStatusOffline},
+		{ID: "livingroom", LastSeen: 150, Status: models.SensorStatusOffline},
+	}
+
+	markLines := make(markLinesPerSensor)
+	generateMarkLinesFromSensors(sensors, markLines, 100, 200, time.UTC)
+
+	expected := markLinesPerSensor{
+		"livingroom": {{Name: "offline", XAxis: "1970-01-01 00:02:30"}},
+	}
+	if diff := cmp.Diff(expected, markLines); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_getEpochs(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2023, 4, 2, 10, 0, 0, 0, amsterdam)
+
+	data := []struct {
+		name          string
+		date          time.Time
+		view          string
+		expectedStart string
+		expectedEnd   string
+	}{
+		{
+			"day view, today",
+			now,
+			"day",
+			"2023-04-01T11:00:00+02:00",
+			"2023-04-02T10:59:59+02:00",
+		},
+		{
+			"day view, clocks set forward",
+			time.Date(2023, 3, 26, 0, 0, 0, 0, time.UTC),
+			"day",
+			"2023-03-26T00:00:00+01:00",
+			"2023-03-26T23:59:59+02:00",
+		},
+		{
+			"week view across clocks set forward",
+			now,
+			"week",
+			"2023-03-26T00:00:00+01:00",
+			"2023-04-02T23:59:59+02:00",
+		},
+		{
+			"month view",
+			now,
+			"month",
+			"2023-03-02T00:00:00+01:00",
+			"2023-04-02T23:59:59+02:00",
+		},
+		{
+			"year view",
+			now,
+			"year",
+			"2022-04-02T00:00:00+02:00",
+			"2023-04-02T23:59:59+02:00",
+		},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				startEpoch, endEpoch := getEpochs(d.date, d.view, now, amsterdam)
+
+				actual := []string{
+					time.Unix(startEpoch, 0).In(amsterdam).Format(time.RFC3339),
+					time.Unix(endEpoch, 0).In(amsterdam).Format(time.RFC3339),
+				}
+				if diff := cmp.Diff([]string{d.expectedStart, d.expectedEnd}, actual); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
+
+func Test_getDefaultResolution(t *testing.T) {
+	data := []struct {
+		name     string
+		span     int64
+		expected int
+	}{
+		{"hour", 3600, 60},
+		{"day", 24 * 3600, 600},
+		{"week", 8 * 24 * 3600, 3600},
+		{"month", 32 * 24 * 3600, 6 * 3600},
+		{"year", 366 * 24 * 3600, 2 * 24 * 3600},
+		{"custom range", 3 * 365 * 24 * 3600, 6 * 24 * 3600},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				actual := getDefaultResolution(1000, 1000+d.span-1, config.Default().Views.MaxPoints)
+				if diff := cmp.Diff(d.expected, actual); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
+
+func Test_generateMarkAreasFromEvents(t *testing.T) {
+	events := eventsPerSensor{
+		"bedroom": {
+			{StartTimestamp: 50, EndTimestamp: 150, EventType: "window:open"},
+			{StartTimestamp: 160, EventType: "heating:on"},
+		},
+		"livingroom": {
+			{StartTimestamp: 120, EndTimestamp: 120, EventType: "window:open"},
+			{StartTimestamp: 130, EndTimestamp: 250, EventType: "window:open"},
+		},
+	}
+
+	markLines := make(markLinesPerSensor)
+	markAreas := generateMarkAreasFromEvents(events, markLines, 100, 200, 180, time.UTC)
+
+	windowStyle := &opts.ItemStyle{Color: getEventColor("window:open"), Opacity: 0.2}
+	heatingStyle := &opts.ItemStyle{Color: getEventColor("heating:on"), Opacity: 0.2}
+
+	expectedAreas := markAreasPerSensor{
+		"bedroom": {
+			{{Name: "window:open", XAxis: "1970-01-01 00:01:40", ItemStyle: windowStyle}, {XAxis: "1970-01-01 00:02:30"}},
+			{{Name: "heating:on", XAxis: "1970-01-01 00:02:40", ItemStyle: heatingStyle}, {XAxis: "1970-01-01 00:03:00"}},
+		},
+		"livingroom": {
+			{{Name: "window:open", XAxis: "1970-01-01 00:02:10", ItemStyle: windowStyle}, {XAxis: "1970-01-01 00:03:20"}},
+		},
+	}
+	if diff := cmp.Diff(expectedAreas, markAreas); diff != "" {
+		t.Error(diff)
+	}
+
+	expectedLines := markLinesPerSensor{
+		"livingroom": {{Name: "window:open", XAxis: "1970-01-01 00:02:00"}},
+	}
+	if diff := cmp.Diff(expectedLines, markLines); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_generateEnvelopesFromMeasurements(t *testing.T) {
+	measurements := measurementsPerSensor{
+		"bedroom": {
+			{Timestamp: 60, SensorID: "bedroom", CO2: 700, Min: &models.Measurement{CO2: 400}, Max: &models.Measurement{CO2: 1100}},
+		},
+		"livingroom": {
+			{Timestamp: 60, SensorID: "livingroom", CO2: 500},
+		},
+		"kitchen": {
+			{Timestamp: 60, SensorID: "kitchen", Missing: []string{"co2"}, Min: &models.Measurement{Missing: []string{"co2"}}, Max: &models.Measurement{Missing: []string{"co2"}}},
+		},
+	}
+
+	expected := envelopesPerSensor{
+		"bedroom": {
+			lower: []opts.LineData{{Value: []interface{}{"1970-01-01 00:01:00", 400.0}}},
+			width: []opts.LineData{{Value: []interface{}{"1970-01-01 00:01:00", 700.0}}},
+		},
+	}
+	envelopes := generateEnvelopesFromMeasurements(measurements, graphMetrics[0].value, time.UTC)
+	if diff := cmp.Diff(expected, envelopes, cmp.AllowUnexported(envelopeItems{})); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_generateMarkAreasFromBands(t *testing.T) {
+	min, max := 40.0, 60.0
+	bands := comfort.Bands{
+		{Metric: "humidity", Name: "dry", Max: &min, Color: "#fac858"},
+		{Metric: "humidity", Name: "comfortable", Min: &min, Max: &max, Color: "#00e400"},
+		{Metric: "humidity", Name: "humid", Min: &max, Color: "#73c0de"},
+	}
+
+	label := &opts.Label{Show: true, Position: "insideRight", Formatter: "{b}"}
+	expected := [][]markAreaItem{
+		{{Name: "dry", ItemStyle: &opts.ItemStyle{Color: "#fac858", Opacity: 0.1}, Label: label}, {YAxis: 40.0}},
+		{{Name: "comfortable", YAxis: 40.0, ItemStyle: &opts.ItemStyle{Color: "#00e400", Opacity: 0.1}, Label: label}, {YAxis: 60.0}},
+		{{Name: "humid", YAxis: 60.0, ItemStyle: &opts.ItemStyle{Color: "#73c0de", Opacity: 0.1}, Label: label}, {}},
+	}
+	if diff := cmp.Diff(expected, generateMarkAreasFromBands(bands)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_makeChart_bands(t *testing.T) {
+	min := 40.0
+	bands := comfort.Bands{{Metric: "humidity", Name: "dry", Max: &min, Color: "#fac858"}}
+	sensors := []models.Sensor{{ID: "bedroom"}, {ID: "kitchen", DisplayName: "Kitchen"}}
+
+	markLines := markLinesPerSensor{"kitchen": {{Name: "offline", XAxis: "1970-01-01 00:30:00"}}}
+
+	line := makeChart(sensors, lineItemsPerSensor{}, envelopesPerSensor{}, markLines, markAreasPerSensor{}, bands, "Humidity", 0, 3600, time.UTC)
+
+	// the bands are drawn with a series of their own, whichever sensors are shown
+	names := make([]string, 0)
+	marked := make([]string, 0)
+	lined := make([]string, 0)
+	for _, s := range line.MultiSeries {
+		names = append(names, s.Name)
+		if s.MarkAreas != nil && len(s.MarkAreas.Data) > 0 {
+			marked = append(marked, s.Name)
+		}
+		if s.MarkLines != nil && len(s.MarkLines.Data) > 0 {
+			lined = append(lined, s.Name)
+		}
+	}
+
+	if diff := cmp.Diff([]string{"bedroom", "Kitchen", bandsSeriesName}, names); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([]string{bandsSeriesName}, marked); diff != "" {
+		t.Error(diff)
+	}
+	// options of a series do not leak to the other series
+	if diff := cmp.Diff([]string{"Kitchen"}, lined); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([]string{"bedroom", "Kitchen"}, line.Legend.Data); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_makeChart_envelopes(t *testing.T) {
+	sensors := []models.Sensor{{ID: "bedroom"}, {ID: "kitchen", DisplayName: "Kitchen"}}
+	envelopes := envelopesPerSensor{"kitchen": {
+		lower: []opts.LineData{{Value: []interface{}{"1970-01-01 00:00:00", 40.0}}},
+		width: []opts.LineData{{Value: []interface{}{"1970-01-01 00:00:00", 10.0}}},
+	}}
+
+	line := makeChart(sensors, lineItemsPerSensor{}, envelopes, markLinesPerSensor{}, markAreasPerSensor{}, comfort.Bands{}, "Humidity", 0, 3600, time.UTC)
+
+	// only the envelope series are stacked and transparent, the lines keep their style
+	names := make([]string, 0)
+	stacked := make([]string, 0)
+	transparent := make([]string, 0)
+	shaded := make([]string, 0)
+	for _, s := range line.MultiSeries {
+		names = append(names, s.Name)
+		if s.Stack != "" {
+			stacked = append(stacked, s.Name)
+		}
+		if s.LineStyle != nil && s.LineStyle.Color == "transparent" {
+			transparent = append(transparent, s.Name)
+		}
+		if s.AreaStyle != nil {
+			shaded = append(shaded, s.Name)
+		}
+	}
+
+	if diff := cmp.Diff([]string{"bedroom", "Kitchen", "Kitchen min", "Kitchen range"}, names); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([]string{"Kitchen min", "Kitchen range"}, stacked); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([]string{"Kitchen min", "Kitchen range"}, transparent); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([]string{"Kitchen range"}, shaded); diff != "" {
+		t.Error(diff)
+	}
+}
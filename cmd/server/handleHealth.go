@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const readinessTimeout = 2 * time.Second
+
+type healthResponse struct {
+	Status   string `json:"status"`
+	Database string `json:"database,omitempty"`
+}
+
+// handleHealthz reports that the server is alive, it does not check dependencies so that
+// an unreachable database does not get the server restarted.
+func (s *Server) handleHealthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(healthResponse{Status: "ok"})
+	}
+}
+
+// handleReadyz reports whether the server can serve requests, i.e. the database is reachable.
+func (s *Server) handleReadyz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		response := healthResponse{Status: "ok", Database: "ok"}
+		code := http.StatusOK
+
+		if err := s.DB.PingContext(ctx); err != nil {
+			s.LogError.Printf("readiness check failed, database is not reachable: %s", err)
+			response = healthResponse{Status: "unavailable", Database: err.Error()}
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+	}
+}
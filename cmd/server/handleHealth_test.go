@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/miselaytes-anton/airy/internal/testserver"
+)
+
+type pingerStub struct {
+	err error
+}
+
+func (p pingerStub) PingContext(ctx context.Context) error {
+	return p.err
+}
+
+func Test_handleHealth(t *testing.T) {
+	data := []struct {
+		name         string
+		url          string
+		pingErr      error
+		expectedCode int
+		expectedBody string
+	}{
+		{"alive", "/healthz", nil, http.StatusOK, `{"status":"ok"}`},
+		{"alive without database", "/healthz", errors.New("connection refused"), http.StatusOK, `{"status":"ok"}`},
+		{"ready", "/readyz", nil, http.StatusOK, `{"status":"ok","database":"ok"}`},
+		{"not ready", "/readyz", errors.New("connection refused"), http.StatusServiceUnavailable, `{"status":"unavailable","database":"connection refused"}`},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				router := httprouter.New()
+				server := Server{
+					Router:   router,
+					DB:       pingerStub{err: d.pingErr},
+					LogError: log.New(io.Discard, "", 0),
+					LogInfo:  log.New(io.Discard, "", 0),
+				}
+				server.routes()
+
+				ts := testserver.TestServer{Server: httptest.NewServer(router)}
+				defer ts.Server.Close()
+
+				statusCode, _, body := ts.Get(t, d.url)
+
+				if diff := cmp.Diff(d.expectedCode, statusCode); diff != "" {
+					t.Error(diff)
+				}
+
+				if diff := cmp.Diff(d.expectedBody+"\n", string(body)); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
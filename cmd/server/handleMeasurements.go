@@ -1,61 +1,196 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
-	"strconv"
+	"slices"
+	"time"
 
+	"github.com/go-playground/validator/v10"
+
+	"github.com/miselaytes-anton/airy/internal/export"
 	"github.com/miselaytes-anton/airy/internal/models"
+	"github.com/miselaytes-anton/airy/internal/urlquery"
 )
 
-func makeMeasurementsQuery(r *http.Request) (models.MeasurementsQuery, error) {
-	q := models.MeasurementsQuery{}
+type measurementsQuery struct {
+	From       *int64  `validate:"required,gte=0,lte=2147483647"`
+	To         *int64  `validate:"required,gtfield=From,lte=2147483647"`
+	Resolution *int    `validate:"required,gt=0,lte=2147483647"`
+	Format     *string `validate:"omitempty,oneof=json ndjson csv parquet"`
+	// Aggregation combines the measurements within the resolution, the average by default.
+	Aggregation *string `validate:"omitempty,oneof=avg min max median p95 first last count envelope"`
+	// Sensors and Metrics limit the measurements and their columns, all are returned when they are empty.
+	Sensors []string `validate:"dive,required"`
+	Metrics []string `validate:"dive,oneof=iaq co2 voc pressure temperature humidity"`
+}
+
+func parseMeasurementsQuery(r *http.Request) (*measurementsQuery, error) {
+	values := r.URL.Query()
 
-	fromStr := r.URL.Query().Get("from")
-	fromEpoch, err := strconv.ParseInt(fromStr, 10, 64)
+	from, err := urlquery.ReadInt64FromQuery(values, "from")
 	if err != nil {
-		return q, fmt.Errorf("invalid from: %s, must be a unix timestamp in ms", fromStr)
+		return nil, err
 	}
 
-	toStr := r.URL.Query().Get("to")
-	toEpoch, err := strconv.ParseInt(toStr, 10, 64)
+	to, err := urlquery.ReadInt64FromQuery(values, "to")
 	if err != nil {
-		return q, fmt.Errorf("invalid to: %s, must be a unix timestamp in ms", toStr)
+		return nil, err
 	}
 
-	resolutionStr := r.URL.Query().Get("resolution")
-	resolution, err := strconv.ParseInt(resolutionStr, 10, 64)
+	resolution, err := urlquery.ReadIntFromQuery(values, "resolution")
 	if err != nil {
-		return q, fmt.Errorf("invalid resolution: %s, must be an integer", resolutionStr)
+		return nil, err
+	}
+
+	return &measurementsQuery{
+		From:        from,
+		To:          to,
+		Resolution:  resolution,
+		Format:      urlquery.ReadStringFromQuery(values, "format"),
+		Aggregation: urlquery.ReadStringFromQuery(values, "agg"),
+		Sensors:     values["sensor"],
+		Metrics:     values["metric"],
+	}, nil
+}
+
+// getExportFormat returns the requested format or else the one accepted by the Accept header, JSON by default.
+func getExportFormat(q measurementsQuery, accept string) string {
+	if q.Format != nil {
+		return *q.Format
 	}
 
-	q.StartEpoch = fromEpoch
-	q.EndEpoch = toEpoch
-	q.Resolution = int(resolution)
-	q.SensorIDs = SENSOR_IDS
+	if format, ok := export.Negotiate(accept); ok {
+		return format
+	}
 
-	return q, nil
+	return export.FormatJSON
+}
+
+// filterSensorIDs returns the requested sensors, all sensors when none are requested.
+func filterSensorIDs(sensorIDs []string, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return sensorIDs, nil
+	}
+
+	for _, sensorID := range requested {
+		if !slices.Contains(sensorIDs, sensorID) {
+			return nil, fmt.Errorf("sensor did not pass validation rules: unknown sensor %s", sensorID)
+		}
+	}
+
+	return requested, nil
+}
+
+// deadlineWriter writes to the response and extends its write deadline by WriteTimeout before every write,
+// so that exports of long ranges are not cut off while a stalled client still times out.
+type deadlineWriter struct {
+	w          http.ResponseWriter
+	controller *http.ResponseController
+	timeout    time.Duration
+}
+
+func (d deadlineWriter) Write(b []byte) (int, error) {
+	if err := d.controller.SetWriteDeadline(time.Now().Add(d.timeout)); err != nil {
+		return 0, err
+	}
+	return d.w.Write(b)
+}
+
+// deadlineWriter returns the writer exports are written to, the response itself when it has no write timeout.
+func (s *Server) deadlineWriter(w http.ResponseWriter) io.Writer {
+	if s.WriteTimeout <= 0 {
+		return w
+	}
+
+	controller := http.NewResponseController(w)
+	if err := controller.SetWriteDeadline(time.Now().Add(s.WriteTimeout)); err != nil {
+		s.LogError.Printf("write deadline could not be extended: %s", err)
+		return w
+	}
+
+	return deadlineWriter{w: w, controller: controller, timeout: s.WriteTimeout}
 }
 
 func (s *Server) handleMeasurements() http.HandlerFunc {
+	validate := validator.New(validator.WithRequiredStructEnabled())
+
 	return func(w http.ResponseWriter, r *http.Request) {
-		q, err := makeMeasurementsQuery(r)
+		q, err := parseMeasurementsQuery(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			s.jsonError(w, err, http.StatusBadRequest)
 			return
 		}
 
-		measurements, err := s.Measurements.GetMeasurements(q)
+		err = validate.Struct(q)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			s.jsonValidationError(w, err)
 			return
 		}
 
-		err = json.NewEncoder(w).Encode(measurements)
+		sensorIDs, err := s.sensorIDs()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		sensorIDs, err = filterSensorIDs(sensorIDs, q.Sensors)
+		if err != nil {
+			s.jsonError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		query := models.MeasurementsQuery{
+			StartEpoch: *q.From,
+			EndEpoch:   *q.To,
+			Resolution: *q.Resolution,
+			SensorIDs:  sensorIDs,
+		}
+		columns := export.Columns(q.Metrics)
+		if q.Aggregation != nil {
+			query.Aggregation = models.Aggregation(*q.Aggregation)
+			if query.Aggregation == models.AggregationEnvelope {
+				columns = export.EnvelopeColumns(q.Metrics)
+			}
+		}
+		format := getExportFormat(*q, r.Header.Get("Accept"))
+
+		// the response is started with the first measurement, so that a failing query can still be responded with an error
+		var out export.Writer
+		start := func() (err error) {
+			w.Header().Set("Content-Type", export.ContentTypes[format])
+			if format == export.FormatCSV || format == export.FormatParquet {
+				w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="measurements.%s"`, format))
+			}
+
+			out, err = export.New(format, s.deadlineWriter(w), columns)
+			return err
+		}
+
+		err = s.Measurements.StreamMeasurements(query, func(measurement models.Measurement) error {
+			if out == nil {
+				if err := start(); err != nil {
+					return err
+				}
+			}
+			return out.Write(measurement)
+		})
+		if err == nil && out == nil {
+			err = start()
+		}
+		if err == nil {
+			err = out.Close()
+		}
+
+		if err != nil && out == nil {
+			s.jsonError(w, err, http.StatusInternalServerError)
 			return
 		}
+		if err != nil {
+			// the status is already sent, the connection is aborted so that the client does not take a truncated export as complete
+			s.LogError.Printf("measurements export failed: %s", err)
+			panic(http.ErrAbortHandler)
+		}
 	}
 }
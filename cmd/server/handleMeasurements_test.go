@@ -1,11 +1,16 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/julienschmidt/httprouter"
@@ -28,14 +33,22 @@ func Test_handleMeasurements(t *testing.T) {
 	}}
 
 	measurementsMock := mocks.MeasurementModelMock{
-		Measurements:        measurements,
-		GetMeasurementsMock: mocks.GetMeasurementsOkMock,
+		Measurements:           measurements,
+		GetMeasurementsMock:    mocks.GetMeasurementsOkMock,
+		StreamMeasurementsMock: mocks.StreamMeasurementsOkMock,
+	}
+
+	sensorsMock := mocks.SensorModelMock{
+		Sensors:           []models.Sensor{{ID: "bedroom"}, {ID: "livingroom"}},
+		GetAllSensorsMock: mocks.GetAllSensorsOkMock,
+		GetSensorMock:     mocks.GetSensorOkMock,
 	}
 
 	router := httprouter.New()
 	server := Server{
 		Router:       router,
 		Measurements: &measurementsMock,
+		Sensors:      &sensorsMock,
 		LogError:     log.New(io.Discard, "", 0),
 		LogInfo:      log.New(io.Discard, "", 0),
 	}
@@ -46,29 +59,140 @@ func Test_handleMeasurements(t *testing.T) {
 	defer ts.Server.Close()
 
 	requests := []struct {
-		name         string
-		urlPath      string
-		expectedCode int
+		name                string
+		urlPath             string
+		accept              string
+		expectedCode        int
+		expectedContentType string
+		expectedBody        string
 	}{
 		{
 			"valid query",
 			"/api/measurements?from=1&to=2&resolution=600",
+			"",
+			http.StatusOK,
+			"application/json",
+			`[{"timestamp":1,"sensorId":"bedroom","iaq":150,"co2":900,"voc":6,"pressure":760,"temperature":20,"humidity":50}]` + "\n",
+		},
+		{
+			"csv, metrics",
+			"/api/measurements?from=1&to=2&resolution=600&format=csv&metric=co2&metric=humidity",
+			"",
+			http.StatusOK,
+			"text/csv; charset=utf-8",
+			"timestamp,sensorId,co2,humidity\n1,bedroom,900,50\n",
+		},
+		{
+			"csv, envelope",
+			"/api/measurements?from=1&to=2&resolution=600&format=csv&metric=co2&agg=envelope",
+			"",
+			http.StatusOK,
+			"text/csv; charset=utf-8",
+			"timestamp,sensorId,co2,co2Min,co2Max\n1,bedroom,900,900,900\n",
+		},
+		{
+			"ndjson, accept",
+			"/api/measurements?from=1&to=2&resolution=600&metric=iaq",
+			"application/x-ndjson",
+			http.StatusOK,
+			"application/x-ndjson",
+			`{"timestamp":1,"sensorId":"bedroom","iaq":150}` + "\n",
+		},
+		{
+			"format overrides accept",
+			"/api/measurements?from=1&to=2&resolution=600&format=json&sensor=livingroom",
+			"text/csv",
 			http.StatusOK,
+			"application/json",
+			"[]\n",
+		},
+		{
+			"parquet",
+			"/api/measurements?from=1&to=2&resolution=600&format=parquet&sensor=bedroom",
+			"",
+			http.StatusOK,
+			"application/vnd.apache.parquet",
+			"",
 		},
 		{
 			"invalid from",
 			"/api/measurements?from=hello&to=2&resolution=600",
+			"",
 			http.StatusBadRequest,
+			"application/json; charset=utf-8",
+			`{"status":"Bad Request","error":"could not parse 'from', expected an integer, got 'hello'"}` + "\n",
 		},
 		{
 			"invalid to",
 			"/api/measurements?from=1&to=hello&resolution=600",
+			"",
 			http.StatusBadRequest,
+			"application/json; charset=utf-8",
+			`{"status":"Bad Request","error":"could not parse 'to', expected an integer, got 'hello'"}` + "\n",
 		},
 		{
 			"invalid resolution",
 			"/api/measurements?from=1&to=-2&resolution=hello",
+			"",
+			http.StatusBadRequest,
+			"application/json; charset=utf-8",
+			`{"status":"Bad Request","error":"could not parse 'resolution', expected an integer, got 'hello'"}` + "\n",
+		},
+		{
+			"missing from",
+			"/api/measurements?to=2&resolution=600",
+			"",
+			http.StatusBadRequest,
+			"application/json; charset=utf-8",
+			`{"status":"Bad Request","error":"from did not pass validation rules: required, to did not pass validation rules: gtfield from"}` + "\n",
+		},
+		{
+			"to before from",
+			"/api/measurements?from=2&to=1&resolution=600",
+			"",
+			http.StatusBadRequest,
+			"application/json; charset=utf-8",
+			`{"status":"Bad Request","error":"to did not pass validation rules: gtfield from"}` + "\n",
+		},
+		{
+			"invalid resolution:0",
+			"/api/measurements?from=1&to=2&resolution=0",
+			"",
+			http.StatusBadRequest,
+			"application/json; charset=utf-8",
+			`{"status":"Bad Request","error":"resolution did not pass validation rules: gt 0"}` + "\n",
+		},
+		{
+			"invalid format",
+			"/api/measurements?from=1&to=2&resolution=600&format=xml",
+			"",
+			http.StatusBadRequest,
+			"application/json; charset=utf-8",
+			`{"status":"Bad Request","error":"format did not pass validation rules: oneof json ndjson csv parquet"}` + "\n",
+		},
+		{
+			"invalid aggregation",
+			"/api/measurements?from=1&to=2&resolution=600&agg=mode",
+			"",
+			http.StatusBadRequest,
+			"application/json; charset=utf-8",
+			`{"status":"Bad Request","error":"aggregation did not pass validation rules: oneof avg min max median p95 first last count envelope"}` + "\n",
+		},
+		{
+			"invalid metric",
+			"/api/measurements?from=1&to=2&resolution=600&metric=co2&metric=radon",
+			"",
+			http.StatusBadRequest,
+			"application/json; charset=utf-8",
+			`{"status":"Bad Request","error":"metrics[1] did not pass validation rules: oneof iaq co2 voc pressure temperature humidity"}` + "\n",
+		},
+		{
+			"invalid sensor",
+			"/api/measurements?from=1&to=2&resolution=600&sensor=bedroom&sensor=kitchen",
+			"",
 			http.StatusBadRequest,
+			"application/json; charset=utf-8",
+			`{"status":"Bad Request","error":"sensor did not pass validation rules: unknown sensor kitchen"}` + "\n",
 		},
 	}
 
@@ -76,11 +200,163 @@ func Test_handleMeasurements(t *testing.T) {
 		t.Run(
 			d.name,
 			func(t *testing.T) {
-				statusCode, _, _ := ts.Get(t, d.urlPath)
-				if diff := cmp.Diff(d.expectedCode, statusCode); diff != "" {
+				req, err := http.NewRequest(http.MethodGet, ts.Server.URL+d.urlPath, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Accept", d.accept)
+
+				res, err := ts.Server.Client().Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer res.Body.Close()
+
+				body, err := io.ReadAll(res.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if diff := cmp.Diff(d.expectedCode, res.StatusCode); diff != "" {
 					t.Error(diff)
 				}
+				if diff := cmp.Diff(d.expectedContentType, res.Header.Get("Content-Type")); diff != "" {
+					t.Error(diff)
+				}
+				if d.expectedBody != "" {
+					if diff := cmp.Diff(d.expectedBody, string(body)); diff != "" {
+						t.Error(diff)
+					}
+				}
 			},
 		)
 	}
 }
+
+func Test_handleMeasurements_queryError(t *testing.T) {
+	measurementsMock := mocks.MeasurementModelMock{
+		StreamMeasurementsMock: mocks.StreamMeasurementsErrorMock,
+	}
+
+	sensorsMock := mocks.SensorModelMock{
+		Sensors:           []models.Sensor{{ID: "bedroom"}},
+		GetAllSensorsMock: mocks.GetAllSensorsOkMock,
+	}
+
+	router := httprouter.New()
+	server := Server{
+		Router:       router,
+		Measurements: &measurementsMock,
+		Sensors:      &sensorsMock,
+		LogError:     log.New(io.Discard, "", 0),
+		LogInfo:      log.New(io.Discard, "", 0),
+	}
+
+	server.routes()
+
+	ts := testserver.TestServer{Server: httptest.NewServer(router)}
+	defer ts.Server.Close()
+
+	statusCode, _, _ := ts.Get(t, "/api/measurements?from=1&to=2&resolution=600&format=csv")
+	if diff := cmp.Diff(http.StatusInternalServerError, statusCode); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_handleMeasurements_writeTimeout(t *testing.T) {
+	measurementsMock := mocks.MeasurementModelMock{
+		Measurements: []models.Measurement{{Timestamp: 1, SensorID: "bedroom", CO2: 900}, {Timestamp: 2, SensorID: "bedroom", CO2: 950}},
+		// a slow query, the stream takes longer than the write timeout of the server
+		StreamMeasurementsMock: func(mq models.MeasurementsQuery, fn func(models.Measurement) error, measurements *[]models.Measurement) error {
+			for _, m := range *measurements {
+				time.Sleep(100 * time.Millisecond)
+				if err := fn(m); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	sensorsMock := mocks.SensorModelMock{
+		Sensors:           []models.Sensor{{ID: "bedroom"}},
+		GetAllSensorsMock: mocks.GetAllSensorsOkMock,
+	}
+
+	router := httprouter.New()
+	server := Server{
+		Router:       router,
+		Measurements: &measurementsMock,
+		Sensors:      &sensorsMock,
+		WriteTimeout: 50 * time.Millisecond,
+		// requests are instrumented, so the deadline is extended through the status recorder
+		Metrics:  newServerMetrics(&measurementsMock, log.New(io.Discard, "", 0)),
+		LogError: log.New(io.Discard, "", 0),
+		LogInfo:  log.New(io.Discard, "", 0),
+	}
+	server.routes()
+
+	ts := testserver.TestServer{Server: httptest.NewUnstartedServer(router)}
+	ts.Server.Config.WriteTimeout = server.WriteTimeout
+	ts.Server.Start()
+	defer ts.Server.Close()
+
+	statusCode, _, body := ts.Get(t, "/api/measurements?from=1&to=2&resolution=600&format=ndjson&metric=co2")
+
+	expected := `{"timestamp":1,"sensorId":"bedroom","co2":900}` + "\n" + `{"timestamp":2,"sensorId":"bedroom","co2":950}` + "\n"
+	if diff := cmp.Diff([]any{http.StatusOK, expected}, []any{statusCode, string(body)}); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_handleMeasurements_stalledClient(t *testing.T) {
+	stopped := make(chan error, 1)
+	measurementsMock := mocks.MeasurementModelMock{
+		// an endless export, it only stops when a write fails
+		StreamMeasurementsMock: func(mq models.MeasurementsQuery, fn func(models.Measurement) error, measurements *[]models.Measurement) error {
+			for i := int64(0); ; i++ {
+				if err := fn(models.Measurement{Timestamp: i, SensorID: "bedroom", CO2: 900}); err != nil {
+					stopped <- err
+					return err
+				}
+			}
+		},
+	}
+	sensorsMock := mocks.SensorModelMock{
+		Sensors:           []models.Sensor{{ID: "bedroom"}},
+		GetAllSensorsMock: mocks.GetAllSensorsOkMock,
+	}
+
+	router := httprouter.New()
+	server := Server{
+		Router:       router,
+		Measurements: &measurementsMock,
+		Sensors:      &sensorsMock,
+		WriteTimeout: 50 * time.Millisecond,
+		LogError:     log.New(io.Discard, "", 0),
+		LogInfo:      log.New(io.Discard, "", 0),
+	}
+	server.routes()
+
+	ts := httptest.NewUnstartedServer(router)
+	ts.Config.WriteTimeout = server.WriteTimeout
+	ts.Config.ErrorLog = log.New(io.Discard, "", 0)
+	ts.Start()
+	defer ts.Close()
+
+	// the client sends the request and never reads the response
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "GET /api/measurements?from=1&to=2&resolution=600&format=ndjson HTTP/1.1\r\nHost: localhost\r\n\r\n")
+
+	select {
+	case err := <-stopped:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("expected the write deadline to be exceeded, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the export to stop writing to a stalled client")
+	}
+}
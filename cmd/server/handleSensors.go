@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/julienschmidt/httprouter"
+	"github.com/miselaytes-anton/airy/internal/models"
+)
+
+// sensorIDs returns the ids of all registered sensors.
+func (s *Server) sensorIDs() ([]string, error) {
+	sensors, err := s.Sensors.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(sensors))
+	for _, sensor := range sensors {
+		ids = append(ids, sensor.ID)
+	}
+
+	return ids, nil
+}
+
+// checkSensorID responds with an error and returns false when the id in the given request field is not a registered sensor.
+func (s *Server) checkSensorID(w http.ResponseWriter, field string, sensorID string) bool {
+	_, err := s.Sensors.Get(sensorID)
+	if err != nil {
+		if errors.Is(err, models.ErrSensorNotFound) {
+			s.jsonError(w, fmt.Errorf("%s did not pass validation rules: unknown sensor %s", field, sensorID), http.StatusBadRequest)
+			return false
+		}
+		s.jsonError(w, err, http.StatusInternalServerError)
+		return false
+	}
+
+	return true
+}
+
+func (s *Server) handleSensorsList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sensors, err := s.Sensors.GetAll()
+		if err != nil {
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(sensors)
+		if err != nil {
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// sensorStatus returns the status of a sensor. The status is maintained by the processor, a sensor which
+// did not report for longer than offlineAfter is offline even if the processor itself is not running.
+func sensorStatus(sensor models.Sensor, offlineAfter time.Duration, now time.Time) string {
+	if sensor.Status == models.SensorStatusOnline && now.Sub(time.Unix(sensor.LastSeen, 0)) > offlineAfter {
+		return models.SensorStatusOffline
+	}
+
+	return sensor.Status
+}
+
+func (s *Server) handleSensorsStatus() http.HandlerFunc {
+	type status struct {
+		SensorID        string `json:"sensorId"`
+		Status          string `json:"status"`
+		LastSeen        int64  `json:"lastSeen,omitempty"`
+		StatusChangedAt int64  `json:"statusChangedAt,omitempty"`
+	}
+
+	type response = []status
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		sensors, err := s.Sensors.GetAll()
+		if err != nil {
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		now := time.Now()
+		response := make(response, 0, len(sensors))
+		for _, sensor := range sensors {
+			response = append(response, status{
+				SensorID:        sensor.ID,
+				Status:          sensorStatus(sensor, s.OfflineAfter, now),
+				LastSeen:        sensor.LastSeen,
+				StatusChangedAt: sensor.StatusChangedAt,
+			})
+		}
+
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (s *Server) handleSensorsGet() http.HandlerFunc {
+	handleStatus := s.handleSensorsStatus()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		if params.ByName("id") == models.ReservedSensorID {
+			handleStatus(w, r)
+			return
+		}
+
+		sensor, err := s.Sensors.Get(params.ByName("id"))
+		if err != nil {
+			if errors.Is(err, models.ErrSensorNotFound) {
+				s.jsonError(w, err, http.StatusNotFound)
+				return
+			}
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(sensor)
+		if err != nil {
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (s *Server) handleSensorsCreate() http.HandlerFunc {
+	type request struct {
+		ID              string `json:"id" validate:"required,max=255,excludesall= "`
+		DisplayName     string `json:"displayName" validate:"max=255"`
+		Location        string `json:"location" validate:"max=255"`
+		FirmwareVersion string `json:"firmwareVersion" validate:"max=255"`
+	}
+
+	type response = models.Sensor
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request request
+		err := s.readJson(w, r, &request)
+		if err != nil {
+			s.jsonError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		err = validate.Struct(request)
+		if err != nil {
+			s.jsonValidationError(w, err)
+			return
+		}
+
+		if request.ID == models.ReservedSensorID {
+			s.jsonError(w, models.ErrReservedSensorID, http.StatusBadRequest)
+			return
+		}
+
+		sensor, err := s.Sensors.InsertSensor(models.Sensor{
+			ID:              request.ID,
+			DisplayName:     request.DisplayName,
+			Location:        request.Location,
+			FirmwareVersion: request.FirmwareVersion,
+		})
+		if err != nil {
+			if errors.Is(err, models.ErrDuplicateSensor) {
+				s.jsonError(w, err, http.StatusConflict)
+				return
+			}
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		var response response = sensor
+
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (s *Server) handleSensorsUpdate() http.HandlerFunc {
+	type request struct {
+		DisplayName     *string `json:"displayName,omitempty" validate:"omitempty,max=255"`
+		Location        *string `json:"location,omitempty" validate:"omitempty,max=255"`
+		FirmwareVersion *string `json:"firmwareVersion,omitempty" validate:"omitempty,max=255"`
+	}
+
+	type response = models.Sensor
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request request
+		err := s.readJson(w, r, &request)
+		if err != nil {
+			s.jsonError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		err = validate.Struct(request)
+		if err != nil {
+			s.jsonValidationError(w, err)
+			return
+		}
+
+		params := httprouter.ParamsFromContext(r.Context())
+
+		sensor, err := s.Sensors.Get(params.ByName("id"))
+		if err != nil {
+			if errors.Is(err, models.ErrSensorNotFound) {
+				s.jsonError(w, err, http.StatusNotFound)
+				return
+			}
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		if request.DisplayName != nil {
+			sensor.DisplayName = *request.DisplayName
+		}
+		if request.Location != nil {
+			sensor.Location = *request.Location
+		}
+		if request.FirmwareVersion != nil {
+			sensor.FirmwareVersion = *request.FirmwareVersion
+		}
+
+		sensor, err = s.Sensors.UpdateSensor(sensor)
+		if err != nil {
+			if errors.Is(err, models.ErrSensorNotFound) {
+				s.jsonError(w, err, http.StatusNotFound)
+				return
+			}
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		response := response(sensor)
+
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (s *Server) handleSensorsDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		err := s.Sensors.DeleteSensor(params.ByName("id"))
+		if err != nil {
+			if errors.Is(err, models.ErrSensorNotFound) {
+				s.jsonError(w, err, http.StatusNotFound)
+				return
+			}
+			s.jsonError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
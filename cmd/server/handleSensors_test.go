@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+	"github.com/miselaytes-anton/airy/internal/models/mocks"
+	"github.com/miselaytes-anton/airy/internal/testserver"
+)
+
+func newSensorsTestServer(sensorsMock *mocks.SensorModelMock) testserver.TestServer {
+	router := httprouter.New()
+	server := Server{
+		Router:   router,
+		Sensors:  sensorsMock,
+		LogError: log.New(io.Discard, "", 0),
+		LogInfo:  log.New(io.Discard, "", 0),
+	}
+
+	server.routes()
+
+	return testserver.TestServer{Server: httptest.NewServer(router)}
+}
+
+func Test_handleSensorsList(t *testing.T) {
+	sensors := []models.Sensor{{
+		ID:          "bedroom",
+		DisplayName: "Bedroom",
+		Location:    "bedroom",
+		LastSeen:    1,
+	}}
+
+	sensorsMock := mocks.SensorModelMock{
+		Sensors:           sensors,
+		GetAllSensorsMock: mocks.GetAllSensorsOkMock,
+		GetSensorMock:     mocks.GetSensorOkMock,
+	}
+
+	ts := newSensorsTestServer(&sensorsMock)
+	defer ts.Server.Close()
+
+	t.Run("list", func(t *testing.T) {
+		statusCode, _, body := ts.Get(t, "/api/sensors")
+
+		if diff := cmp.Diff(http.StatusOK, statusCode); diff != "" {
+			t.Error(diff)
+		}
+
+		received := make([]models.Sensor, 0)
+		if err := json.Unmarshal(body, &received); err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(sensors, received); diff != "" {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		statusCode, _, _ := ts.Get(t, "/api/sensors/bedroom")
+
+		if diff := cmp.Diff(http.StatusOK, statusCode); diff != "" {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("get unknown", func(t *testing.T) {
+		statusCode, _, _ := ts.Get(t, "/api/sensors/kitchen")
+
+		if diff := cmp.Diff(http.StatusNotFound, statusCode); diff != "" {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		sensorsMock.GetAllSensorsMock = mocks.GetAllSensorsErrorMock
+		defer func() { sensorsMock.GetAllSensorsMock = mocks.GetAllSensorsOkMock }()
+
+		statusCode, _, _ := ts.Get(t, "/api/sensors")
+
+		if diff := cmp.Diff(http.StatusInternalServerError, statusCode); diff != "" {
+			t.Error(diff)
+		}
+	})
+}
+
+func Test_handleSensorsCreate(t *testing.T) {
+	sensorsMock := mocks.SensorModelMock{
+		Sensors:          []models.Sensor{{ID: "bedroom"}},
+		InsertSensorMock: mocks.InsertSensorOkMock,
+	}
+
+	ts := newSensorsTestServer(&sensorsMock)
+	defer ts.Server.Close()
+
+	requests := []struct {
+		name          string
+		request       string
+		expectedCode  int
+		expectedError string
+	}{
+		{
+			"valid request",
+			`{"id": "kitchen", "displayName": "Kitchen", "location": "ground floor"}`,
+			http.StatusOK,
+			"",
+		},
+		{
+			"duplicate id",
+			`{"id": "bedroom"}`,
+			http.StatusConflict,
+			models.ErrDuplicateSensor.Error(),
+		},
+		{
+			"missing id",
+			`{"displayName": "Kitchen"}`,
+			http.StatusBadRequest,
+			"iD did not pass validation rules: required",
+		},
+		{
+			"id with a space",
+			`{"id": "guest room"}`,
+			http.StatusBadRequest,
+			"iD did not pass validation rules: excludesall",
+		},
+		{
+			"reserved id",
+			`{"id": "status"}`,
+			http.StatusBadRequest,
+			models.ErrReservedSensorID.Error(),
+		},
+	}
+
+	for _, d := range requests {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				statusCode, _, body := ts.Post(t, "/api/sensors", []byte(d.request))
+
+				if diff := cmp.Diff(d.expectedCode, statusCode); diff != "" {
+					t.Error(diff)
+				}
+
+				if d.expectedError == "" {
+					return
+				}
+
+				responseError := new(ResponseError)
+				if err := json.Unmarshal(body, &responseError); err != nil {
+					t.Fatal(err)
+				}
+
+				if diff := cmp.Diff(d.expectedError, responseError.Error); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+
+	expected := []models.Sensor{{ID: "bedroom"}, {ID: "kitchen", DisplayName: "Kitchen", Location: "ground floor"}}
+	if diff := cmp.Diff(expected, sensorsMock.Sensors); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_handleSensorsUpdate(t *testing.T) {
+	sensorsMock := mocks.SensorModelMock{
+		Sensors:          []models.Sensor{{ID: "bedroom", DisplayName: "Bedroom", FirmwareVersion: "1.0.0"}},
+		GetSensorMock:    mocks.GetSensorOkMock,
+		UpdateSensorMock: mocks.UpdateSensorOkMock,
+	}
+
+	ts := newSensorsTestServer(&sensorsMock)
+	defer ts.Server.Close()
+
+	statusCode, _, _ := ts.Patch(t, "/api/sensors/bedroom", []byte(`{"location": "first floor"}`))
+	if diff := cmp.Diff(http.StatusOK, statusCode); diff != "" {
+		t.Error(diff)
+	}
+
+	expected := []models.Sensor{{ID: "bedroom", DisplayName: "Bedroom", Location: "first floor", FirmwareVersion: "1.0.0"}}
+	if diff := cmp.Diff(expected, sensorsMock.Sensors); diff != "" {
+		t.Error(diff)
+	}
+
+	statusCode, _, _ = ts.Patch(t, "/api/sensors/kitchen", []byte(`{"location": "ground floor"}`))
+	if diff := cmp.Diff(http.StatusNotFound, statusCode); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_handleSensorsDelete(t *testing.T) {
+	sensorsMock := mocks.SensorModelMock{
+		Sensors:          []models.Sensor{{ID: "bedroom"}, {ID: "livingroom"}},
+		DeleteSensorMock: mocks.DeleteSensorOkMock,
+	}
+
+	ts := newSensorsTestServer(&sensorsMock)
+	defer ts.Server.Close()
+
+	statusCode, _, _ := ts.Delete(t, "/api/sensors/bedroom")
+	if diff := cmp.Diff(http.StatusNoContent, statusCode); diff != "" {
+		t.Error(diff)
+	}
+
+	if diff := cmp.Diff([]models.Sensor{{ID: "livingroom"}}, sensorsMock.Sensors); diff != "" {
+		t.Error(diff)
+	}
+
+	statusCode, _, _ = ts.Delete(t, "/api/sensors/bedroom")
+	if diff := cmp.Diff(http.StatusNotFound, statusCode); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_handleSensorsStatus(t *testing.T) {
+	now := time.Now().Unix()
+
+	sensorsMock := mocks.SensorModelMock{
+		Sensors: []models.Sensor{
+			{ID: "bedroom", LastSeen: now - 10, Status: models.SensorStatusOnline, StatusChangedAt: now - 3600},
+			{ID: "hallway", Status: models.SensorStatusUnknown},
+			{ID: "kitchen", LastSeen: now - 600, Status: models.SensorStatusOffline, StatusChangedAt: now - 300},
+			// the processor did not report the sensor offline, e.g. because it is not running
+			{ID: "livingroom", LastSeen: now - 3600, Status: models.SensorStatusOnline, StatusChangedAt: now - 7200},
+		},
+		GetAllSensorsMock: mocks.GetAllSensorsOkMock,
+		GetSensorMock:     mocks.GetSensorOkMock,
+	}
+
+	router := httprouter.New()
+	server := Server{
+		Router:       router,
+		Sensors:      &sensorsMock,
+		OfflineAfter: 5 * time.Minute,
+		LogError:     log.New(io.Discard, "", 0),
+		LogInfo:      log.New(io.Discard, "", 0),
+	}
+
+	server.routes()
+
+	ts := testserver.TestServer{Server: httptest.NewServer(router)}
+	defer ts.Server.Close()
+
+	statusCode, _, body := ts.Get(t, "/api/sensors/status")
+	if diff := cmp.Diff(http.StatusOK, statusCode); diff != "" {
+		t.Error(diff)
+	}
+
+	type status struct {
+		SensorID string `json:"sensorId"`
+		Status   string `json:"status"`
+	}
+
+	received := make([]status, 0)
+	if err := json.Unmarshal(body, &received); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []status{
+		{"bedroom", "online"},
+		{"hallway", "unknown"},
+		{"kitchen", "offline"},
+		{"livingroom", "offline"},
+	}
+	if diff := cmp.Diff(expected, received); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"database/sql"
 	// imports postgres timezones data
@@ -18,10 +22,25 @@ import (
 	"github.com/miselaytes-anton/airy/internal/models"
 )
 
-var SENSOR_IDS = []string{"livingroom", "bedroom"}
-
 func main() {
-	db, err := sql.Open("postgres", config.GetPostgresAddress())
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:], os.LookupEnv)
+	if err != nil {
+		log.Error.Fatal(err)
+	}
+
+	// the server does not connect to the broker and does not process measurements
+	if err := cfg.Validate("MQTT", "Processor", "Writer", "Spool", "Notify"); err != nil {
+		log.Error.Fatal(err)
+	}
+
+	log.Info.Printf("effective configuration:\n%s", cfg.Redacted())
+
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		log.Error.Fatal(err)
+	}
+
+	db, err := sql.Open("postgres", cfg.Postgres.Address)
 	if err != nil {
 		log.Error.Fatal(err)
 	}
@@ -32,33 +51,66 @@ func main() {
 		log.Error.Fatal(err)
 	}
 
-	measurements := models.MeasurementModel{DB: db}
+	measurements := models.MeasurementModel{DB: db, Rollups: cfg.Rollups.Enabled}
 	events := models.EventModel{DB: db}
+	deadLetters := models.DeadLetterModel{DB: db}
+	sensors := models.SensorModel{DB: db}
+	alertRules := models.AlertRuleModel{DB: db}
+	alerts := models.AlertModel{DB: db}
 
 	router := httprouter.New()
 	server := &Server{
 		Router:       router,
+		DB:           db,
 		Measurements: measurements,
 		Events:       events,
+		DeadLetters:  deadLetters,
+		Sensors:      sensors,
+		AlertRules:   alertRules,
+		Alerts:       alerts,
+		OfflineAfter: cfg.Sensors.OfflineAfter,
+		Location:     location,
+		Views:        cfg.Views,
+		Bands:        cfg.Bands,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		Metrics:      newServerMetrics(measurements, log.Error),
 		LogError:     log.Error,
 		LogInfo:      log.Info,
 	}
 	server.routes()
 
-	log.Info.Println("server is listening on :8081")
-	log.Info.Println("visit http://localhost:8081/api/graphs")
-
+	httpConfig := cfg.Server
 	srv := &http.Server{
-		Addr: ":8081", ErrorLog: log.Error, Handler: router,
+		Addr:         httpConfig.Address,
+		ErrorLog:     log.Error,
+		Handler:      router,
+		ReadTimeout:  httpConfig.ReadTimeout,
+		WriteTimeout: httpConfig.WriteTimeout,
+		IdleTimeout:  httpConfig.IdleTimeout,
+	}
+
+	l, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		log.Error.Fatal(err)
 	}
-	srv.ListenAndServe()
 
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, os.Interrupt)
-	signal.Notify(sig, syscall.SIGTERM)
+	log.Info.Printf("server is listening on %s\n", l.Addr())
+	log.Info.Printf("visit http://localhost:%d/dashboard\n", l.Addr().(*net.TCPAddr).Port)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = serve(ctx, srv, l, httpConfig.ShutdownTimeout)
+	switch {
+	case ctx.Err() == nil:
+		log.Error.Printf("server stopped: %s", err)
+	case err != nil:
+		log.Error.Printf("signal caught - in-flight requests did not complete in time: %s", err)
+	default:
+		log.Info.Println("signal caught - in-flight requests completed")
+	}
 
-	<-sig
-	log.Info.Println("signal caught - exiting")
+	// in-flight requests are done, so the database is not used anymore
 	db.Close()
 	log.Info.Println("shutdown complete")
 }
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+)
+
+// serverMetrics are the Prometheus metrics of the server.
+type serverMetrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+}
+
+// newServerMetrics creates the server metrics, the latest reading of every sensor is queried on each scrape.
+func newServerMetrics(measurements models.MeasurementModelInterface, logError *log.Logger) *serverMetrics {
+	m := &serverMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "airy_server_requests_total",
+			Help: "Number of HTTP requests by route, method and status code.",
+		}, []string{"route", "method", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "airy_server_request_duration_seconds",
+			Help:    "Duration of HTTP requests by route and method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		newLatestReadingsCollector(measurements, logError),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// handler serves the metrics in the Prometheus text format. Request metrics are still served when the
+// latest readings cannot be loaded.
+func (m *serverMetrics) handler() http.HandlerFunc {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError}).ServeHTTP
+}
+
+// statusRecorder remembers the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to lift the write deadline of a stream.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// instrument counts requests to a route and records their duration.
+func (m *serverMetrics) instrument(method string, route string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+
+		h(recorder, r)
+
+		m.requests.WithLabelValues(route, method, strconv.Itoa(recorder.code)).Inc()
+		m.requestDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// latestReadingsCollector publishes the latest measurement of every sensor as gauges.
+type latestReadingsCollector struct {
+	measurements  models.MeasurementModelInterface
+	logError      *log.Logger
+	reading       *prometheus.Desc
+	lastTimestamp *prometheus.Desc
+}
+
+func newLatestReadingsCollector(measurements models.MeasurementModelInterface, logError *log.Logger) *latestReadingsCollector {
+	return &latestReadingsCollector{
+		measurements: measurements,
+		logError:     logError,
+		reading: prometheus.NewDesc(
+			"airy_sensor_reading",
+			"Latest measured value of a sensor metric.",
+			[]string{"sensor", "metric"},
+			nil,
+		),
+		lastTimestamp: prometheus.NewDesc(
+			"airy_sensor_last_measurement_timestamp_seconds",
+			"Unix timestamp of the latest measurement of a sensor.",
+			[]string{"sensor"},
+			nil,
+		),
+	}
+}
+
+func (c *latestReadingsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.reading
+	ch <- c.lastTimestamp
+}
+
+func (c *latestReadingsCollector) Collect(ch chan<- prometheus.Metric) {
+	latest, err := c.measurements.GetLatest()
+	if err != nil {
+		c.logError.Printf("latest measurements could not be loaded: %s", err)
+		ch <- prometheus.NewInvalidMetric(c.reading, err)
+		return
+	}
+
+	for _, m := range latest {
+		for _, name := range models.Metrics {
+			value, ok := m.Metric(name)
+			if !ok {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(c.reading, prometheus.GaugeValue, value, m.SensorID, name)
+		}
+		ch <- prometheus.MustNewConstMetric(c.lastTimestamp, prometheus.GaugeValue, float64(m.Timestamp), m.SensorID)
+	}
+}
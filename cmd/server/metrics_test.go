@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+	"github.com/miselaytes-anton/airy/internal/models/mocks"
+	"github.com/miselaytes-anton/airy/internal/testserver"
+)
+
+func Test_serverMetrics(t *testing.T) {
+	measurementsMock := mocks.MeasurementModelMock{
+		Measurements: []models.Measurement{
+			{SensorID: "bedroom", Timestamp: 1, CO2: 500},
+			{SensorID: "bedroom", Timestamp: 2, CO2: 600, IAQ: 50, VOC: 0.5, Pressure: 100853, Temperature: 21.5, Humidity: 45},
+			{SensorID: "livingroom", Timestamp: 1, CO2: 800},
+		},
+		GetLatestMeasurementsMock: mocks.GetLatestMeasurementsOkMock,
+	}
+	sensorsMock := mocks.SensorModelMock{
+		Sensors:           []models.Sensor{{ID: "bedroom"}},
+		GetAllSensorsMock: mocks.GetAllSensorsOkMock,
+		GetSensorMock:     mocks.GetSensorOkMock,
+	}
+
+	router := httprouter.New()
+	server := Server{
+		Router:       router,
+		Measurements: &measurementsMock,
+		Sensors:      &sensorsMock,
+		Metrics:      newServerMetrics(&measurementsMock, log.New(io.Discard, "", 0)),
+		LogError:     log.New(io.Discard, "", 0),
+		LogInfo:      log.New(io.Discard, "", 0),
+	}
+	server.routes()
+
+	ts := testserver.TestServer{Server: httptest.NewServer(router)}
+	defer ts.Server.Close()
+
+	ts.Get(t, "/api/sensors")
+	ts.Get(t, "/api/sensors/bedroom")
+	ts.Get(t, "/api/sensors/kitchen")
+
+	t.Run("requests by route", func(t *testing.T) {
+		data := []struct {
+			route    string
+			code     string
+			expected float64
+		}{
+			{"/api/sensors", "200", 1},
+			{"/api/sensors/:id", "200", 1},
+			{"/api/sensors/:id", "404", 1},
+		}
+
+		for _, d := range data {
+			if diff := cmp.Diff(d.expected, testutil.ToFloat64(server.Metrics.requests.WithLabelValues(d.route, http.MethodGet, d.code))); diff != "" {
+				t.Errorf("%s %s: %s", d.route, d.code, diff)
+			}
+		}
+	})
+
+	t.Run("latest readings", func(t *testing.T) {
+		expected := `
+# HELP airy_sensor_last_measurement_timestamp_seconds Unix timestamp of the latest measurement of a sensor.
+# TYPE airy_sensor_last_measurement_timestamp_seconds gauge
+airy_sensor_last_measurement_timestamp_seconds{sensor="bedroom"} 2
+airy_sensor_last_measurement_timestamp_seconds{sensor="livingroom"} 1
+# HELP airy_sensor_reading Latest measured value of a sensor metric.
+# TYPE airy_sensor_reading gauge
+airy_sensor_reading{metric="co2",sensor="bedroom"} 600
+airy_sensor_reading{metric="co2",sensor="livingroom"} 800
+airy_sensor_reading{metric="humidity",sensor="bedroom"} 45
+airy_sensor_reading{metric="humidity",sensor="livingroom"} 0
+airy_sensor_reading{metric="iaq",sensor="bedroom"} 50
+airy_sensor_reading{metric="iaq",sensor="livingroom"} 0
+airy_sensor_reading{metric="pressure",sensor="bedroom"} 100853
+airy_sensor_reading{metric="pressure",sensor="livingroom"} 0
+airy_sensor_reading{metric="temperature",sensor="bedroom"} 21.5
+airy_sensor_reading{metric="temperature",sensor="livingroom"} 0
+airy_sensor_reading{metric="voc",sensor="bedroom"} 0.5
+airy_sensor_reading{metric="voc",sensor="livingroom"} 0
+`
+		err := testutil.GatherAndCompare(server.Metrics.registry, strings.NewReader(expected), "airy_sensor_reading", "airy_sensor_last_measurement_timestamp_seconds")
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("exposition", func(t *testing.T) {
+		statusCode, _, body := ts.Get(t, "/metrics")
+
+		if diff := cmp.Diff(http.StatusOK, statusCode); diff != "" {
+			t.Error(diff)
+		}
+
+		if !strings.Contains(string(body), `airy_server_requests_total{code="404",method="GET",route="/api/sensors/:id"} 1`) {
+			t.Errorf("expected request count in %s", body)
+		}
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		measurementsMock.GetLatestMeasurementsMock = func(*[]models.Measurement) ([]models.Measurement, error) {
+			return nil, errors.New("connection refused")
+		}
+
+		statusCode, _, body := ts.Get(t, "/metrics")
+
+		if diff := cmp.Diff(http.StatusOK, statusCode); diff != "" {
+			t.Error(diff)
+		}
+
+		if strings.Contains(string(body), "airy_sensor_reading") || !strings.Contains(string(body), "airy_server_requests_total") {
+			t.Errorf("expected request metrics without readings in %s", body)
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// serve serves HTTP requests on l until ctx is done, then shuts the server down gracefully:
+// the listener is closed and in-flight requests are given shutdownTimeout to complete.
+func serve(ctx context.Context, srv *http.Server, l net.Listener, shutdownTimeout time.Duration) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.Serve(l)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	err := srv.Shutdown(shutdownCtx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		// requests which did not complete in time are aborted
+		srv.Close()
+	}
+
+	if serveErr := <-errs; !errors.Is(serveErr, http.ErrServerClosed) {
+		return serveErr
+	}
+
+	return err
+}
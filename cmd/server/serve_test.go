@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_serve(t *testing.T) {
+	data := []struct {
+		name            string
+		requestDuration time.Duration
+		shutdownTimeout time.Duration
+		expectedBody    string
+		expectedErr     error
+	}{
+		{"in-flight request completes", 50 * time.Millisecond, time.Second, "done", nil},
+		{"in-flight request exceeds the shutdown timeout", time.Second, 10 * time.Millisecond, "", context.DeadlineExceeded},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				started := make(chan struct{})
+				srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					close(started)
+					select {
+					case <-time.After(d.requestDuration):
+						w.Write([]byte("done"))
+					case <-r.Context().Done():
+					}
+				})}
+
+				l, err := net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				ctx, cancel := context.WithCancel(context.Background())
+				served := make(chan error, 1)
+				go func() {
+					served <- serve(ctx, srv, l, d.shutdownTimeout)
+				}()
+
+				bodies := make(chan string, 1)
+				go func() {
+					res, err := http.Get("http://" + l.Addr().String())
+					if err != nil {
+						bodies <- ""
+						return
+					}
+					defer res.Body.Close()
+					body, _ := io.ReadAll(res.Body)
+					bodies <- string(body)
+				}()
+
+				<-started
+				cancel()
+
+				if err := <-served; !errors.Is(err, d.expectedErr) {
+					t.Errorf("expected %v, got %v", d.expectedErr, err)
+				}
+
+				if diff := cmp.Diff(d.expectedBody, <-bodies); diff != "" {
+					t.Error(diff)
+				}
+
+				// the listener is closed once the server is shut down
+				if _, err := net.Dial("tcp", l.Addr().String()); err == nil {
+					t.Error("expected the listener to be closed")
+				}
+			},
+		)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,9 +10,12 @@ import (
 	"net/http"
 	"runtime/debug"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/miselaytes-anton/airy/internal/comfort"
+	"github.com/miselaytes-anton/airy/internal/config"
 	models "github.com/miselaytes-anton/airy/internal/models"
 )
 
@@ -20,10 +24,30 @@ type Server struct {
 	Router interface {
 		HandlerFunc(string, string, http.HandlerFunc)
 	}
+	// DB is pinged by the readiness check.
+	DB interface {
+		PingContext(ctx context.Context) error
+	}
 	Measurements models.MeasurementModelInterface
 	Events       models.EventModelInterface
-	LogError     *log.Logger
-	LogInfo      *log.Logger
+	DeadLetters  models.DeadLetterModelInterface
+	Sensors      models.SensorModelInterface
+	AlertRules   models.AlertRuleModelInterface
+	Alerts       models.AlertModelInterface
+	// OfflineAfter is how long a sensor may be silent before it is shown as offline.
+	OfflineAfter time.Duration
+	// Location is the timezone days are shown in.
+	Location *time.Location
+	Views    config.ViewsConfig
+	// Bands are drawn behind the graphs.
+	Bands comfort.Bands
+	// WriteTimeout is the write timeout of the HTTP server, exports extend it before every write,
+	// so that it limits how long a write may stall rather than the whole export.
+	WriteTimeout time.Duration
+	// Metrics are served on /metrics, requests are not instrumented when it is nil.
+	Metrics  *serverMetrics
+	LogError *log.Logger
+	LogInfo  *log.Logger
 }
 
 type ResponseError struct {
@@ -33,11 +57,38 @@ type ResponseError struct {
 
 // StartServer starts the http server.
 func (s Server) routes() {
-	s.Router.HandlerFunc(http.MethodGet, "/api/graphs", s.handleGraphs())
-	s.Router.HandlerFunc(http.MethodGet, "/api/events", s.handleEventsList())
-	s.Router.HandlerFunc(http.MethodPost, "/api/events", s.handleEventsCreate())
-	s.Router.HandlerFunc(http.MethodPatch, "/api/events/:id", s.handleEventsUpdate())
-	s.Router.HandlerFunc(http.MethodGet, "/api/measurements", s.handleMeasurements())
+	if s.Metrics != nil {
+		s.Router.HandlerFunc(http.MethodGet, "/metrics", s.Metrics.handler())
+	}
+	s.route(http.MethodGet, "/healthz", s.handleHealthz())
+	s.route(http.MethodGet, "/readyz", s.handleReadyz())
+	s.route(http.MethodGet, "/api/graphs", s.handleGraphs())
+	s.route(http.MethodGet, "/api/graphs/:image", s.handleGraphsImage())
+	s.route(http.MethodGet, "/dashboard", s.handleDashboard())
+	s.route(http.MethodGet, "/api/events", s.handleEventsList())
+	s.route(http.MethodPost, "/api/events", s.handleEventsCreate())
+	s.route(http.MethodPatch, "/api/events/:id", s.handleEventsUpdate())
+	s.route(http.MethodGet, "/api/measurements", s.handleMeasurements())
+	s.route(http.MethodGet, "/api/dead-letters", s.handleDeadLettersList())
+	s.route(http.MethodGet, "/api/sensors", s.handleSensorsList())
+	s.route(http.MethodPost, "/api/sensors", s.handleSensorsCreate())
+	// also serves /api/sensors/status, httprouter does not allow a static segment next to a parameter
+	s.route(http.MethodGet, "/api/sensors/:id", s.handleSensorsGet())
+	s.route(http.MethodPatch, "/api/sensors/:id", s.handleSensorsUpdate())
+	s.route(http.MethodDelete, "/api/sensors/:id", s.handleSensorsDelete())
+	s.route(http.MethodGet, "/api/alerts", s.handleAlertsList())
+	s.route(http.MethodGet, "/api/alerts/rules", s.handleAlertRulesList())
+	s.route(http.MethodPost, "/api/alerts/rules", s.handleAlertRulesCreate())
+	s.route(http.MethodPatch, "/api/alerts/rules/:id", s.handleAlertRulesUpdate())
+	s.route(http.MethodDelete, "/api/alerts/rules/:id", s.handleAlertRulesDelete())
+}
+
+// route registers a handler, instrumented with request metrics when they are enabled.
+func (s Server) route(method string, path string, h http.HandlerFunc) {
+	if s.Metrics != nil {
+		h = s.Metrics.instrument(method, path, h)
+	}
+	s.Router.HandlerFunc(method, path, h)
 }
 
 func (s Server) jsonError(w http.ResponseWriter, err error, code int) {
@@ -0,0 +1,65 @@
+// Package comfort defines reference bands of the measured metrics, such as the BSEC IAQ categories or a comfortable humidity.
+//
+// The bands are drawn behind the graphs and classify values, e.g. in alert notifications, so that both always agree.
+package comfort
+
+// Band is a named range of values of a metric. Min is included and Max is excluded, a missing bound is open.
+type Band struct {
+	Metric string   `yaml:"metric" json:"metric" validate:"oneof=iaq co2 voc pressure temperature humidity"`
+	Name   string   `yaml:"name" json:"name" validate:"required"`
+	Min    *float64 `yaml:"min,omitempty" json:"min,omitempty"`
+	Max    *float64 `yaml:"max,omitempty" json:"max,omitempty"`
+	// Color is a CSS color the band is shaded with, e.g. #00e400.
+	Color string `yaml:"color" json:"color" validate:"iscolor"`
+}
+
+// Contains reports whether the value is within the band.
+func (b Band) Contains(value float64) bool {
+	return (b.Min == nil || value >= *b.Min) && (b.Max == nil || value < *b.Max)
+}
+
+// Bands is a list of bands of any metrics.
+type Bands []Band
+
+// Metric returns the bands of the metric in their original order.
+func (b Bands) Metric(metric string) Bands {
+	result := make(Bands, 0)
+	for _, band := range b {
+		if band.Metric == metric {
+			result = append(result, band)
+		}
+	}
+	return result
+}
+
+// Classify returns the first band of the metric which contains the value.
+func (b Bands) Classify(metric string, value float64) (Band, bool) {
+	for _, band := range b {
+		if band.Metric == metric && band.Contains(value) {
+			return band, true
+		}
+	}
+	return Band{}, false
+}
+
+func bound(value float64) *float64 {
+	return &value
+}
+
+// Default returns the BSEC IAQ categories, CO2 levels, and comfortable humidity and temperature ranges.
+func Default() Bands {
+	return Bands{
+		{Metric: "iaq", Name: "excellent", Max: bound(50), Color: "#00e400"},
+		{Metric: "iaq", Name: "good", Min: bound(50), Max: bound(100), Color: "#92d050"},
+		{Metric: "iaq", Name: "lightly polluted", Min: bound(100), Max: bound(150), Color: "#ffff00"},
+		{Metric: "iaq", Name: "moderately polluted", Min: bound(150), Max: bound(200), Color: "#ff7e00"},
+		{Metric: "iaq", Name: "heavily polluted", Min: bound(200), Max: bound(250), Color: "#ff0000"},
+		{Metric: "iaq", Name: "severely polluted", Min: bound(250), Max: bound(350), Color: "#99004c"},
+		{Metric: "iaq", Name: "extremely polluted", Min: bound(350), Color: "#663300"},
+		{Metric: "co2", Name: "good", Max: bound(800), Color: "#00e400"},
+		{Metric: "co2", Name: "moderate", Min: bound(800), Max: bound(1200), Color: "#ffff00"},
+		{Metric: "co2", Name: "poor", Min: bound(1200), Color: "#ff0000"},
+		{Metric: "humidity", Name: "comfortable", Min: bound(40), Max: bound(60), Color: "#00e400"},
+		{Metric: "temperature", Name: "comfortable", Min: bound(20), Max: bound(24), Color: "#00e400"},
+	}
+}
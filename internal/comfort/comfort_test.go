@@ -0,0 +1,47 @@
+package comfort
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_Bands_Classify(t *testing.T) {
+	data := []struct {
+		name     string
+		metric   string
+		value    float64
+		expected string
+		ok       bool
+	}{
+		{"open lower bound", "iaq", 0, "excellent", true},
+		{"min is included", "iaq", 50, "good", true},
+		{"max is excluded", "co2", 1199.9, "moderate", true},
+		{"open upper bound", "co2", 5000, "poor", true},
+		{"outside of all bands", "humidity", 65, "", false},
+		{"metric without bands", "voc", 1, "", false},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				band, ok := Default().Classify(d.metric, d.value)
+				if diff := cmp.Diff([]interface{}{d.expected, d.ok}, []interface{}{band.Name, ok}); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
+
+func Test_Bands_Metric(t *testing.T) {
+	names := make([]string, 0)
+	for _, band := range Default().Metric("co2") {
+		names = append(names, band.Name)
+	}
+
+	if diff := cmp.Diff([]string{"good", "moderate", "poor"}, names); diff != "" {
+		t.Error(diff)
+	}
+}
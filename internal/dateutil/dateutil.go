@@ -2,12 +2,22 @@ package dateutil
 
 import "time"
 
+// GetStartOfDay returns the first instant of the calendar day of t in the location.
+// On days where a DST transition skips midnight, e.g. in America/Santiago, the day starts when the clocks are set forward.
 func GetStartOfDay(t time.Time, location *time.Location) time.Time {
-	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+	return startOfDate(t.Year(), t.Month(), t.Day(), location)
 }
 
+// GetEndOfDay returns the last second of the calendar day of t in the location,
+// the day is 23 or 25 hours long on DST transition days.
 func GetEndOfDay(t time.Time, location *time.Location) time.Time {
-	return time.Date(t.Year(), t.Month(), t.Day(), 23, 59, 59, 0, location)
+	return startOfDate(t.Year(), t.Month(), t.Day()+1, location).Add(-time.Second)
+}
+
+// AddDate returns the start of the calendar day which is the given years, months and days away from the day of t in the location.
+// Like time.AddDate it normalizes overflowing days, one month before March 31 is March 3.
+func AddDate(t time.Time, years int, months int, days int, location *time.Location) time.Time {
+	return startOfDate(t.Year()+years, t.Month()+time.Month(months), t.Day()+days, location)
 }
 
 func IsDateEqual(date1, date2 time.Time) bool {
@@ -16,3 +26,15 @@ func IsDateEqual(date1, date2 time.Time) bool {
 
 	return y1 == y2 && m1 == m2 && d1 == d2
 }
+
+func startOfDate(year int, month time.Month, day int, location *time.Location) time.Time {
+	start := time.Date(year, month, day, 0, 0, 0, 0, location)
+	noon := time.Date(year, month, day, 12, 0, 0, 0, location)
+
+	// midnight does not exist and was normalized into the previous day, the day starts where that zone ends
+	if start.YearDay() != noon.YearDay() {
+		_, start = start.ZoneBounds()
+	}
+
+	return start
+}
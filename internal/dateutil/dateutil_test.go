@@ -0,0 +1,99 @@
+package dateutil
+
+import (
+	"testing"
+	"time"
+	// timezones are loaded from the embedded database, so the tests do not depend on the host
+	_ "time/tzdata"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_dayBoundaries(t *testing.T) {
+	data := []struct {
+		name          string
+		timezone      string
+		date          time.Time
+		expectedStart string
+		expectedEnd   string
+		expectedWeek  string
+	}{
+		{
+			"regular day",
+			"Europe/Amsterdam",
+			time.Date(2023, 6, 15, 0, 0, 0, 0, time.UTC),
+			"2023-06-15T00:00:00+02:00",
+			"2023-06-15T23:59:59+02:00",
+			"2023-06-08T00:00:00+02:00",
+		},
+		{
+			"clocks set forward",
+			"Europe/Amsterdam",
+			time.Date(2023, 3, 26, 0, 0, 0, 0, time.UTC),
+			"2023-03-26T00:00:00+01:00",
+			"2023-03-26T23:59:59+02:00",
+			"2023-03-19T00:00:00+01:00",
+		},
+		{
+			"clocks set back",
+			"Europe/Amsterdam",
+			time.Date(2023, 10, 29, 0, 0, 0, 0, time.UTC),
+			"2023-10-29T00:00:00+02:00",
+			"2023-10-29T23:59:59+01:00",
+			"2023-10-22T00:00:00+02:00",
+		},
+		{
+			"week across a transition",
+			"America/New_York",
+			time.Date(2023, 3, 15, 0, 0, 0, 0, time.UTC),
+			"2023-03-15T00:00:00-04:00",
+			"2023-03-15T23:59:59-04:00",
+			"2023-03-08T00:00:00-05:00",
+		},
+		{
+			"midnight skipped",
+			"America/Santiago",
+			time.Date(2022, 9, 11, 0, 0, 0, 0, time.UTC),
+			"2022-09-11T01:00:00-03:00",
+			"2022-09-11T23:59:59-03:00",
+			"2022-09-04T00:00:00-04:00",
+		},
+		{
+			"day before midnight is skipped",
+			"America/Santiago",
+			time.Date(2022, 9, 10, 0, 0, 0, 0, time.UTC),
+			"2022-09-10T00:00:00-04:00",
+			"2022-09-10T23:59:59-04:00",
+			"2022-09-03T00:00:00-04:00",
+		},
+		{
+			"midnight repeated",
+			"America/Santiago",
+			time.Date(2022, 4, 3, 0, 0, 0, 0, time.UTC),
+			"2022-04-03T00:00:00-04:00",
+			"2022-04-03T23:59:59-04:00",
+			"2022-03-27T00:00:00-03:00",
+		},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				location, err := time.LoadLocation(d.timezone)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				actual := []string{
+					GetStartOfDay(d.date, location).Format(time.RFC3339),
+					GetEndOfDay(d.date, location).Format(time.RFC3339),
+					AddDate(d.date, 0, 0, -7, location).Format(time.RFC3339),
+				}
+				if diff := cmp.Diff([]string{d.expectedStart, d.expectedEnd, d.expectedWeek}, actual); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
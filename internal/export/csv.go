@@ -0,0 +1,59 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+)
+
+// csvWriter writes a header with the column names and a row per measurement.
+type csvWriter struct {
+	w       *csv.Writer
+	columns []string
+	row     []string
+	header  bool
+}
+
+func newCSVWriter(w io.Writer, columns []string) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w), columns: columns, row: make([]string, len(columns))}
+}
+
+func (c *csvWriter) writeHeader() error {
+	if c.header {
+		return nil
+	}
+	c.header = true
+
+	return c.w.Write(c.columns)
+}
+
+func (c *csvWriter) Write(m models.Measurement) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+
+	for i, column := range c.columns {
+		switch v := value(m, column).(type) {
+		case float64:
+			c.row[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case nil:
+			c.row[i] = ""
+		default:
+			c.row[i] = fmt.Sprint(v)
+		}
+	}
+
+	return c.w.Write(c.row)
+}
+
+func (c *csvWriter) Close() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,145 @@
+// Package export writes measurements as JSON, newline-delimited JSON, CSV or Parquet.
+//
+// Measurements are written one at a time, so that an export can be streamed from the database
+// without holding the whole result in memory.
+package export
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+)
+
+// Export formats.
+const (
+	FormatJSON    = "json"
+	FormatNDJSON  = "ndjson"
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+)
+
+// ContentTypes are the media types of the formats.
+var ContentTypes = map[string]string{
+	FormatJSON:    "application/json",
+	FormatNDJSON:  "application/x-ndjson",
+	FormatCSV:     "text/csv; charset=utf-8",
+	FormatParquet: "application/vnd.apache.parquet",
+}
+
+// Column names besides the metrics.
+const (
+	ColumnTimestamp = "timestamp"
+	ColumnSensorID  = "sensorId"
+)
+
+// Writer writes measurements, Close must be called to complete the output.
+type Writer interface {
+	Write(models.Measurement) error
+	Close() error
+}
+
+// Columns returns the timestamp, the sensor id and the given metrics, all metrics when none are given.
+func Columns(metrics []string) []string {
+	if len(metrics) == 0 {
+		metrics = models.Metrics
+	}
+
+	return append([]string{ColumnTimestamp, ColumnSensorID}, metrics...)
+}
+
+// Suffixes of the columns of the lowest and highest values of a metric, see EnvelopeColumns.
+const (
+	SuffixMin = "Min"
+	SuffixMax = "Max"
+)
+
+// EnvelopeColumns returns the columns of Columns followed by the lowest and highest value of every metric,
+// e.g. co2, co2Min and co2Max, for measurements of models.AggregationEnvelope.
+func EnvelopeColumns(metrics []string) []string {
+	if len(metrics) == 0 {
+		metrics = models.Metrics
+	}
+
+	columns := []string{ColumnTimestamp, ColumnSensorID}
+	for _, metric := range metrics {
+		columns = append(columns, metric, metric+SuffixMin, metric+SuffixMax)
+	}
+
+	return columns
+}
+
+// New returns a writer of the format which writes the columns of every measurement to w.
+func New(format string, w io.Writer, columns []string) (Writer, error) {
+	for _, column := range columns {
+		if column == ColumnTimestamp || column == ColumnSensorID {
+			continue
+		}
+		if _, ok := (models.Measurement{}).Metric(trimSuffix(column)); !ok {
+			return nil, fmt.Errorf("unknown column %s", column)
+		}
+	}
+
+	switch format {
+	case FormatJSON:
+		return newJSONWriter(w, columns, false), nil
+	case FormatNDJSON:
+		return newJSONWriter(w, columns, true), nil
+	case FormatCSV:
+		return newCSVWriter(w, columns), nil
+	case FormatParquet:
+		return newParquetWriter(w, columns)
+	}
+
+	return nil, fmt.Errorf("unknown format %s", format)
+}
+
+// Negotiate returns the first format accepted by the Accept header, false when none of them is accepted.
+// Quality values are not taken into account, clients which need a specific format can ask for it explicitly.
+func Negotiate(accept string) (string, bool) {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		for format, contentType := range ContentTypes {
+			if t, _, _ := mime.ParseMediaType(contentType); t == mediaType {
+				return format, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// value returns the value of the column, the column is known to exist. Metrics without a value are nil.
+func value(m models.Measurement, column string) interface{} {
+	switch column {
+	case ColumnTimestamp:
+		return m.Timestamp
+	case ColumnSensorID:
+		return m.SensorID
+	}
+
+	// the bounds of measurements which are not aggregated as an envelope are the measurement itself
+	switch {
+	case strings.HasSuffix(column, SuffixMin) && m.Min != nil:
+		m = *m.Min
+	case strings.HasSuffix(column, SuffixMax) && m.Max != nil:
+		m = *m.Max
+	}
+
+	v, ok := m.Metric(trimSuffix(column))
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+// trimSuffix returns the metric of a column.
+func trimSuffix(column string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(column, SuffixMin), SuffixMax)
+}
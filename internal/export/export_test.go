@@ -0,0 +1,143 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+)
+
+var testMeasurements = []models.Measurement{
+	{Timestamp: 60, SensorID: "bedroom", IAQ: 150, CO2: 900.5, VOC: 6, Pressure: 760, Temperature: 20, Humidity: 50},
+	{Timestamp: 120, SensorID: "living room, 1st floor", IAQ: 25.25, CO2: 450, VOC: 0.5, Pressure: 761, Temperature: 21.5, Humidity: 45},
+}
+
+func writeAll(t *testing.T, format string, columns []string, measurements []models.Measurement) []byte {
+	var buf bytes.Buffer
+
+	w, err := New(format, &buf, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range measurements {
+		if err := w.Write(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func Test_jsonWriter(t *testing.T) {
+	var expected bytes.Buffer
+	json.NewEncoder(&expected).Encode(testMeasurements)
+
+	data := []struct {
+		name         string
+		format       string
+		columns      []string
+		measurements []models.Measurement
+		expected     string
+	}{
+		{"same as encoding measurements", FormatJSON, Columns(nil), testMeasurements, expected.String()},
+		{"empty", FormatJSON, Columns(nil), nil, "[]\n"},
+		{"columns", FormatJSON, Columns([]string{"co2"}), testMeasurements, `[{"timestamp":60,"sensorId":"bedroom","co2":900.5},{"timestamp":120,"sensorId":"living room, 1st floor","co2":450}]` + "\n"},
+		{"newline delimited", FormatNDJSON, Columns([]string{"voc", "iaq"}), testMeasurements, `{"timestamp":60,"sensorId":"bedroom","voc":6,"iaq":150}` + "\n" + `{"timestamp":120,"sensorId":"living room, 1st floor","voc":0.5,"iaq":25.25}` + "\n"},
+		{"newline delimited, empty", FormatNDJSON, Columns(nil), nil, ""},
+		{"missing metrics", FormatNDJSON, Columns([]string{"co2", "voc"}), []models.Measurement{{Timestamp: 60, SensorID: "bedroom", CO2: 900.5, Missing: []string{"voc"}}}, `{"timestamp":60,"sensorId":"bedroom","co2":900.5,"voc":null}` + "\n"},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				if diff := cmp.Diff(d.expected, string(writeAll(t, d.format, d.columns, d.measurements))); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
+
+func Test_csvWriter(t *testing.T) {
+	data := []struct {
+		name         string
+		columns      []string
+		measurements []models.Measurement
+		expected     string
+	}{
+		{"all columns", Columns(nil), testMeasurements, "timestamp,sensorId,iaq,co2,voc,pressure,temperature,humidity\n60,bedroom,150,900.5,6,760,20,50\n120,\"living room, 1st floor\",25.25,450,0.5,761,21.5,45\n"},
+		{"columns", Columns([]string{"humidity"}), testMeasurements[:1], "timestamp,sensorId,humidity\n60,bedroom,50\n"},
+		{"empty", Columns(nil), nil, "timestamp,sensorId,iaq,co2,voc,pressure,temperature,humidity\n"},
+		{"missing metrics", Columns([]string{"co2", "voc"}), []models.Measurement{{Timestamp: 60, SensorID: "bedroom", CO2: 900.5, Missing: []string{"voc"}}}, "timestamp,sensorId,co2,voc\n60,bedroom,900.5,\n"},
+		{"envelope", EnvelopeColumns([]string{"co2"}), []models.Measurement{{Timestamp: 60, SensorID: "bedroom", CO2: 900.5, Min: &models.Measurement{CO2: 400}, Max: &models.Measurement{CO2: 1200}}}, "timestamp,sensorId,co2,co2Min,co2Max\n60,bedroom,900.5,400,1200\n"},
+		{"envelope without bounds", EnvelopeColumns([]string{"co2"}), testMeasurements[:1], "timestamp,sensorId,co2,co2Min,co2Max\n60,bedroom,900.5,900.5,900.5\n"},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				if diff := cmp.Diff(d.expected, string(writeAll(t, FormatCSV, d.columns, d.measurements))); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
+
+func Test_New_errors(t *testing.T) {
+	data := []struct {
+		name    string
+		format  string
+		columns []string
+	}{
+		{"unknown format", "xml", Columns(nil)},
+		{"unknown column", FormatCSV, Columns([]string{"radon"})},
+		{"unknown envelope column", FormatCSV, EnvelopeColumns([]string{"radon"})},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				if _, err := New(d.format, &bytes.Buffer{}, d.columns); err == nil {
+					t.Error("expected an error")
+				}
+			},
+		)
+	}
+}
+
+func Test_Negotiate(t *testing.T) {
+	data := []struct {
+		accept   string
+		expected string
+		ok       bool
+	}{
+		{"text/csv", FormatCSV, true},
+		{"application/x-ndjson", FormatNDJSON, true},
+		{"text/html, application/vnd.apache.parquet;q=0.9", FormatParquet, true},
+		{"application/json; charset=utf-8", FormatJSON, true},
+		{"*/*", "", false},
+		{"", "", false},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.accept,
+			func(t *testing.T) {
+				format, ok := Negotiate(d.accept)
+				if diff := cmp.Diff([]interface{}{d.expected, d.ok}, []interface{}{format, ok}); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
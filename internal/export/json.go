@@ -0,0 +1,73 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+)
+
+// jsonWriter writes a JSON array of objects, or one object per line, with the keys in the order of the columns.
+type jsonWriter struct {
+	w         *bufio.Writer
+	columns   []string
+	delimited bool
+	count     int
+}
+
+func newJSONWriter(w io.Writer, columns []string, delimited bool) *jsonWriter {
+	return &jsonWriter{w: bufio.NewWriter(w), columns: columns, delimited: delimited}
+}
+
+func (j *jsonWriter) Write(m models.Measurement) error {
+	separator := ","
+	switch {
+	case j.delimited:
+		separator = ""
+	case j.count == 0:
+		separator = "["
+	}
+	j.count++
+
+	if _, err := j.w.WriteString(separator + "{"); err != nil {
+		return err
+	}
+
+	for i, column := range j.columns {
+		if i > 0 {
+			j.w.WriteByte(',')
+		}
+
+		key, _ := json.Marshal(column)
+		v, err := json.Marshal(value(m, column))
+		if err != nil {
+			return err
+		}
+
+		j.w.Write(key)
+		j.w.WriteByte(':')
+		j.w.Write(v)
+	}
+
+	if j.delimited {
+		_, err := j.w.WriteString("}\n")
+		return err
+	}
+
+	return j.w.WriteByte('}')
+}
+
+func (j *jsonWriter) Close() error {
+	if !j.delimited {
+		end := "]\n"
+		if j.count == 0 {
+			end = "[]\n"
+		}
+		if _, err := j.w.WriteString(end); err != nil {
+			return err
+		}
+	}
+
+	return j.w.Flush()
+}
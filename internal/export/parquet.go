@@ -0,0 +1,84 @@
+package export
+
+import (
+	"io"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+)
+
+// parquetRowGroupSize is the number of measurements buffered before they are written as a row group,
+// Parquet stores the values of a row group column by column.
+const parquetRowGroupSize = 64 * 1024
+
+// parquetColumns is the schema of the selected columns, parquet.Group orders its fields by name,
+// so the fields are returned in the order of the columns instead.
+type parquetColumns struct {
+	parquet.Group
+	columns []string
+}
+
+func (c parquetColumns) Fields() []parquet.Field {
+	byName := make(map[string]parquet.Field, len(c.columns))
+	for _, field := range c.Group.Fields() {
+		byName[field.Name()] = field
+	}
+
+	fields := make([]parquet.Field, 0, len(c.columns))
+	for _, column := range c.columns {
+		fields = append(fields, byName[column])
+	}
+	return fields
+}
+
+// parquetWriter writes an uncompressed Parquet file with a column per selected column.
+// The timestamp and the sensor id are required, metrics are optional since measurements can miss them.
+type parquetWriter struct {
+	w       *parquet.Writer
+	columns []string
+	row     *parquet.RowBuilder
+}
+
+func newParquetWriter(w io.Writer, columns []string) (*parquetWriter, error) {
+	schema := parquetColumns{Group: make(parquet.Group, len(columns)), columns: columns}
+	for _, column := range columns {
+		switch column {
+		case ColumnTimestamp:
+			schema.Group[column] = parquet.Int(64)
+		case ColumnSensorID:
+			schema.Group[column] = parquet.String()
+		default:
+			schema.Group[column] = parquet.Optional(parquet.Leaf(parquet.DoubleType))
+		}
+	}
+
+	config, err := parquet.NewWriterConfig(
+		parquet.NewSchema("measurements", schema),
+		parquet.Compression(&parquet.Uncompressed),
+		parquet.MaxRowsPerRowGroup(parquetRowGroupSize),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &parquetWriter{w: parquet.NewWriter(w, config), columns: columns, row: parquet.NewRowBuilder(schema)}, nil
+}
+
+func (p *parquetWriter) Write(m models.Measurement) error {
+	p.row.Reset()
+
+	// metrics without a value are left out of the row, which makes them null
+	for i, column := range p.columns {
+		if v := value(m, column); v != nil {
+			p.row.Add(i, parquet.ValueOf(v))
+		}
+	}
+
+	_, err := p.w.WriteRows([]parquet.Row{p.row.Row()})
+	return err
+}
+
+func (p *parquetWriter) Close() error {
+	return p.w.Close()
+}
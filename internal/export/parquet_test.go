@@ -0,0 +1,137 @@
+package export
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+)
+
+// readParquet returns the columns, the number of row groups and the values of the columns of a file,
+// missing values are nil.
+func readParquet(t *testing.T, file []byte) ([]string, int, map[string][]interface{}) {
+	f, err := parquet.OpenFile(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	columns := make([]string, 0)
+	for _, field := range f.Schema().Fields() {
+		columns = append(columns, field.Name())
+	}
+
+	values := make(map[string][]interface{})
+	for _, rowGroup := range f.RowGroups() {
+		rows := rowGroup.Rows()
+		buf := make([]parquet.Row, 100)
+		for {
+			n, err := rows.ReadRows(buf)
+			for _, row := range buf[:n] {
+				for _, v := range row {
+					column := columns[v.Column()]
+					switch {
+					case v.IsNull():
+						values[column] = append(values[column], nil)
+					case v.Kind() == parquet.Int64:
+						values[column] = append(values[column], v.Int64())
+					case v.Kind() == parquet.Double:
+						values[column] = append(values[column], v.Double())
+					default:
+						values[column] = append(values[column], string(v.ByteArray()))
+					}
+				}
+			}
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		rows.Close()
+	}
+
+	return columns, len(f.RowGroups()), values
+}
+
+func Test_parquetWriter(t *testing.T) {
+	measurements := make([]models.Measurement, 0)
+	for i := 0; i < parquetRowGroupSize+2; i++ {
+		measurements = append(measurements, testMeasurements[i%2])
+	}
+	missing := models.Measurement{Timestamp: 180, SensorID: "bedroom", Missing: []string{"co2"}}
+	measurements = append(measurements, missing, missing, testMeasurements[1])
+
+	columns, rowGroups, values := readParquet(t, writeAll(t, FormatParquet, Columns([]string{"co2"}), measurements))
+
+	// the columns keep the selected order
+	if diff := cmp.Diff([]string{"timestamp", "sensorId", "co2"}, columns); diff != "" {
+		t.Error(diff)
+	}
+
+	if diff := cmp.Diff(2, rowGroups); diff != "" {
+		t.Error(diff)
+	}
+
+	last := len(measurements) - 1
+	if diff := cmp.Diff(
+		[]interface{}{int64(60), "bedroom", 900.5, int64(120), "living room, 1st floor", 450.0},
+		[]interface{}{values["timestamp"][0], values["sensorId"][0], values["co2"][0], values["timestamp"][last], values["sensorId"][last], values["co2"][last]},
+	); diff != "" {
+		t.Error(diff)
+	}
+
+	if diff := cmp.Diff([]interface{}{nil, nil, 450.0}, values["co2"][last-2:]); diff != "" {
+		t.Error(diff)
+	}
+
+	for column, v := range values {
+		if len(v) != len(measurements) {
+			t.Errorf("expected %d values of %s, got %d", len(measurements), column, len(v))
+		}
+	}
+}
+
+func Test_parquetWriter_envelope(t *testing.T) {
+	m := models.Measurement{Timestamp: 60, SensorID: "bedroom", CO2: 900, Min: &models.Measurement{CO2: 800}, Max: &models.Measurement{CO2: 1100}}
+
+	columns, _, values := readParquet(t, writeAll(t, FormatParquet, EnvelopeColumns([]string{"co2"}), []models.Measurement{m}))
+
+	if diff := cmp.Diff([]string{"timestamp", "sensorId", "co2", "co2Min", "co2Max"}, columns); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([]interface{}{900.0, 800.0, 1100.0}, []interface{}{values["co2"][0], values["co2Min"][0], values["co2Max"][0]}); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_parquetWriter_empty(t *testing.T) {
+	columns, rowGroups, values := readParquet(t, writeAll(t, FormatParquet, Columns(nil), nil))
+
+	if diff := cmp.Diff([]interface{}{Columns(nil), 0, 0}, []interface{}{columns, rowGroups, len(values)}); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_parquetWriter_schema(t *testing.T) {
+	file := writeAll(t, FormatParquet, Columns([]string{"co2"}), testMeasurements)
+
+	f, err := parquet.OpenFile(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `message measurements {
+	required int64 timestamp (INT(64,true));
+	required binary sensorId (STRING);
+	optional double co2;
+}`
+	if diff := cmp.Diff(expected, f.Schema().String()); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,182 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/lib/pq"
+)
+
+var ErrAlertRuleNotFound = errors.New("alert rule not found")
+
+func mapPostgresAlertRuleError(err error) error {
+	// an invalid uuid can not match any rule
+	pqErr, ok := err.(*pq.Error)
+	if ok && string(pqErr.Code) == pgerrcode.InvalidTextRepresentation {
+		return ErrAlertRuleNotFound
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrAlertRuleNotFound
+	}
+	return err
+}
+
+// Alert rule comparisons.
+const (
+	ComparisonAbove = "above"
+	ComparisonBelow = "below"
+)
+
+type AlertRuleModelInterface interface {
+	GetAll() ([]AlertRule, error)
+	Get(id string) (AlertRule, error)
+	InsertAlertRule(AlertRule) (AlertRule, error)
+	UpdateAlertRule(AlertRule) (AlertRule, error)
+	DeleteAlertRule(id string) error
+}
+
+// AlertRule describes when an alert fires: the metric of a sensor is above or below the threshold for at least duration seconds.
+// A firing alert resolves once the value is back by more than hysteresis, so that a value around the threshold does not flap.
+type AlertRule struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+	// SensorID is the sensor the rule applies to, all sensors when empty.
+	SensorID   string  `json:"sensorId"`
+	Metric     string  `json:"metric"`
+	Comparison string  `json:"comparison"`
+	Threshold  float64 `json:"threshold"`
+	// Duration is the number of seconds the threshold has to be breached before the alert fires.
+	Duration   int64   `json:"duration"`
+	Hysteresis float64 `json:"hysteresis"`
+}
+
+// Breached reports whether the value breaches the threshold of the rule.
+func (r AlertRule) Breached(value float64) bool {
+	if r.Comparison == ComparisonBelow {
+		return value < r.Threshold
+	}
+	return value > r.Threshold
+}
+
+// Recovered reports whether the value is back beyond the threshold and the hysteresis.
+func (r AlertRule) Recovered(value float64) bool {
+	if r.Comparison == ComparisonBelow {
+		return value > r.Threshold+r.Hysteresis
+	}
+	return value < r.Threshold-r.Hysteresis
+}
+
+// AppliesTo reports whether the rule applies to the sensor.
+func (r AlertRule) AppliesTo(sensorID string) bool {
+	return r.SensorID == "" || r.SensorID == sensorID
+}
+
+// String describes the rule, e.g. "co2 of bedroom above 1000".
+func (r AlertRule) String() string {
+	sensorID := r.SensorID
+	if sensorID == "" {
+		sensorID = "any sensor"
+	}
+	return fmt.Sprintf("%s of %s %s %g", r.Metric, sensorID, r.Comparison, r.Threshold)
+}
+
+// AlertRuleModel represents an alert rule model.
+type AlertRuleModel struct {
+	DB *sql.DB
+}
+
+const alertRuleColumns = `id, name, sensor_id, metric, comparison, threshold, duration, hysteresis`
+
+func scanAlertRule(row interface{ Scan(...any) error }) (AlertRule, error) {
+	var r AlertRule
+	err := row.Scan(&r.ID, &r.Name, &r.SensorID, &r.Metric, &r.Comparison, &r.Threshold, &r.Duration, &r.Hysteresis)
+	return r, err
+}
+
+// GetAll returns all alert rules.
+func (m AlertRuleModel) GetAll() ([]AlertRule, error) {
+	rows, err := m.DB.Query(`select ` + alertRuleColumns + ` from "alert_rules" order by name asc, id asc`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	rules := make([]AlertRule, 0)
+
+	for rows.Next() {
+		r, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+
+	return rules, rows.Err()
+}
+
+// Get returns a single alert rule.
+func (m AlertRuleModel) Get(id string) (AlertRule, error) {
+	r, err := scanAlertRule(m.DB.QueryRow(`select `+alertRuleColumns+` from "alert_rules" where id = $1`, id))
+	if err != nil {
+		return AlertRule{}, mapPostgresAlertRuleError(err)
+	}
+
+	return r, nil
+}
+
+// InsertAlertRule inserts a new alert rule.
+func (m AlertRuleModel) InsertAlertRule(r AlertRule) (AlertRule, error) {
+	query := `insert into "alert_rules"("name", "sensor_id", "metric", "comparison", "threshold", "duration", "hysteresis")
+		values($1, $2, $3, $4, $5, $6, $7) returning id`
+
+	err := m.DB.QueryRow(query, r.Name, r.SensorID, r.Metric, r.Comparison, r.Threshold, r.Duration, r.Hysteresis).Scan(&r.ID)
+	if err != nil {
+		return AlertRule{}, err
+	}
+
+	return r, nil
+}
+
+// UpdateAlertRule updates an alert rule.
+func (m AlertRuleModel) UpdateAlertRule(r AlertRule) (AlertRule, error) {
+	query := `update "alert_rules" set
+			"name" = $2,
+			"sensor_id" = $3,
+			"metric" = $4,
+			"comparison" = $5,
+			"threshold" = $6,
+			"duration" = $7,
+			"hysteresis" = $8
+			where "id" = $1
+			returning ` + alertRuleColumns
+
+	r, err := scanAlertRule(m.DB.QueryRow(query, r.ID, r.Name, r.SensorID, r.Metric, r.Comparison, r.Threshold, r.Duration, r.Hysteresis))
+	if err != nil {
+		return AlertRule{}, mapPostgresAlertRuleError(err)
+	}
+
+	return r, nil
+}
+
+// DeleteAlertRule deletes an alert rule together with its alerts.
+func (m AlertRuleModel) DeleteAlertRule(id string) error {
+	result, err := m.DB.Exec(`delete from "alert_rules" where "id" = $1`, id)
+	if err != nil {
+		return mapPostgresAlertRuleError(err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrAlertRuleNotFound
+	}
+
+	return nil
+}
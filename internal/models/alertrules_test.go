@@ -0,0 +1,65 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_AlertRule(t *testing.T) {
+	above := AlertRule{Comparison: ComparisonAbove, Threshold: 1000, Hysteresis: 50}
+	below := AlertRule{Comparison: ComparisonBelow, Threshold: 30, Hysteresis: 5}
+
+	data := []struct {
+		name              string
+		rule              AlertRule
+		value             float64
+		expectedBreached  bool
+		expectedRecovered bool
+	}{
+		{"above: over threshold", above, 1001, true, false},
+		{"above: at threshold", above, 1000, false, false},
+		{"above: within hysteresis", above, 960, false, false},
+		{"above: beyond hysteresis", above, 949, false, true},
+		{"below: under threshold", below, 29, true, false},
+		{"below: within hysteresis", below, 34, false, false},
+		{"below: beyond hysteresis", below, 36, false, true},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				if diff := cmp.Diff([]bool{d.expectedBreached, d.expectedRecovered}, []bool{d.rule.Breached(d.value), d.rule.Recovered(d.value)}); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
+
+func Test_Measurement_Metric(t *testing.T) {
+	m := Measurement{IAQ: 1, CO2: 2, VOC: 3, Pressure: 4, Temperature: 5, Humidity: 6}
+
+	values := make([]float64, 0)
+	for _, metric := range Metrics {
+		value, ok := m.Metric(metric)
+		if !ok {
+			t.Errorf("unknown metric %s", metric)
+		}
+		values = append(values, value)
+	}
+
+	if diff := cmp.Diff([]float64{1, 2, 3, 4, 5, 6}, values); diff != "" {
+		t.Error(diff)
+	}
+
+	if _, ok := m.Metric("noise"); ok {
+		t.Error("expected noise to be unknown")
+	}
+
+	m.Missing = []string{"voc"}
+	if _, ok := m.Metric("voc"); ok {
+		t.Error("expected voc to be missing")
+	}
+}
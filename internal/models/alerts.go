@@ -0,0 +1,151 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/lib/pq"
+)
+
+var ErrAlertAlreadyFiring = errors.New("alert for this rule and sensor is already firing")
+var ErrAlertNotFound = errors.New("alert not found")
+
+func mapPostgresAlertError(err error) error {
+	// check for a postgres duplicate key error using error code
+	// https://www.postgresql.org/docs/9.5/errcodes-appendix.html
+	pqErr, ok := err.(*pq.Error)
+	if ok && string(pqErr.Code) == pgerrcode.UniqueViolation {
+		return ErrAlertAlreadyFiring
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrAlertNotFound
+	}
+	return err
+}
+
+// Alert statuses.
+const (
+	AlertStatusFiring   = "firing"
+	AlertStatusResolved = "resolved"
+)
+
+type AlertModelInterface interface {
+	GetAll(q AlertsQuery) ([]Alert, error)
+	GetFiring() ([]Alert, error)
+	FireAlert(Alert) (Alert, error)
+	ResolveAlert(id string, resolvedAt int64) error
+}
+
+// AlertsQuery represents a query for alerts which were firing at some point between StartEpoch and EndEpoch.
+type AlertsQuery struct {
+	StartEpoch, EndEpoch int64
+	// Status is either AlertStatusFiring or AlertStatusResolved, all alerts are returned when empty.
+	Status string
+}
+
+// Alert represents an instance of an alert rule firing for a sensor.
+type Alert struct {
+	ID       string `json:"id,omitempty"`
+	RuleID   string `json:"ruleId"`
+	SensorID string `json:"sensorId"`
+	Metric   string `json:"metric"`
+	// Value is the value which fired the alert.
+	Value      float64 `json:"value"`
+	Status     string  `json:"status"`
+	StartedAt  int64   `json:"startedAt"`
+	ResolvedAt int64   `json:"resolvedAt,omitempty"`
+}
+
+// AlertModel represents an alert model.
+type AlertModel struct {
+	DB *sql.DB
+}
+
+const alertColumns = `a.id, a.rule_id, a.sensor_id, r.metric, a.value, a.started_at, coalesce(a.resolved_at, 0)`
+
+func (m AlertModel) query(query string, args ...any) ([]Alert, error) {
+	rows, err := m.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	alerts := make([]Alert, 0)
+
+	for rows.Next() {
+		var a Alert
+		err := rows.Scan(&a.ID, &a.RuleID, &a.SensorID, &a.Metric, &a.Value, &a.StartedAt, &a.ResolvedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		a.Status = AlertStatusFiring
+		if a.ResolvedAt != 0 {
+			a.Status = AlertStatusResolved
+		}
+
+		alerts = append(alerts, a)
+	}
+
+	return alerts, rows.Err()
+}
+
+// GetAll returns alerts which were firing between StartEpoch and EndEpoch.
+func (m AlertModel) GetAll(q AlertsQuery) ([]Alert, error) {
+	query := `
+	select ` + alertColumns + ` from "alerts" a join "alert_rules" r on r.id = a.rule_id
+	where a.started_at <= $2 and (a.resolved_at is null or a.resolved_at >= $1)
+	and ($3::text = '' or ($3::text = 'firing') = (a.resolved_at is null))
+	order by a.started_at asc
+	`
+
+	return m.query(query, q.StartEpoch, q.EndEpoch, q.Status)
+}
+
+// GetFiring returns all alerts which are not resolved yet.
+func (m AlertModel) GetFiring() ([]Alert, error) {
+	query := `
+	select ` + alertColumns + ` from "alerts" a join "alert_rules" r on r.id = a.rule_id
+	where a.resolved_at is null
+	order by a.started_at asc
+	`
+
+	return m.query(query)
+}
+
+// FireAlert stores a new firing alert. Only one alert per rule and sensor can be firing at a time.
+func (m AlertModel) FireAlert(a Alert) (Alert, error) {
+	query := `insert into "alerts"("rule_id", "sensor_id", "value", "started_at") values($1, $2, $3, $4) returning id`
+
+	err := m.DB.QueryRow(query, a.RuleID, a.SensorID, a.Value, a.StartedAt).Scan(&a.ID)
+	if err != nil {
+		return Alert{}, mapPostgresAlertError(err)
+	}
+
+	a.Status = AlertStatusFiring
+	a.ResolvedAt = 0
+
+	return a, nil
+}
+
+// ResolveAlert marks a firing alert as resolved.
+func (m AlertModel) ResolveAlert(id string, resolvedAt int64) error {
+	result, err := m.DB.Exec(`update "alerts" set "resolved_at" = $2 where "id" = $1 and "resolved_at" is null`, id, resolvedAt)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrAlertNotFound
+	}
+
+	return nil
+}
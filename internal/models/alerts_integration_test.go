@@ -0,0 +1,84 @@
+//go:build integration
+
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_AlertModel(t *testing.T) {
+	db := newTestDB(t)
+	rules := AlertRuleModel{DB: db}
+	model := AlertModel{DB: db}
+
+	rule, err := rules.InsertAlertRule(AlertRule{SensorID: "bedroom", Metric: "co2", Comparison: ComparisonAbove, Threshold: 1000, Duration: 600, Hysteresis: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert, err := model.FireAlert(Alert{RuleID: rule.ID, SensorID: "bedroom", Value: 1100, StartedAt: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := model.FireAlert(Alert{RuleID: rule.ID, SensorID: "bedroom", Value: 1200, StartedAt: 200}); !errors.Is(err, ErrAlertAlreadyFiring) {
+		t.Errorf("expected %v, got %v", ErrAlertAlreadyFiring, err)
+	}
+
+	firing, err := model.GetFiring()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Alert{{ID: alert.ID, RuleID: rule.ID, SensorID: "bedroom", Metric: "co2", Value: 1100, Status: AlertStatusFiring, StartedAt: 100}}
+	if diff := cmp.Diff(expected, firing); diff != "" {
+		t.Error(diff)
+	}
+
+	if err := model.ResolveAlert(alert.ID, 300); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := model.ResolveAlert(alert.ID, 400); !errors.Is(err, ErrAlertNotFound) {
+		t.Errorf("expected %v, got %v", ErrAlertNotFound, err)
+	}
+
+	data := []struct {
+		name     string
+		query    AlertsQuery
+		expected int
+	}{
+		{"overlapping", AlertsQuery{StartEpoch: 200, EndEpoch: 250}, 1},
+		{"before", AlertsQuery{StartEpoch: 0, EndEpoch: 50}, 0},
+		{"after", AlertsQuery{StartEpoch: 301, EndEpoch: 400}, 0},
+		{"resolved", AlertsQuery{StartEpoch: 0, EndEpoch: 400, Status: AlertStatusResolved}, 1},
+		{"firing", AlertsQuery{StartEpoch: 0, EndEpoch: 400, Status: AlertStatusFiring}, 0},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				alerts, err := model.GetAll(d.query)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if diff := cmp.Diff(d.expected, len(alerts)); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+
+	if err := rules.DeleteAlertRule(rule.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rules.Get(rule.ID); !errors.Is(err, ErrAlertRuleNotFound) {
+		t.Errorf("expected %v, got %v", ErrAlertRuleNotFound, err)
+	}
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+)
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+type DeadLetterModelInterface interface {
+	GetAll(q DeadLettersQuery) ([]DeadLetter, error)
+	InsertDeadLetter(DeadLetter) (string, error)
+	Delete(id string) error
+}
+
+// DeadLetter represents an MQTT message which could not be parsed or persisted.
+type DeadLetter struct {
+	ID         string `json:"id,omitempty"`
+	Topic      string `json:"topic"`
+	Payload    string `json:"payload"`
+	Reason     string `json:"reason"`
+	ReceivedAt int64  `json:"receivedAt"`
+}
+
+// DeadLettersQuery represents a query for dead letters.
+type DeadLettersQuery struct {
+	StartEpoch, EndEpoch int64
+}
+
+// DeadLetterModel represents a dead letter model.
+type DeadLetterModel struct {
+	DB *sql.DB
+}
+
+// GetAll returns dead letters received between fromEpoch and toEpoch, oldest first.
+func (m DeadLetterModel) GetAll(q DeadLettersQuery) ([]DeadLetter, error) {
+	query := `
+	select id, topic, payload, reason, received_at from "dead_letters"
+	where "received_at" >= $1 and "received_at" <= $2
+	order by received_at asc
+	`
+
+	rows, err := m.DB.Query(query, q.StartEpoch, q.EndEpoch)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	deadLetters := make([]DeadLetter, 0)
+
+	for rows.Next() {
+		var d DeadLetter
+		err := rows.Scan(&d.ID, &d.Topic, &d.Payload, &d.Reason, &d.ReceivedAt)
+		if err != nil {
+			return nil, err
+		}
+		deadLetters = append(deadLetters, d)
+	}
+
+	return deadLetters, rows.Err()
+}
+
+// InsertDeadLetter inserts a new dead letter into the database.
+func (m DeadLetterModel) InsertDeadLetter(d DeadLetter) (string, error) {
+	query := `insert into "dead_letters"("topic", "payload", "reason", "received_at") values($1, $2, $3, $4) RETURNING id`
+	err := m.DB.QueryRow(query, d.Topic, d.Payload, d.Reason, d.ReceivedAt).Scan(&d.ID)
+
+	if err != nil {
+		return "", err
+	}
+
+	return d.ID, nil
+}
+
+// Delete removes a dead letter, usually after it was replayed successfully.
+func (m DeadLetterModel) Delete(id string) error {
+	result, err := m.DB.Exec(`delete from "dead_letters" where "id" = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrDeadLetterNotFound
+	}
+
+	return nil
+}
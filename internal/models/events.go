@@ -51,11 +51,11 @@ type Event struct {
 	EventType      string `json:"eventType,omitempty"`
 }
 
-// GetEvents returns events between fromEpoch and toEpoch.
+// GetEvents returns events which overlap fromEpoch and toEpoch, events without an end are still ongoing and overlap if they started before toEpoch.
 func (m EventModel) GetAll(q EventsQuery) ([]Event, error) {
 	query := `
-	select id, start_timestamp, end_timestamp, location_id, type from "events"
-	where "start_timestamp" >= $1 and "start_timestamp" <= $2
+	select id, start_timestamp, coalesce(end_timestamp, 0), location_id, type from "events"
+	where "start_timestamp" <= $2 and coalesce("end_timestamp", $2) >= $1
 	order by start_timestamp asc
 	`
 
@@ -95,12 +95,12 @@ func (m EventModel) InsertEvent(e Event) (Event, error) {
 
 func (m EventModel) UpdateEvent(e Event) (Event, error) {
 	query := `update "events" set
-			"end_timestamp" = $2,
+			"end_timestamp" = NULLIF($2,0),
 			"start_timestamp" = $3,
 			"location_id" = $4,
 			"type" = $5 
 			where "id" = $1 
-			returning id,start_timestamp,end_timestamp,location_id,type`
+			returning id,start_timestamp,coalesce(end_timestamp, 0),location_id,type`
 
 	err := m.DB.QueryRow(
 		query,
@@ -120,7 +120,7 @@ func (m EventModel) UpdateEvent(e Event) (Event, error) {
 
 func (m EventModel) Get(id string) (Event, error) {
 	query := `
-        SELECT id,start_timestamp,end_timestamp,location_id,type
+        SELECT id,start_timestamp,coalesce(end_timestamp, 0),location_id,type
         FROM events
         WHERE id = $1`
 
@@ -0,0 +1,67 @@
+//go:build integration
+
+package models
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_EventModel(t *testing.T) {
+	db := newTestDB(t)
+	model := EventModel{DB: db}
+
+	before, err := model.InsertEvent(Event{StartTimestamp: 50, EndTimestamp: 150, LocationID: "bedroom", EventType: "window:open"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// events without an end are stored as open-ended
+	open, err := model.InsertEvent(Event{StartTimestamp: 120, LocationID: "bedroom", EventType: "heating:on"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// open-ended events which started before the range are still ongoing
+	ongoing, err := model.InsertEvent(Event{StartTimestamp: 80, LocationID: "bedroom", EventType: "heating:on"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := model.InsertEvent(Event{StartTimestamp: 10, EndTimestamp: 20, LocationID: "bedroom", EventType: "window:open"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := model.InsertEvent(Event{StartTimestamp: 300, LocationID: "bedroom", EventType: "window:open"}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := model.GetAll(EventsQuery{StartEpoch: 100, EndEpoch: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]Event{before, ongoing, open}, events); diff != "" {
+		t.Error(diff)
+	}
+
+	stored, err := model.Get(open.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(open, stored); diff != "" {
+		t.Error(diff)
+	}
+
+	stored.EndTimestamp = 180
+	updated, err := model.UpdateEvent(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(stored, updated); diff != "" {
+		t.Error(diff)
+	}
+}
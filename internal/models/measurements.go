@@ -2,19 +2,70 @@ package models
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 
+	"github.com/jackc/pgerrcode"
 	"github.com/lib/pq"
 )
 
+var ErrDuplicateMeasurement = errors.New("measurement with this combination of sensorId and timestamp already exists")
+
+func mapPostgresMeasurementError(err error) error {
+	// check for a postgres duplicate key error using error code
+	// https://www.postgresql.org/docs/9.5/errcodes-appendix.html
+	pqErr, ok := err.(*pq.Error)
+	if ok && string(pqErr.Code) == pgerrcode.UniqueViolation {
+		return ErrDuplicateMeasurement
+	}
+
+	return err
+}
+
+// DuplicatePolicy defines what happens when a measurement with the same sensorId and timestamp already exists,
+// e.g. when an MQTT message is redelivered.
+type DuplicatePolicy string
+
+const (
+	// DuplicatePolicyIgnore keeps the existing measurement.
+	DuplicatePolicyIgnore DuplicatePolicy = "ignore"
+	// DuplicatePolicyOverwrite replaces the existing measurement with the new one.
+	DuplicatePolicyOverwrite DuplicatePolicy = "overwrite"
+	// DuplicatePolicyAverage stores the average of all measurements received for the sensorId and timestamp.
+	DuplicatePolicyAverage DuplicatePolicy = "average"
+)
+
+// ParseDuplicatePolicy parses a duplicate policy name.
+func ParseDuplicatePolicy(s string) (DuplicatePolicy, error) {
+	switch p := DuplicatePolicy(s); p {
+	case DuplicatePolicyIgnore, DuplicatePolicyOverwrite, DuplicatePolicyAverage:
+		return p, nil
+	}
+
+	return "", fmt.Errorf("invalid duplicate policy: %s, must be one of ignore, overwrite, average", s)
+}
+
 type MeasurementModelInterface interface {
 	GetMeasurements(MeasurementsQuery) ([]Measurement, error)
+	StreamMeasurements(MeasurementsQuery, func(Measurement) error) error
+	GetLatest() ([]Measurement, error)
 	InsertMeasurement(Measurement) (string, error)
+	InsertMeasurements([]Measurement) (InsertResult, error)
+}
+
+// InsertResult reports how many measurements of a batch were new and how many were duplicates.
+type InsertResult struct {
+	Inserted   int
+	Duplicates int
 }
 
 // Measurement represents a single measurement.
 type Measurement struct {
 	ID          string  `json:"id,omitempty"`
 	Timestamp   int64   `json:"timestamp"`
+	ReceivedAt  int64   `json:"receivedAt,omitempty"`
 	SensorID    string  `json:"sensorId"`
 	IAQ         float64 `json:"iaq"`
 	CO2         float64 `json:"co2"`
@@ -22,6 +73,154 @@ type Measurement struct {
 	Pressure    float64 `json:"pressure"`
 	Temperature float64 `json:"temperature"`
 	Humidity    float64 `json:"humidity"`
+	// Missing are the metrics without a value, e.g. VOC of a sensor without a VOC sensor, they are stored as NULL.
+	Missing []string `json:"missing,omitempty"`
+	// Min and Max are the lowest and highest values within the resolution, they are only set by AggregationEnvelope.
+	Min *Measurement `json:"-"`
+	Max *Measurement `json:"-"`
+}
+
+// Metrics are the names of the measured values, as used in JSON.
+var Metrics = []string{"iaq", "co2", "voc", "pressure", "temperature", "humidity"}
+
+// Metric returns the value of the metric with the given name, false if there is no such metric or it has no value.
+func (m Measurement) Metric(name string) (float64, bool) {
+	if slices.Contains(m.Missing, name) {
+		return 0, false
+	}
+
+	switch name {
+	case "iaq":
+		return m.IAQ, true
+	case "co2":
+		return m.CO2, true
+	case "voc":
+		return m.VOC, true
+	case "pressure":
+		return m.Pressure, true
+	case "temperature":
+		return m.Temperature, true
+	case "humidity":
+		return m.Humidity, true
+	}
+	return 0, false
+}
+
+// setMetric sets the value of the metric with the given name, a NULL value marks the metric as missing.
+func (m *Measurement) setMetric(name string, value sql.NullFloat64) {
+	// the missing metrics are copied, since they can be shared with a copy of the measurement
+	var missing []string
+	for _, metric := range m.Missing {
+		if metric != name {
+			missing = append(missing, metric)
+		}
+	}
+	if !value.Valid {
+		missing = append(missing, name)
+	}
+	m.Missing = missing
+
+	switch name {
+	case "iaq":
+		m.IAQ = value.Float64
+	case "co2":
+		m.CO2 = value.Float64
+	case "voc":
+		m.VOC = value.Float64
+	case "pressure":
+		m.Pressure = value.Float64
+	case "temperature":
+		m.Temperature = value.Float64
+	case "humidity":
+		m.Humidity = value.Float64
+	}
+}
+
+// nullMetric returns the value of the metric with the given name to be stored, NULL when it is missing.
+func (m Measurement) nullMetric(name string) sql.NullFloat64 {
+	value, ok := m.Metric(name)
+	return sql.NullFloat64{Float64: value, Valid: ok}
+}
+
+// Aggregation is how the measurements within the resolution are combined into one.
+type Aggregation string
+
+const (
+	AggregationAvg    Aggregation = "avg"
+	AggregationMin    Aggregation = "min"
+	AggregationMax    Aggregation = "max"
+	AggregationMedian Aggregation = "median"
+	AggregationP95    Aggregation = "p95"
+	AggregationFirst  Aggregation = "first"
+	AggregationLast   Aggregation = "last"
+	// AggregationCount returns the number of measurements as the value of every metric.
+	AggregationCount Aggregation = "count"
+	// AggregationEnvelope returns the average and sets Min and Max, e.g. to draw a band around the average.
+	AggregationEnvelope Aggregation = "envelope"
+)
+
+// Aggregations are the names of all aggregations.
+var Aggregations = []string{"avg", "min", "max", "median", "p95", "first", "last", "count", "envelope"}
+
+// aggregationExpressions are the SQL expressions of the aggregations of a column of the measurements.
+var aggregationExpressions = map[Aggregation]string{
+	AggregationAvg:    `avg("%s")`,
+	AggregationMin:    `min("%s")`,
+	AggregationMax:    `max("%s")`,
+	AggregationMedian: `percentile_cont(0.5) within group (order by "%s")`,
+	AggregationP95:    `percentile_cont(0.95) within group (order by "%s")`,
+	AggregationFirst:  `(array_agg("%[1]s" order by "timestamp" asc) filter (where "%[1]s" is not null))[1]`,
+	AggregationLast:   `(array_agg("%[1]s" order by "timestamp" desc) filter (where "%[1]s" is not null))[1]`,
+	AggregationCount:  `count("%s")::double precision`,
+}
+
+// measurementColumns are the aggregated columns in the order they are selected.
+var measurementColumns = []string{"iaq", "humidity", "temperature", "pressure", "co2", "voc"}
+
+// aggregatedColumns returns the select list of the metrics aggregated per resolution with the expressions,
+// the average, the minimum and the maximum of every metric for AggregationEnvelope.
+func aggregatedColumns(expressions map[Aggregation]string, aggregation Aggregation) (string, error) {
+	aggregations := []Aggregation{aggregation}
+	if aggregation == AggregationEnvelope {
+		aggregations = []Aggregation{AggregationAvg, AggregationMin, AggregationMax}
+	}
+
+	columns := make([]string, 0, len(aggregations)*len(measurementColumns))
+	for _, a := range aggregations {
+		expression, ok := expressions[a]
+		if !ok {
+			return "", fmt.Errorf("invalid aggregation: %s, must be one of %s", aggregation, strings.Join(Aggregations, ", "))
+		}
+		for _, column := range measurementColumns {
+			columns = append(columns, fmt.Sprintf(expression, column))
+		}
+	}
+
+	return strings.Join(columns, ",\n\t"), nil
+}
+
+// metricsScanner scans the metrics in the order of measurementColumns, metrics without a value, e.g. of a sensor
+// without a VOC sensor or of a resolution in which none of the measurements has a value, are NULL.
+type metricsScanner []sql.NullFloat64
+
+func newMetricsScanner() metricsScanner {
+	return make(metricsScanner, len(measurementColumns))
+}
+
+// destinations returns the scan destinations of the metrics.
+func (s metricsScanner) destinations() []any {
+	destinations := make([]any, len(s))
+	for i := range s {
+		destinations[i] = &s[i]
+	}
+	return destinations
+}
+
+// set sets the scanned metrics of the measurement.
+func (s metricsScanner) set(m *Measurement) {
+	for i, column := range measurementColumns {
+		m.setMetric(column, s[i])
+	}
 }
 
 // MeasurementsQuery represents a query for measurements.
@@ -29,48 +228,262 @@ type MeasurementsQuery struct {
 	StartEpoch, EndEpoch int64
 	Resolution           int
 	SensorIDs            []string
+	// Aggregation defaults to AggregationAvg.
+	Aggregation Aggregation
 }
 
 // MeasurementModel represents a measurement model.
 type MeasurementModel struct {
 	DB *sql.DB
+	// DuplicatePolicy is applied by InsertMeasurements, defaults to DuplicatePolicyIgnore.
+	DuplicatePolicy DuplicatePolicy
+	// Rollups lets queries which consist of whole rollup buckets and start after the backfilled rollups
+	// be answered from the rollups, see RollupModel.
+	Rollups bool
 }
 
-// InsertMeasurement inserts a new measurement into the database.
+// InsertMeasurement inserts a new measurement into the database and returns its generated ID.
+// ErrDuplicateMeasurement is returned when a measurement with the same sensorId and timestamp already exists.
 func (m MeasurementModel) InsertMeasurement(measurement Measurement) (string, error) {
-	query := `insert into "measurements"("timestamp", "sensor_id", "iaq",  "co2", "voc", "pressure", "temperature", "humidity") values($1, $2, $3, $4, $5, $6, $7, $8)`
+	query := `
+	with inserted as (
+		insert into "measurements"("timestamp", "received_at", "sensor_id", "iaq",  "co2", "voc", "pressure", "temperature", "humidity") values($1, NULLIF($2,0), $3, $4, $5, $6, $7, $8, $9) RETURNING id, "sensor_id", "timestamp"
+	), pending as (` + markPendingRollups("inserted") + `)
+	select id from inserted
+	`
 	err := m.DB.QueryRow(
 		query,
 		measurement.Timestamp,
+		measurement.ReceivedAt,
 		measurement.SensorID,
-		measurement.IAQ,
-		measurement.CO2,
-		measurement.VOC,
-		measurement.Pressure,
-		measurement.Temperature,
-		measurement.Humidity,
-	).Scan(&measurement)
+		measurement.nullMetric("iaq"),
+		measurement.nullMetric("co2"),
+		measurement.nullMetric("voc"),
+		measurement.nullMetric("pressure"),
+		measurement.nullMetric("temperature"),
+		measurement.nullMetric("humidity"),
+	).Scan(&measurement.ID)
 
 	if err != nil {
-		return "", err
+		return "", mapPostgresMeasurementError(err)
 	}
 
 	return measurement.ID, nil
 }
 
+// duplicateSetters are the assignments used to resolve a conflict with an existing measurement per policy.
+var duplicateSetters = map[DuplicatePolicy]string{
+	DuplicatePolicyIgnore: "",
+	DuplicatePolicyOverwrite: `
+		"received_at" = excluded."received_at",
+		"iaq" = excluded."iaq",
+		"co2" = excluded."co2",
+		"voc" = excluded."voc",
+		"pressure" = excluded."pressure",
+		"temperature" = excluded."temperature",
+		"humidity" = excluded."humidity"`,
+	// a metric missing from one of the measurements is taken from the other one
+	DuplicatePolicyAverage: `
+		"iaq" = coalesce((m."iaq" * m."sample_count" + excluded."iaq" * excluded."sample_count") / (m."sample_count" + excluded."sample_count"), m."iaq", excluded."iaq"),
+		"co2" = coalesce((m."co2" * m."sample_count" + excluded."co2" * excluded."sample_count") / (m."sample_count" + excluded."sample_count"), m."co2", excluded."co2"),
+		"voc" = coalesce((m."voc" * m."sample_count" + excluded."voc" * excluded."sample_count") / (m."sample_count" + excluded."sample_count"), m."voc", excluded."voc"),
+		"pressure" = coalesce((m."pressure" * m."sample_count" + excluded."pressure" * excluded."sample_count") / (m."sample_count" + excluded."sample_count"), m."pressure", excluded."pressure"),
+		"temperature" = coalesce((m."temperature" * m."sample_count" + excluded."temperature" * excluded."sample_count") / (m."sample_count" + excluded."sample_count"), m."temperature", excluded."temperature"),
+		"humidity" = coalesce((m."humidity" * m."sample_count" + excluded."humidity" * excluded."sample_count") / (m."sample_count" + excluded."sample_count"), m."humidity", excluded."humidity"),
+		"sample_count" = m."sample_count" + excluded."sample_count"`,
+}
+
+type measurementKey struct {
+	sensorID  string
+	timestamp int64
+}
+
+// dedupeMeasurements merges measurements with the same sensorId and timestamp within a batch according to the policy,
+// since a single insert statement can not resolve a conflict on the same row twice.
+// It returns the merged measurements and the number of measurements each of them represents.
+func dedupeMeasurements(measurements []Measurement, policy DuplicatePolicy) ([]Measurement, []int) {
+	deduped := make([]Measurement, 0, len(measurements))
+	counts := make([]int, 0, len(measurements))
+	index := make(map[measurementKey]int, len(measurements))
+
+	for _, measurement := range measurements {
+		key := measurementKey{measurement.SensorID, measurement.Timestamp}
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(deduped)
+			deduped = append(deduped, measurement)
+			counts = append(counts, 1)
+			continue
+		}
+
+		switch policy {
+		case DuplicatePolicyOverwrite:
+			deduped[i] = measurement
+		case DuplicatePolicyAverage:
+			existing, n := &deduped[i], float64(counts[i])
+			for _, metric := range Metrics {
+				value, ok := measurement.Metric(metric)
+				if !ok {
+					continue
+				}
+				// a metric missing from the existing measurement is taken from the new one
+				if current, ok := existing.Metric(metric); ok {
+					value = (current*n + value) / (n + 1)
+				}
+				existing.setMetric(metric, sql.NullFloat64{Float64: value, Valid: true})
+			}
+		}
+		counts[i]++
+	}
+
+	return deduped, counts
+}
+
+// InsertMeasurements inserts multiple measurements into the database using a single statement.
+// Measurements which already exist are resolved according to the DuplicatePolicy and counted as duplicates.
+func (m MeasurementModel) InsertMeasurements(measurements []Measurement) (InsertResult, error) {
+	if len(measurements) == 0 {
+		return InsertResult{}, nil
+	}
+
+	policy := m.DuplicatePolicy
+	if policy == "" {
+		policy = DuplicatePolicyIgnore
+	}
+
+	setters, ok := duplicateSetters[policy]
+	if !ok {
+		return InsertResult{}, fmt.Errorf("invalid duplicate policy: %s", policy)
+	}
+
+	onConflict := `on conflict ("sensor_id", "timestamp") do nothing`
+	if setters != "" {
+		onConflict = `on conflict ("sensor_id", "timestamp") do update set ` + setters
+	}
+
+	// xmax is 0 for freshly inserted rows and set for rows which were updated on conflict,
+	// both change the rollups, while ignored duplicates are not returned at all
+	query := `
+	with changed as (
+		insert into "measurements" as m ("timestamp", "received_at", "sensor_id", "iaq", "co2", "voc", "pressure", "temperature", "humidity", "sample_count")
+		select "timestamp", NULLIF("received_at", 0), "sensor_id", "iaq", "co2", "voc", "pressure", "temperature", "humidity", "sample_count"
+		from unnest($1::int[], $2::int[], $3::varchar[], $4::double precision[], $5::double precision[], $6::double precision[], $7::double precision[], $8::double precision[], $9::double precision[], $10::int[])
+		as t("timestamp", "received_at", "sensor_id", "iaq", "co2", "voc", "pressure", "temperature", "humidity", "sample_count")
+		` + onConflict + `
+		returning "sensor_id", "timestamp", (xmax = 0) as inserted
+	), pending as (` + markPendingRollups("changed") + `)
+	select inserted from changed
+	`
+
+	deduped, counts := dedupeMeasurements(measurements, policy)
+
+	n := len(deduped)
+	timestamps, receivedAt, sensorIDs, sampleCounts := make([]int64, n), make([]int64, n), make([]string, n), make([]int64, n)
+	iaq, co2, voc := make([]sql.NullFloat64, n), make([]sql.NullFloat64, n), make([]sql.NullFloat64, n)
+	pressure, temperature, humidity := make([]sql.NullFloat64, n), make([]sql.NullFloat64, n), make([]sql.NullFloat64, n)
+
+	for i, measurement := range deduped {
+		timestamps[i] = measurement.Timestamp
+		receivedAt[i] = measurement.ReceivedAt
+		sensorIDs[i] = measurement.SensorID
+		sampleCounts[i] = 1
+		if policy == DuplicatePolicyAverage {
+			sampleCounts[i] = int64(counts[i])
+		}
+		iaq[i] = measurement.nullMetric("iaq")
+		co2[i] = measurement.nullMetric("co2")
+		voc[i] = measurement.nullMetric("voc")
+		pressure[i] = measurement.nullMetric("pressure")
+		temperature[i] = measurement.nullMetric("temperature")
+		humidity[i] = measurement.nullMetric("humidity")
+	}
+
+	rows, err := m.DB.Query(
+		query,
+		pq.Array(timestamps),
+		pq.Array(receivedAt),
+		pq.Array(sensorIDs),
+		pq.Array(iaq),
+		pq.Array(co2),
+		pq.Array(voc),
+		pq.Array(pressure),
+		pq.Array(temperature),
+		pq.Array(humidity),
+		pq.Array(sampleCounts),
+	)
+	if err != nil {
+		return InsertResult{}, err
+	}
+
+	defer rows.Close()
+
+	var result InsertResult
+	for rows.Next() {
+		var inserted bool
+		if err := rows.Scan(&inserted); err != nil {
+			return InsertResult{}, err
+		}
+		if inserted {
+			result.Inserted++
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return InsertResult{}, err
+	}
+
+	result.Duplicates = len(measurements) - result.Inserted
+
+	return result, nil
+}
+
 // GetMeasurements returns measurements aggregated by resolution (ms) between fromEpoch and toEpoch.
 func (m MeasurementModel) GetMeasurements(mq MeasurementsQuery) ([]Measurement, error) {
+	measurements := make([]Measurement, 0)
+
+	err := m.StreamMeasurements(mq, func(measurement Measurement) error {
+		measurements = append(measurements, measurement)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return measurements, nil
+}
+
+// StreamMeasurements calls fn for every measurement GetMeasurements would return, as they are read from the database,
+// so that the result is never held in memory as a whole. Iteration stops at the first error returned by fn.
+func (m MeasurementModel) StreamMeasurements(mq MeasurementsQuery, fn func(Measurement) error) error {
+	aggregation := mq.Aggregation
+	if aggregation == "" {
+		aggregation = AggregationAvg
+	}
+
+	table, expressions := "measurements", aggregationExpressions
+	if r, ok := findRollup(mq, aggregation); ok && m.Rollups {
+		// rollups of measurements stored before the rollups existed are missing until they are backfilled,
+		// so ranges starting before the backfilled rollups are aggregated from the measurements
+		backfilled, ok, err := RollupModel{DB: m.DB}.GetBackfilled()
+		if err != nil {
+			return err
+		}
+		if ok && mq.StartEpoch >= backfilled {
+			table, expressions = r.table, rollupExpressions
+		}
+	}
+
+	columns, err := aggregatedColumns(expressions, aggregation)
+	if err != nil {
+		return err
+	}
+
 	query := `
 	select
 	(floor("timestamp"/$1)*$1)::numeric::integer as timestamp, 
 	sensor_id, 
-	avg(iaq) as iaq, 
-	avg(humidity) as humidity,
-	avg(temperature) as temperature,
-	avg(pressure) as pressure, 
-	avg(co2) as co2, 
-	avg(voc) as voc
-	from "measurements"
+	` + columns + `
+	from "` + table + `"
 	where sensor_id = any($4) and "timestamp" >= $2 and "timestamp" <= $3
 	group by (floor("timestamp"/$1)*$1)::numeric::integer, sensor_id
 	order by timestamp asc
@@ -78,6 +491,51 @@ func (m MeasurementModel) GetMeasurements(mq MeasurementsQuery) ([]Measurement,
 
 	rows, err := m.DB.Query(query, mq.Resolution, mq.StartEpoch, mq.EndEpoch, pq.Array(mq.SensorIDs))
 
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var measurement Measurement
+		values, minValues, maxValues := newMetricsScanner(), newMetricsScanner(), newMetricsScanner()
+		destinations := append([]any{&measurement.Timestamp, &measurement.SensorID}, values.destinations()...)
+		if aggregation == AggregationEnvelope {
+			destinations = append(destinations, minValues.destinations()...)
+			destinations = append(destinations, maxValues.destinations()...)
+		}
+
+		if err := rows.Scan(destinations...); err != nil {
+			return err
+		}
+
+		values.set(&measurement)
+		if aggregation == AggregationEnvelope {
+			measurement.Min, measurement.Max = &Measurement{}, &Measurement{}
+			minValues.set(measurement.Min)
+			maxValues.set(measurement.Max)
+		}
+		if err := fn(measurement); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// GetLatest returns the most recent measurement of every registered sensor which has measurements.
+func (m MeasurementModel) GetLatest() ([]Measurement, error) {
+	query := `
+	select m.id, m.timestamp, m.sensor_id, m.iaq, m.humidity, m.temperature, m.pressure, m.co2, m.voc
+	from sensors s
+	cross join lateral (
+		select * from measurements where sensor_id = s.id order by "timestamp" desc limit 1
+	) m
+	order by m.sensor_id asc
+	`
+
+	rows, err := m.DB.Query(query)
 	if err != nil {
 		return nil, err
 	}
@@ -88,12 +546,18 @@ func (m MeasurementModel) GetMeasurements(mq MeasurementsQuery) ([]Measurement,
 
 	for rows.Next() {
 		var measurement Measurement
-		err := rows.Scan(&measurement.Timestamp, &measurement.SensorID, &measurement.IAQ, &measurement.Humidity, &measurement.Temperature, &measurement.Pressure, &measurement.CO2, &measurement.VOC)
+		values := newMetricsScanner()
+		err := rows.Scan(append([]any{&measurement.ID, &measurement.Timestamp, &measurement.SensorID}, values.destinations()...)...)
 		if err != nil {
 			return nil, err
 		}
+		values.set(&measurement)
 		measurements = append(measurements, measurement)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
 	return measurements, nil
 }
@@ -0,0 +1,298 @@
+//go:build integration
+
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func Test_MeasurementModel_InsertMeasurement(t *testing.T) {
+	db := newTestDB(t)
+	model := MeasurementModel{DB: db}
+
+	measurement := Measurement{
+		Timestamp:   1702156335,
+		ReceivedAt:  1702156336,
+		SensorID:    "bedroom",
+		IAQ:         51.86,
+		CO2:         607.44,
+		VOC:         0.52,
+		Pressure:    100853,
+		Temperature: 27.25,
+		Humidity:    60.22,
+	}
+
+	id, err := model.InsertMeasurement(measurement)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(id) != 36 {
+		t.Errorf("expected a uuid, got '%s'", id)
+	}
+
+	var storedID string
+	var receivedAt int64
+	err = db.QueryRow(`select id, received_at from measurements where sensor_id = $1 and timestamp = $2`, measurement.SensorID, measurement.Timestamp).Scan(&storedID, &receivedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]any{id, measurement.ReceivedAt}, []any{storedID, receivedAt}); diff != "" {
+		t.Error(diff)
+	}
+
+	_, err = model.InsertMeasurement(measurement)
+	if !errors.Is(err, ErrDuplicateMeasurement) {
+		t.Errorf("expected %v, got %v", ErrDuplicateMeasurement, err)
+	}
+}
+
+func Test_MeasurementModel_InsertMeasurements(t *testing.T) {
+	stored := Measurement{Timestamp: 60, SensorID: "bedroom", CO2: 600, Humidity: 40}
+	batch := []Measurement{
+		{Timestamp: 60, SensorID: "bedroom", CO2: 800, Humidity: 60},
+		{Timestamp: 60, SensorID: "bedroom", CO2: 1000, Humidity: 80},
+		{Timestamp: 60, SensorID: "livingroom", CO2: 500, Humidity: 50},
+	}
+
+	data := []struct {
+		name           string
+		policy         DuplicatePolicy
+		expectedResult InsertResult
+		expected       []Measurement
+	}{
+		{
+			"ignore",
+			DuplicatePolicyIgnore,
+			InsertResult{Inserted: 1, Duplicates: 2},
+			[]Measurement{stored, batch[2]},
+		},
+		{
+			"overwrite",
+			DuplicatePolicyOverwrite,
+			InsertResult{Inserted: 1, Duplicates: 2},
+			[]Measurement{batch[1], batch[2]},
+		},
+		{
+			"average",
+			DuplicatePolicyAverage,
+			InsertResult{Inserted: 1, Duplicates: 2},
+			[]Measurement{{Timestamp: 60, SensorID: "bedroom", CO2: 800, Humidity: 60}, batch[2]},
+		},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				model := MeasurementModel{DB: newTestDB(t), DuplicatePolicy: d.policy}
+
+				if _, err := model.InsertMeasurement(stored); err != nil {
+					t.Fatal(err)
+				}
+
+				result, err := model.InsertMeasurements(batch)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if diff := cmp.Diff(d.expectedResult, result); diff != "" {
+					t.Error(diff)
+				}
+
+				measurements, err := model.GetMeasurements(MeasurementsQuery{
+					StartEpoch: 0,
+					EndEpoch:   120,
+					Resolution: 60,
+					SensorIDs:  []string{"bedroom", "livingroom"},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				sortBySensor := cmpopts.SortSlices(func(a, b Measurement) bool { return a.SensorID < b.SensorID })
+				if diff := cmp.Diff(d.expected, measurements, sortBySensor); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
+
+func Test_MeasurementModel_GetMeasurements(t *testing.T) {
+	model := MeasurementModel{DB: newTestDB(t)}
+
+	_, err := model.InsertMeasurements([]Measurement{
+		{Timestamp: 0, SensorID: "bedroom", CO2: 400},
+		{Timestamp: 30, SensorID: "bedroom", CO2: 600},
+		{Timestamp: 60, SensorID: "bedroom", CO2: 1000},
+		{Timestamp: 60, SensorID: "kitchen", CO2: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	measurements, err := model.GetMeasurements(MeasurementsQuery{
+		StartEpoch: 0,
+		EndEpoch:   120,
+		Resolution: 60,
+		SensorIDs:  []string{"bedroom"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Measurement{
+		{Timestamp: 0, SensorID: "bedroom", CO2: 500},
+		{Timestamp: 60, SensorID: "bedroom", CO2: 1000},
+	}
+
+	if diff := cmp.Diff(expected, measurements); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_MeasurementModel_GetMeasurements_aggregation(t *testing.T) {
+	model := MeasurementModel{DB: newTestDB(t)}
+
+	_, err := model.InsertMeasurements([]Measurement{
+		{Timestamp: 0, SensorID: "bedroom", CO2: 400},
+		{Timestamp: 20, SensorID: "bedroom", CO2: 1100},
+		{Timestamp: 40, SensorID: "bedroom", CO2: 600},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []struct {
+		aggregation Aggregation
+		expected    Measurement
+	}{
+		{"", Measurement{Timestamp: 0, SensorID: "bedroom", CO2: 700}},
+		{AggregationMin, Measurement{Timestamp: 0, SensorID: "bedroom", CO2: 400}},
+		{AggregationMax, Measurement{Timestamp: 0, SensorID: "bedroom", CO2: 1100}},
+		{AggregationMedian, Measurement{Timestamp: 0, SensorID: "bedroom", CO2: 600}},
+		{AggregationP95, Measurement{Timestamp: 0, SensorID: "bedroom", CO2: 1050}},
+		{AggregationFirst, Measurement{Timestamp: 0, SensorID: "bedroom", CO2: 400}},
+		{AggregationLast, Measurement{Timestamp: 0, SensorID: "bedroom", CO2: 600}},
+		{AggregationCount, Measurement{Timestamp: 0, SensorID: "bedroom", IAQ: 3, CO2: 3, VOC: 3, Pressure: 3, Temperature: 3, Humidity: 3}},
+		{AggregationEnvelope, Measurement{Timestamp: 0, SensorID: "bedroom", CO2: 700, Min: &Measurement{CO2: 400}, Max: &Measurement{CO2: 1100}}},
+	}
+
+	for _, d := range data {
+		t.Run(
+			string(d.aggregation),
+			func(t *testing.T) {
+				measurements, err := model.GetMeasurements(MeasurementsQuery{
+					StartEpoch:  0,
+					EndEpoch:    60,
+					Resolution:  60,
+					SensorIDs:   []string{"bedroom"},
+					Aggregation: d.aggregation,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if diff := cmp.Diff([]Measurement{d.expected}, measurements); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
+
+func Test_MeasurementModel_GetMeasurements_missing(t *testing.T) {
+	model := MeasurementModel{DB: newTestDB(t)}
+
+	if _, err := model.InsertMeasurement(Measurement{Timestamp: 0, SensorID: "bedroom", CO2: 400, Missing: []string{"iaq", "humidity", "temperature", "pressure", "voc"}}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := model.InsertMeasurements([]Measurement{
+		{Timestamp: 60, SensorID: "bedroom", CO2: 600, VOC: 1, Missing: []string{"iaq", "humidity", "temperature", "pressure"}},
+		{Timestamp: 120, SensorID: "bedroom", CO2: 800, Missing: []string{"iaq", "humidity", "temperature", "pressure", "voc"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []struct {
+		name        string
+		resolution  int
+		aggregation Aggregation
+		expected    []Measurement
+	}{
+		{
+			"per measurement",
+			60,
+			AggregationAvg,
+			[]Measurement{
+				{Timestamp: 0, SensorID: "bedroom", CO2: 400, Missing: []string{"iaq", "humidity", "temperature", "pressure", "voc"}},
+				{Timestamp: 60, SensorID: "bedroom", CO2: 600, VOC: 1, Missing: []string{"iaq", "humidity", "temperature", "pressure"}},
+				{Timestamp: 120, SensorID: "bedroom", CO2: 800, Missing: []string{"iaq", "humidity", "temperature", "pressure", "voc"}},
+			},
+		},
+		{
+			"average of the values",
+			300,
+			AggregationAvg,
+			[]Measurement{{Timestamp: 0, SensorID: "bedroom", CO2: 600, VOC: 1, Missing: []string{"iaq", "humidity", "temperature", "pressure"}}},
+		},
+		{
+			"count of the values",
+			300,
+			AggregationCount,
+			[]Measurement{{Timestamp: 0, SensorID: "bedroom", CO2: 3, VOC: 1}},
+		},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				measurements, err := model.GetMeasurements(MeasurementsQuery{StartEpoch: 0, EndEpoch: 299, Resolution: d.resolution, SensorIDs: []string{"bedroom"}, Aggregation: d.aggregation})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if diff := cmp.Diff(d.expected, measurements); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
+
+func Test_MeasurementModel_GetLatest(t *testing.T) {
+	model := MeasurementModel{DB: newTestDB(t)}
+
+	_, err := model.InsertMeasurements([]Measurement{
+		{Timestamp: 0, SensorID: "bedroom", CO2: 400},
+		{Timestamp: 60, SensorID: "bedroom", CO2: 600},
+		{Timestamp: 30, SensorID: "livingroom", CO2: 800},
+		// not a registered sensor
+		{Timestamp: 90, SensorID: "kitchen", CO2: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	measurements, err := model.GetLatest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Measurement{
+		{Timestamp: 60, SensorID: "bedroom", CO2: 600},
+		{Timestamp: 30, SensorID: "livingroom", CO2: 800},
+	}
+
+	if diff := cmp.Diff(expected, measurements, cmpopts.IgnoreFields(Measurement{}, "ID")); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_dedupeMeasurements(t *testing.T) {
+	measurements := []Measurement{
+		{SensorID: "bedroom", Timestamp: 1, CO2: 600, Humidity: 40},
+		{SensorID: "livingroom", Timestamp: 1, CO2: 500, Humidity: 50},
+		{SensorID: "bedroom", Timestamp: 1, CO2: 700, Humidity: 50},
+		{SensorID: "bedroom", Timestamp: 1, CO2: 800, Humidity: 60},
+	}
+
+	data := []struct {
+		name           string
+		policy         DuplicatePolicy
+		expected       []Measurement
+		expectedCounts []int
+	}{
+		{
+			"ignore",
+			DuplicatePolicyIgnore,
+			[]Measurement{measurements[0], measurements[1]},
+			[]int{3, 1},
+		},
+		{
+			"overwrite",
+			DuplicatePolicyOverwrite,
+			[]Measurement{measurements[3], measurements[1]},
+			[]int{3, 1},
+		},
+		{
+			"average",
+			DuplicatePolicyAverage,
+			[]Measurement{{SensorID: "bedroom", Timestamp: 1, CO2: 700, Humidity: 50}, measurements[1]},
+			[]int{3, 1},
+		},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				deduped, counts := dedupeMeasurements(measurements, d.policy)
+
+				if diff := cmp.Diff(d.expected, deduped); diff != "" {
+					t.Error(diff)
+				}
+
+				if diff := cmp.Diff(d.expectedCounts, counts); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
+
+func Test_dedupeMeasurements_missing(t *testing.T) {
+	measurements := []Measurement{
+		{SensorID: "bedroom", Timestamp: 1, CO2: 600, Missing: []string{"humidity", "voc"}},
+		{SensorID: "bedroom", Timestamp: 1, CO2: 800, Humidity: 50, Missing: []string{"voc"}},
+	}
+
+	deduped, _ := dedupeMeasurements(measurements, DuplicatePolicyAverage)
+
+	expected := []Measurement{{SensorID: "bedroom", Timestamp: 1, CO2: 700, Humidity: 50, Missing: []string{"voc"}}}
+	if diff := cmp.Diff(expected, deduped); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_aggregatedColumns(t *testing.T) {
+	data := []struct {
+		name        string
+		aggregation Aggregation
+		expected    []string
+	}{
+		{"avg", AggregationAvg, []string{`avg("iaq")`, `avg("humidity")`, `avg("temperature")`, `avg("pressure")`, `avg("co2")`, `avg("voc")`}},
+		{"last", AggregationLast, []string{`(array_agg("iaq" order by "timestamp" desc) filter (where "iaq" is not null))[1]`, `(array_agg("humidity" order by "timestamp" desc) filter (where "humidity" is not null))[1]`}},
+		{"envelope", AggregationEnvelope, []string{`avg("iaq")`, `min("iaq")`, `max("iaq")`, `max("voc")`}},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				columns, err := aggregatedColumns(aggregationExpressions, d.aggregation)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for _, column := range d.expected {
+					if !strings.Contains(columns, column) {
+						t.Errorf("expected %s in %s", column, columns)
+					}
+				}
+			},
+		)
+	}
+
+	if _, err := aggregatedColumns(aggregationExpressions, "mode"); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,89 @@
+package mocks
+
+import (
+	"errors"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+)
+
+type GetAllAlertRulesMock = func(*[]models.AlertRule) ([]models.AlertRule, error)
+type GetAlertRuleMock = func(string, *[]models.AlertRule) (models.AlertRule, error)
+type InsertAlertRuleMock = func(models.AlertRule, *[]models.AlertRule) (models.AlertRule, error)
+type UpdateAlertRuleMock = func(models.AlertRule, *[]models.AlertRule) (models.AlertRule, error)
+type DeleteAlertRuleMock = func(string, *[]models.AlertRule) error
+
+type AlertRuleModelMock struct {
+	AlertRules []models.AlertRule
+	GetAllAlertRulesMock
+	GetAlertRuleMock
+	InsertAlertRuleMock
+	UpdateAlertRuleMock
+	DeleteAlertRuleMock
+}
+
+func (m *AlertRuleModelMock) GetAll() ([]models.AlertRule, error) {
+	return m.GetAllAlertRulesMock(&m.AlertRules)
+}
+
+func (m *AlertRuleModelMock) Get(id string) (models.AlertRule, error) {
+	return m.GetAlertRuleMock(id, &m.AlertRules)
+}
+
+func (m *AlertRuleModelMock) InsertAlertRule(r models.AlertRule) (models.AlertRule, error) {
+	return m.InsertAlertRuleMock(r, &m.AlertRules)
+}
+
+func (m *AlertRuleModelMock) UpdateAlertRule(r models.AlertRule) (models.AlertRule, error) {
+	return m.UpdateAlertRuleMock(r, &m.AlertRules)
+}
+
+func (m *AlertRuleModelMock) DeleteAlertRule(id string) error {
+	return m.DeleteAlertRuleMock(id, &m.AlertRules)
+}
+
+func GetAllAlertRulesOkMock(rules *[]models.AlertRule) ([]models.AlertRule, error) {
+	return *rules, nil
+}
+
+func GetAllAlertRulesErrorMock(rules *[]models.AlertRule) ([]models.AlertRule, error) {
+	return nil, errors.New("database error")
+}
+
+func GetAlertRuleOkMock(id string, rules *[]models.AlertRule) (models.AlertRule, error) {
+	for _, r := range *rules {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return models.AlertRule{}, models.ErrAlertRuleNotFound
+}
+
+func InsertAlertRuleOkMock(r models.AlertRule, rules *[]models.AlertRule) (models.AlertRule, error) {
+	r.ID = "uuid"
+	*rules = append(*rules, r)
+	return r, nil
+}
+
+func UpdateAlertRuleOkMock(r models.AlertRule, rules *[]models.AlertRule) (models.AlertRule, error) {
+	for i, existing := range *rules {
+		if existing.ID == r.ID {
+			(*rules)[i] = r
+			return r, nil
+		}
+	}
+	return models.AlertRule{}, models.ErrAlertRuleNotFound
+}
+
+func DeleteAlertRuleOkMock(id string, rules *[]models.AlertRule) error {
+	remaining := make([]models.AlertRule, 0, len(*rules))
+	for _, r := range *rules {
+		if r.ID != id {
+			remaining = append(remaining, r)
+		}
+	}
+	if len(remaining) == len(*rules) {
+		return models.ErrAlertRuleNotFound
+	}
+	*rules = remaining
+	return nil
+}
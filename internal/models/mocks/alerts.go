@@ -0,0 +1,77 @@
+package mocks
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+)
+
+type GetAllAlertsMock = func(models.AlertsQuery, *[]models.Alert) ([]models.Alert, error)
+type GetFiringAlertsMock = func(*[]models.Alert) ([]models.Alert, error)
+type FireAlertMock = func(models.Alert, *[]models.Alert) (models.Alert, error)
+type ResolveAlertMock = func(string, int64, *[]models.Alert) error
+
+type AlertModelMock struct {
+	Alerts []models.Alert
+	GetAllAlertsMock
+	GetFiringAlertsMock
+	FireAlertMock
+	ResolveAlertMock
+}
+
+func (m *AlertModelMock) GetAll(q models.AlertsQuery) ([]models.Alert, error) {
+	return m.GetAllAlertsMock(q, &m.Alerts)
+}
+
+func (m *AlertModelMock) GetFiring() ([]models.Alert, error) {
+	return m.GetFiringAlertsMock(&m.Alerts)
+}
+
+func (m *AlertModelMock) FireAlert(a models.Alert) (models.Alert, error) {
+	return m.FireAlertMock(a, &m.Alerts)
+}
+
+func (m *AlertModelMock) ResolveAlert(id string, resolvedAt int64) error {
+	return m.ResolveAlertMock(id, resolvedAt, &m.Alerts)
+}
+
+func GetAllAlertsOkMock(q models.AlertsQuery, alerts *[]models.Alert) ([]models.Alert, error) {
+	return *alerts, nil
+}
+
+func GetAllAlertsErrorMock(q models.AlertsQuery, alerts *[]models.Alert) ([]models.Alert, error) {
+	return nil, errors.New("database error")
+}
+
+func GetFiringAlertsOkMock(alerts *[]models.Alert) ([]models.Alert, error) {
+	firing := make([]models.Alert, 0)
+	for _, a := range *alerts {
+		if a.Status == models.AlertStatusFiring {
+			firing = append(firing, a)
+		}
+	}
+	return firing, nil
+}
+
+func FireAlertOkMock(a models.Alert, alerts *[]models.Alert) (models.Alert, error) {
+	a.ID = fmt.Sprintf("uuid-%d", len(*alerts)+1)
+	a.Status = models.AlertStatusFiring
+	*alerts = append(*alerts, a)
+	return a, nil
+}
+
+func FireAlertErrorMock(a models.Alert, alerts *[]models.Alert) (models.Alert, error) {
+	return models.Alert{}, errors.New("database error")
+}
+
+func ResolveAlertOkMock(id string, resolvedAt int64, alerts *[]models.Alert) error {
+	for i, a := range *alerts {
+		if a.ID == id && a.Status == models.AlertStatusFiring {
+			(*alerts)[i].Status = models.AlertStatusResolved
+			(*alerts)[i].ResolvedAt = resolvedAt
+			return nil
+		}
+	}
+	return models.ErrAlertNotFound
+}
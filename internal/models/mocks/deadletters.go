@@ -0,0 +1,58 @@
+package mocks
+
+import (
+	"errors"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+)
+
+type InsertDeadLetterMock = func(models.DeadLetter, *[]models.DeadLetter) (string, error)
+type GetAllDeadLettersMock = func(models.DeadLettersQuery, *[]models.DeadLetter) ([]models.DeadLetter, error)
+type DeleteDeadLetterMock = func(string, *[]models.DeadLetter) error
+
+type DeadLetterModelMock struct {
+	DeadLetters []models.DeadLetter
+	InsertDeadLetterMock
+	GetAllDeadLettersMock
+	DeleteDeadLetterMock
+}
+
+func (m *DeadLetterModelMock) InsertDeadLetter(d models.DeadLetter) (string, error) {
+	return m.InsertDeadLetterMock(d, &m.DeadLetters)
+}
+
+func (m *DeadLetterModelMock) GetAll(q models.DeadLettersQuery) ([]models.DeadLetter, error) {
+	return m.GetAllDeadLettersMock(q, &m.DeadLetters)
+}
+
+func (m *DeadLetterModelMock) Delete(id string) error {
+	return m.DeleteDeadLetterMock(id, &m.DeadLetters)
+}
+
+func InsertDeadLetterOkMock(d models.DeadLetter, deadLetters *[]models.DeadLetter) (string, error) {
+	d.ID = "uuid"
+	*deadLetters = append(*deadLetters, d)
+	return d.ID, nil
+}
+
+func GetAllDeadLettersOkMock(q models.DeadLettersQuery, deadLetters *[]models.DeadLetter) ([]models.DeadLetter, error) {
+	return *deadLetters, nil
+}
+
+func GetAllDeadLettersErrorMock(q models.DeadLettersQuery, deadLetters *[]models.DeadLetter) ([]models.DeadLetter, error) {
+	return nil, errors.New("database error")
+}
+
+func DeleteDeadLetterOkMock(id string, deadLetters *[]models.DeadLetter) error {
+	remaining := make([]models.DeadLetter, 0, len(*deadLetters))
+	for _, d := range *deadLetters {
+		if d.ID != id {
+			remaining = append(remaining, d)
+		}
+	}
+	if len(remaining) == len(*deadLetters) {
+		return models.ErrDeadLetterNotFound
+	}
+	*deadLetters = remaining
+	return nil
+}
@@ -1,21 +1,40 @@
 package mocks
 
-import "github.com/miselaytes-anton/airy/internal/models"
+import (
+	"errors"
+	"slices"
+	"sort"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+)
 
 type InsertMeasurementMock = func(models.Measurement, *[]models.Measurement) (string, error)
 
+type InsertMeasurementsMock = func([]models.Measurement, *[]models.Measurement) (models.InsertResult, error)
+
 type GetMeasurementsMock = func(models.MeasurementsQuery, *[]models.Measurement) ([]models.Measurement, error)
 
+type StreamMeasurementsMock = func(models.MeasurementsQuery, func(models.Measurement) error, *[]models.Measurement) error
+
+type GetLatestMeasurementsMock = func(*[]models.Measurement) ([]models.Measurement, error)
+
 type MeasurementModelMock struct {
 	Measurements []models.Measurement
 	InsertMeasurementMock
+	InsertMeasurementsMock
 	GetMeasurementsMock
+	StreamMeasurementsMock
+	GetLatestMeasurementsMock
 }
 
 func (m *MeasurementModelMock) InsertMeasurement(measurement models.Measurement) (string, error) {
 	return m.InsertMeasurementMock(measurement, &m.Measurements)
 }
 
+func (m *MeasurementModelMock) InsertMeasurements(measurements []models.Measurement) (models.InsertResult, error) {
+	return m.InsertMeasurementsMock(measurements, &m.Measurements)
+}
+
 func (m *MeasurementModelMock) GetMeasurements(mq models.MeasurementsQuery) ([]models.Measurement, error) {
 	return m.GetMeasurementsMock(mq, &m.Measurements)
 }
@@ -23,3 +42,47 @@ func (m *MeasurementModelMock) GetMeasurements(mq models.MeasurementsQuery) ([]m
 func GetMeasurementsOkMock(mq models.MeasurementsQuery, measurements *[]models.Measurement) ([]models.Measurement, error) {
 	return *measurements, nil
 }
+
+func (m *MeasurementModelMock) StreamMeasurements(mq models.MeasurementsQuery, fn func(models.Measurement) error) error {
+	return m.StreamMeasurementsMock(mq, fn, &m.Measurements)
+}
+
+// StreamMeasurementsOkMock calls fn for the measurements of the queried sensors.
+func StreamMeasurementsOkMock(mq models.MeasurementsQuery, fn func(models.Measurement) error, measurements *[]models.Measurement) error {
+	for _, m := range *measurements {
+		if !slices.Contains(mq.SensorIDs, m.SensorID) {
+			continue
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StreamMeasurementsErrorMock fails before any measurement is read.
+func StreamMeasurementsErrorMock(mq models.MeasurementsQuery, fn func(models.Measurement) error, measurements *[]models.Measurement) error {
+	return errors.New("could not query measurements")
+}
+
+func (m *MeasurementModelMock) GetLatest() ([]models.Measurement, error) {
+	return m.GetLatestMeasurementsMock(&m.Measurements)
+}
+
+// GetLatestMeasurementsOkMock returns the measurement with the greatest timestamp of every sensor, ordered by sensor.
+func GetLatestMeasurementsOkMock(measurements *[]models.Measurement) ([]models.Measurement, error) {
+	latest := make(map[string]models.Measurement)
+	for _, m := range *measurements {
+		if l, ok := latest[m.SensorID]; !ok || m.Timestamp > l.Timestamp {
+			latest[m.SensorID] = m
+		}
+	}
+
+	result := make([]models.Measurement, 0, len(latest))
+	for _, m := range latest {
+		result = append(result, m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].SensorID < result[j].SensorID })
+
+	return result, nil
+}
@@ -0,0 +1,55 @@
+package mocks
+
+import (
+	"errors"
+)
+
+type RefreshRollupsMock = func(*[][2]int64) (int, error)
+type BuildRollupsMock = func(int64, int64, *[][2]int64) error
+type GetRollupsRangeMock = func(*[][2]int64) (int64, int64, bool, error)
+type SetRollupsBackfilledMock = func(int64, *[]int64) error
+
+type RollupModelMock struct {
+	// Built are the ranges rollups were built for.
+	Built [][2]int64
+	// Backfilled are the epochs the rollups were recorded as complete from.
+	Backfilled []int64
+	RefreshRollupsMock
+	BuildRollupsMock
+	GetRollupsRangeMock
+	SetRollupsBackfilledMock
+}
+
+func (m *RollupModelMock) Refresh() (int, error) {
+	return m.RefreshRollupsMock(&m.Built)
+}
+
+func (m *RollupModelMock) Build(startEpoch int64, endEpoch int64) error {
+	return m.BuildRollupsMock(startEpoch, endEpoch, &m.Built)
+}
+
+func (m *RollupModelMock) GetRange() (int64, int64, bool, error) {
+	return m.GetRollupsRangeMock(&m.Built)
+}
+
+func (m *RollupModelMock) SetBackfilled(epoch int64) error {
+	return m.SetRollupsBackfilledMock(epoch, &m.Backfilled)
+}
+
+func RefreshRollupsOkMock(built *[][2]int64) (int, error) {
+	return 1, nil
+}
+
+func RefreshRollupsErrorMock(built *[][2]int64) (int, error) {
+	return 0, errors.New("database error")
+}
+
+func BuildRollupsOkMock(startEpoch int64, endEpoch int64, built *[][2]int64) error {
+	*built = append(*built, [2]int64{startEpoch, endEpoch})
+	return nil
+}
+
+func SetRollupsBackfilledOkMock(epoch int64, backfilled *[]int64) error {
+	*backfilled = append(*backfilled, epoch)
+	return nil
+}
@@ -0,0 +1,149 @@
+package mocks
+
+import (
+	"errors"
+
+	"github.com/miselaytes-anton/airy/internal/models"
+)
+
+type GetAllSensorsMock = func(*[]models.Sensor) ([]models.Sensor, error)
+type GetSensorMock = func(string, *[]models.Sensor) (models.Sensor, error)
+type InsertSensorMock = func(models.Sensor, *[]models.Sensor) (models.Sensor, error)
+type UpdateSensorMock = func(models.Sensor, *[]models.Sensor) (models.Sensor, error)
+type DeleteSensorMock = func(string, *[]models.Sensor) error
+type RegisterSightingsMock = func([]models.SensorSighting, *[]models.Sensor) error
+type SetSensorStatusMock = func(string, string, int64, *[]models.Sensor) error
+
+type SensorModelMock struct {
+	Sensors []models.Sensor
+	GetAllSensorsMock
+	GetSensorMock
+	InsertSensorMock
+	UpdateSensorMock
+	DeleteSensorMock
+	RegisterSightingsMock
+	SetSensorStatusMock
+}
+
+func (m *SensorModelMock) GetAll() ([]models.Sensor, error) {
+	return m.GetAllSensorsMock(&m.Sensors)
+}
+
+func (m *SensorModelMock) Get(id string) (models.Sensor, error) {
+	return m.GetSensorMock(id, &m.Sensors)
+}
+
+func (m *SensorModelMock) InsertSensor(s models.Sensor) (models.Sensor, error) {
+	return m.InsertSensorMock(s, &m.Sensors)
+}
+
+func (m *SensorModelMock) UpdateSensor(s models.Sensor) (models.Sensor, error) {
+	return m.UpdateSensorMock(s, &m.Sensors)
+}
+
+func (m *SensorModelMock) DeleteSensor(id string) error {
+	return m.DeleteSensorMock(id, &m.Sensors)
+}
+
+func (m *SensorModelMock) RegisterSightings(sightings []models.SensorSighting) error {
+	return m.RegisterSightingsMock(sightings, &m.Sensors)
+}
+
+func (m *SensorModelMock) SetStatus(id string, status string, changedAt int64) error {
+	return m.SetSensorStatusMock(id, status, changedAt, &m.Sensors)
+}
+
+func GetAllSensorsOkMock(sensors *[]models.Sensor) ([]models.Sensor, error) {
+	return *sensors, nil
+}
+
+func GetAllSensorsErrorMock(sensors *[]models.Sensor) ([]models.Sensor, error) {
+	return nil, errors.New("database error")
+}
+
+func GetSensorOkMock(id string, sensors *[]models.Sensor) (models.Sensor, error) {
+	for _, s := range *sensors {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return models.Sensor{}, models.ErrSensorNotFound
+}
+
+func InsertSensorOkMock(s models.Sensor, sensors *[]models.Sensor) (models.Sensor, error) {
+	for _, existing := range *sensors {
+		if existing.ID == s.ID {
+			return models.Sensor{}, models.ErrDuplicateSensor
+		}
+	}
+	*sensors = append(*sensors, s)
+	return s, nil
+}
+
+func UpdateSensorOkMock(s models.Sensor, sensors *[]models.Sensor) (models.Sensor, error) {
+	for i, existing := range *sensors {
+		if existing.ID == s.ID {
+			(*sensors)[i] = s
+			return s, nil
+		}
+	}
+	return models.Sensor{}, models.ErrSensorNotFound
+}
+
+func DeleteSensorOkMock(id string, sensors *[]models.Sensor) error {
+	remaining := make([]models.Sensor, 0, len(*sensors))
+	for _, s := range *sensors {
+		if s.ID != id {
+			remaining = append(remaining, s)
+		}
+	}
+	if len(remaining) == len(*sensors) {
+		return models.ErrSensorNotFound
+	}
+	*sensors = remaining
+	return nil
+}
+
+// RegisterSightingsOkMock registers unknown sensors and updates last seen times and firmware versions of known ones.
+func RegisterSightingsOkMock(sightings []models.SensorSighting, sensors *[]models.Sensor) error {
+	for _, sighting := range sightings {
+		found := false
+		for i, s := range *sensors {
+			if s.ID != sighting.SensorID {
+				continue
+			}
+			found = true
+			if sighting.Timestamp > s.LastSeen {
+				(*sensors)[i].LastSeen = sighting.Timestamp
+			}
+			if sighting.FirmwareVersion != "" {
+				(*sensors)[i].FirmwareVersion = sighting.FirmwareVersion
+			}
+		}
+		if !found {
+			*sensors = append(*sensors, models.Sensor{
+				ID:              sighting.SensorID,
+				FirmwareVersion: sighting.FirmwareVersion,
+				FirstSeen:       sighting.Timestamp,
+				LastSeen:        sighting.Timestamp,
+				Status:          models.SensorStatusUnknown,
+			})
+		}
+	}
+	return nil
+}
+
+func RegisterSightingsErrorMock(sightings []models.SensorSighting, sensors *[]models.Sensor) error {
+	return errors.New("database error")
+}
+
+func SetSensorStatusOkMock(id string, status string, changedAt int64, sensors *[]models.Sensor) error {
+	for i, s := range *sensors {
+		if s.ID == id {
+			(*sensors)[i].Status = status
+			(*sensors)[i].StatusChangedAt = changedAt
+			return nil
+		}
+	}
+	return models.ErrSensorNotFound
+}
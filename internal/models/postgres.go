@@ -0,0 +1,34 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/lib/pq"
+)
+
+// IsUnavailableError reports whether err was caused by the database being unreachable rather than by the query itself,
+// in which case the query can be retried once the database is back.
+func IsUnavailableError(err error) bool {
+	// https://www.postgresql.org/docs/current/errcodes-appendix.html
+	// 08: connection exception, 53: insufficient resources, 57: operator intervention (e.g. admin shutdown)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		class := pqErr.Code.Class()
+		return class == "08" || class == "53" || class == "57"
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET)
+}
@@ -0,0 +1,288 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// rollup is a table of measurements pre-aggregated per resolution and sensor, so that long ranges are queried
+// from a few rows per day rather than from every measurement.
+type rollup struct {
+	table      string
+	resolution int
+}
+
+// rollups are ordered from the finest to the coarsest, every rollup is built from the previous one
+// and the finest one from the measurements, so every resolution is a multiple of the previous one.
+var rollups = []rollup{
+	{"measurements_5m", 5 * 60},
+	{"measurements_1h", 3600},
+	{"measurements_1d", 24 * 3600},
+}
+
+// rollupParts are the aggregations a rollup stores of every metric, in columns named after the metric and the part, e.g. co2_sum.
+// The count is the number of measurements with a value of the metric, measurements of sensors without e.g. a VOC sensor
+// have no value for it.
+var rollupParts = []string{"count", "sum", "min", "max", "first", "last"}
+
+// rollupExpressions are the SQL expressions of the aggregations of a metric of a rollup,
+// percentiles can not be derived from the parts, so they are always aggregated from the measurements.
+var rollupExpressions = map[Aggregation]string{
+	AggregationAvg:   `sum("%[1]s_sum")/sum("%[1]s_count")`,
+	AggregationMin:   `min("%[1]s_min")`,
+	AggregationMax:   `max("%[1]s_max")`,
+	AggregationFirst: `(array_agg("%[1]s_first" order by "timestamp" asc) filter (where "%[1]s_first" is not null))[1]`,
+	AggregationLast:  `(array_agg("%[1]s_last" order by "timestamp" desc) filter (where "%[1]s_last" is not null))[1]`,
+	AggregationCount: `sum("%[1]s_count")::double precision`,
+}
+
+// rollupSource is what a rollup is built from, the count and the parts are aggregated from its rows.
+type rollupSource struct {
+	table string
+	count string
+	parts map[string]string
+}
+
+var measurementsRollupSource = rollupSource{
+	table: "measurements",
+	count: `count(*)`,
+	parts: map[string]string{
+		"count": `count("%s")`,
+		"sum":   `sum("%s")`,
+		"min":   aggregationExpressions[AggregationMin],
+		"max":   aggregationExpressions[AggregationMax],
+		"first": aggregationExpressions[AggregationFirst],
+		"last":  aggregationExpressions[AggregationLast],
+	},
+}
+
+// rollupSourceOf returns the source of the rollup with the index in rollups.
+func rollupSourceOf(i int) rollupSource {
+	if i == 0 {
+		return measurementsRollupSource
+	}
+
+	return rollupSource{
+		table: rollups[i-1].table,
+		count: `sum("count")`,
+		parts: map[string]string{
+			"count": `sum("%s_count")`,
+			"sum":   `sum("%s_sum")`,
+			"min":   rollupExpressions[AggregationMin],
+			"max":   rollupExpressions[AggregationMax],
+			"first": rollupExpressions[AggregationFirst],
+			"last":  rollupExpressions[AggregationLast],
+		},
+	}
+}
+
+// findRollup returns the coarsest rollup a query can be answered from with the same result as from the measurements:
+// the resolution and the range must consist of whole rollup buckets and the aggregation must be derivable from the parts.
+func findRollup(mq MeasurementsQuery, aggregation Aggregation) (rollup, bool) {
+	// the envelope consists of the average, the minimum and the maximum
+	if _, ok := rollupExpressions[aggregation]; !ok && aggregation != AggregationEnvelope {
+		return rollup{}, false
+	}
+
+	for i := len(rollups) - 1; i >= 0; i-- {
+		resolution := int64(rollups[i].resolution)
+		if int64(mq.Resolution)%resolution == 0 && mq.StartEpoch%resolution == 0 && (mq.EndEpoch+1)%resolution == 0 {
+			return rollups[i], true
+		}
+	}
+
+	return rollup{}, false
+}
+
+// rollupQuery returns the statement which rebuilds the buckets of the rollup from the rows of source selected by filter,
+// a join or a where clause of the source aliased as s.
+func rollupQuery(r rollup, source rollupSource, filter string) string {
+	columns := []string{`"count"`}
+	expressions := []string{source.count}
+	for _, metric := range measurementColumns {
+		for _, part := range rollupParts {
+			columns = append(columns, fmt.Sprintf(`"%s_%s"`, metric, part))
+			expressions = append(expressions, fmt.Sprintf(source.parts[part], metric))
+		}
+	}
+
+	setters := make([]string, 0, len(columns))
+	for _, column := range columns {
+		setters = append(setters, fmt.Sprintf(`%s = excluded.%s`, column, column))
+	}
+
+	return fmt.Sprintf(`
+	insert into "%[1]s" ("sensor_id", "timestamp", %[2]s)
+	select s."sensor_id", (floor(s."timestamp"/%[3]d)*%[3]d)::integer, %[4]s
+	from "%[5]s" as s %[6]s
+	group by s."sensor_id", (floor(s."timestamp"/%[3]d)*%[3]d)::integer
+	on conflict ("sensor_id", "timestamp") do update set %[7]s
+	`,
+		r.table,
+		strings.Join(columns, ", "),
+		r.resolution,
+		strings.Join(expressions, ",\n\t"),
+		source.table,
+		filter,
+		strings.Join(setters, ",\n\t\t"),
+	)
+}
+
+// markPendingRollups returns a statement which marks the buckets of the finest rollup the rows of source fall into
+// as pending, to be used as a common table expression of the statement changing measurements.
+func markPendingRollups(source string) string {
+	return fmt.Sprintf(`
+	insert into "measurement_rollups_pending" ("sensor_id", "timestamp")
+	select distinct "sensor_id", (floor("timestamp"/%[1]d)*%[1]d)::integer from %[2]s
+	on conflict do nothing
+	`, rollups[0].resolution, source)
+}
+
+type RollupModelInterface interface {
+	Refresh() (int, error)
+	Build(startEpoch int64, endEpoch int64) error
+	GetRange() (int64, int64, bool, error)
+	SetBackfilled(epoch int64) error
+}
+
+// RollupModel maintains the rollups of the measurements. Inserted and updated measurements mark their buckets as pending,
+// Refresh rebuilds them. Build rebuilds the rollups of a range, e.g. of measurements stored before the rollups existed,
+// SetBackfilled records from when on the rollups are complete, so that earlier ranges are not queried from them.
+type RollupModel struct {
+	DB *sql.DB
+}
+
+// rollupKey is a bucket of a sensor.
+type rollupKey struct {
+	sensorID  string
+	timestamp int64
+}
+
+// Refresh rebuilds the pending buckets of all rollups and returns how many buckets of the finest rollup were rebuilt.
+// Buckets which are marked while the rollups are refreshed stay pending until the next refresh.
+func (m RollupModel) Refresh() (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`delete from "measurement_rollups_pending" returning "sensor_id", "timestamp"`)
+	if err != nil {
+		return 0, err
+	}
+
+	keys := make([]rollupKey, 0)
+	for rows.Next() {
+		var key rollupKey
+		if err := rows.Scan(&key.sensorID, &key.timestamp); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(keys) == 0 {
+		return 0, tx.Commit()
+	}
+
+	for i, r := range rollups {
+		sensorIDs, timestamps := rollupBuckets(keys, r.resolution)
+		filter := fmt.Sprintf(`
+	join unnest($1::varchar[], $2::int[]) as k("sensor_id", "bucket")
+	on s."sensor_id" = k."sensor_id" and s."timestamp" >= k."bucket" and s."timestamp" < k."bucket" + %d`, r.resolution)
+
+		if _, err := tx.Exec(rollupQuery(r, rollupSourceOf(i), filter), pq.Array(sensorIDs), pq.Array(timestamps)); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(keys), tx.Commit()
+}
+
+// rollupBuckets returns the distinct buckets of the resolution the keys fall into, as columns.
+func rollupBuckets(keys []rollupKey, resolution int) ([]string, []int64) {
+	seen := make(map[rollupKey]bool, len(keys))
+	sensorIDs, timestamps := make([]string, 0, len(keys)), make([]int64, 0, len(keys))
+
+	for _, key := range keys {
+		bucket := rollupKey{key.sensorID, key.timestamp - key.timestamp%int64(resolution)}
+		if seen[bucket] {
+			continue
+		}
+		seen[bucket] = true
+		sensorIDs = append(sensorIDs, bucket.sensorID)
+		timestamps = append(timestamps, bucket.timestamp)
+	}
+
+	return sensorIDs, timestamps
+}
+
+// Build rebuilds the rollups of the measurements between startEpoch (included) and endEpoch (excluded),
+// both must be multiples of the coarsest resolution, i.e. whole days in UTC.
+func (m RollupModel) Build(startEpoch int64, endEpoch int64) error {
+	resolution := int64(rollups[len(rollups)-1].resolution)
+	if startEpoch%resolution != 0 || endEpoch%resolution != 0 {
+		return fmt.Errorf("rollups can only be built for whole buckets of %d seconds", resolution)
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i, r := range rollups {
+		if _, err := tx.Exec(rollupQuery(r, rollupSourceOf(i), `where s."timestamp" >= $1 and s."timestamp" < $2`), startEpoch, endEpoch); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetRange returns the timestamps of the first and the last measurement, false when there are no measurements.
+func (m RollupModel) GetRange() (int64, int64, bool, error) {
+	var first, last sql.NullInt64
+
+	err := m.DB.QueryRow(`select min("timestamp"), max("timestamp") from "measurements"`).Scan(&first, &last)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	return first.Int64, last.Int64, first.Valid, nil
+}
+
+// SetBackfilled records that the rollups of all measurements from epoch on are built,
+// the recorded epoch only ever moves back, so building a later range again keeps it.
+func (m RollupModel) SetBackfilled(epoch int64) error {
+	_, err := m.DB.Exec(`
+	insert into "measurement_rollups_backfill" ("timestamp") values ($1)
+	on conflict ("id") do update set "timestamp" = least("measurement_rollups_backfill"."timestamp", excluded."timestamp")
+	`, epoch)
+
+	return err
+}
+
+// GetBackfilled returns from when on the rollups are complete, false when they were never backfilled.
+func (m RollupModel) GetBackfilled() (int64, bool, error) {
+	var epoch int64
+
+	err := m.DB.QueryRow(`select "timestamp" from "measurement_rollups_backfill"`).Scan(&epoch)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	return epoch, true, nil
+}
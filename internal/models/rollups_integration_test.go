@@ -0,0 +1,147 @@
+//go:build integration
+
+package models
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_RollupModel(t *testing.T) {
+	db := newTestDB(t)
+	measurements := MeasurementModel{DB: db}
+	rollups := RollupModel{DB: db}
+
+	_, err := measurements.InsertMeasurements([]Measurement{
+		{Timestamp: 0, SensorID: "bedroom", CO2: 400},
+		{Timestamp: 60, SensorID: "bedroom", CO2: 1100},
+		{Timestamp: 3600, SensorID: "bedroom", CO2: 600},
+		// metrics without a value are left out of the averages and counts
+		{Timestamp: 3660, SensorID: "bedroom", CO2: 700, Missing: []string{"voc"}},
+		{Timestamp: 86400, SensorID: "bedroom", CO2: 800},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refreshed, err := rollups.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(3, refreshed); diff != "" {
+		t.Error(diff)
+	}
+
+	// measurements inserted one at a time are rolled up as well
+	if _, err := measurements.InsertMeasurement(Measurement{Timestamp: 120, SensorID: "bedroom", CO2: 900}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rollups.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rollups.SetBackfilled(0); err != nil {
+		t.Fatal(err)
+	}
+
+	withRollups := MeasurementModel{DB: db, Rollups: true}
+	for _, aggregation := range []Aggregation{AggregationAvg, AggregationMin, AggregationMax, AggregationFirst, AggregationLast, AggregationCount, AggregationEnvelope} {
+		for _, resolution := range []int{300, 3600, 86400} {
+			query := MeasurementsQuery{StartEpoch: 0, EndEpoch: 2*86400 - 1, Resolution: resolution, SensorIDs: []string{"bedroom"}, Aggregation: aggregation}
+
+			expected, err := measurements.GetMeasurements(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, err := withRollups.GetMeasurements(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(expected, actual); diff != "" {
+				t.Errorf("%s per %d: %s", aggregation, resolution, diff)
+			}
+		}
+	}
+}
+
+func Test_RollupModel_Build(t *testing.T) {
+	db := newTestDB(t)
+	measurements := MeasurementModel{DB: db}
+	rollups := RollupModel{DB: db}
+
+	_, err := measurements.InsertMeasurements([]Measurement{
+		{Timestamp: 0, SensorID: "bedroom", CO2: 400},
+		{Timestamp: 86400 + 60, SensorID: "bedroom", CO2: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, last, ok, err := rollups.GetRange()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]interface{}{int64(0), int64(86400 + 60), true}, []interface{}{first, last, ok}); diff != "" {
+		t.Error(diff)
+	}
+
+	// only the first day is built
+	if err := rollups.Build(0, 86400); err != nil {
+		t.Fatal(err)
+	}
+
+	withRollups := MeasurementModel{DB: db, Rollups: true}
+	query := MeasurementsQuery{StartEpoch: 0, EndEpoch: 2*86400 - 1, Resolution: 86400, SensorIDs: []string{"bedroom"}}
+	both := []Measurement{{Timestamp: 0, SensorID: "bedroom", CO2: 400}, {Timestamp: 86400, SensorID: "bedroom", CO2: 1000}}
+
+	// rollups which were never backfilled are not queried
+	actual, err := withRollups.GetMeasurements(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(both, actual); diff != "" {
+		t.Error(diff)
+	}
+
+	// ranges starting before the backfilled rollups are aggregated from the measurements
+	if err := rollups.SetBackfilled(86400); err != nil {
+		t.Fatal(err)
+	}
+	actual, err = withRollups.GetMeasurements(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(both, actual); diff != "" {
+		t.Error(diff)
+	}
+
+	if err := rollups.SetBackfilled(0); err != nil {
+		t.Fatal(err)
+	}
+	// the backfilled epoch only moves back
+	if err := rollups.SetBackfilled(86400); err != nil {
+		t.Fatal(err)
+	}
+	backfilled, ok, err := rollups.GetBackfilled()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]interface{}{int64(0), true}, []interface{}{backfilled, ok}); diff != "" {
+		t.Error(diff)
+	}
+
+	// the second day was not built, so it is missing from the rollups
+	actual, err = withRollups.GetMeasurements(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]Measurement{{Timestamp: 0, SensorID: "bedroom", CO2: 400}}, actual); diff != "" {
+		t.Error(diff)
+	}
+
+	if err := rollups.Build(1, 86400); err == nil {
+		t.Error("expected an error")
+	}
+}
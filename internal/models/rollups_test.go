@@ -0,0 +1,49 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_findRollup(t *testing.T) {
+	data := []struct {
+		name        string
+		query       MeasurementsQuery
+		aggregation Aggregation
+		expected    string
+	}{
+		{"whole days", MeasurementsQuery{StartEpoch: 0, EndEpoch: 7*86400 - 1, Resolution: 86400}, AggregationAvg, "measurements_1d"},
+		{"whole days, hourly resolution", MeasurementsQuery{StartEpoch: 0, EndEpoch: 7*86400 - 1, Resolution: 3 * 3600}, AggregationMax, "measurements_1h"},
+		{"days in another timezone", MeasurementsQuery{StartEpoch: 82800, EndEpoch: 82800 + 86400 - 1, Resolution: 86400}, AggregationEnvelope, "measurements_1h"},
+		{"ten minutes", MeasurementsQuery{StartEpoch: 600, EndEpoch: 1199, Resolution: 600}, AggregationCount, "measurements_5m"},
+		{"minutes", MeasurementsQuery{StartEpoch: 0, EndEpoch: 86400 - 1, Resolution: 60}, AggregationAvg, ""},
+		{"unaligned start", MeasurementsQuery{StartEpoch: 1, EndEpoch: 86400 - 1, Resolution: 86400}, AggregationAvg, ""},
+		{"unaligned end", MeasurementsQuery{StartEpoch: 0, EndEpoch: 86400, Resolution: 86400}, AggregationAvg, ""},
+		{"percentile", MeasurementsQuery{StartEpoch: 0, EndEpoch: 86400 - 1, Resolution: 86400}, AggregationP95, ""},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				r, _ := findRollup(d.query, d.aggregation)
+				if diff := cmp.Diff(d.expected, r.table); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
+
+func Test_rollupBuckets(t *testing.T) {
+	keys := []rollupKey{{"bedroom", 0}, {"bedroom", 300}, {"kitchen", 300}, {"bedroom", 3600}}
+
+	sensorIDs, timestamps := rollupBuckets(keys, 3600)
+	if diff := cmp.Diff([]string{"bedroom", "kitchen", "bedroom"}, sensorIDs); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([]int64{0, 0, 3600}, timestamps); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,208 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/lib/pq"
+)
+
+var ErrDuplicateSensor = errors.New("sensor with this id already exists")
+var ErrSensorNotFound = errors.New("sensor not found")
+var ErrReservedSensorID = errors.New(`sensor id "status" is reserved`)
+
+// ReservedSensorID can not be used as a sensor id, /api/sensors/status serves the status of all sensors.
+const ReservedSensorID = "status"
+
+func mapPostgresSensorError(err error) error {
+	// check for a postgres duplicate key error using error code
+	// https://www.postgresql.org/docs/9.5/errcodes-appendix.html
+	pqErr, ok := err.(*pq.Error)
+	if ok && string(pqErr.Code) == pgerrcode.UniqueViolation {
+		return ErrDuplicateSensor
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSensorNotFound
+	}
+	return err
+}
+
+// Sensor statuses, a sensor is offline when it did not send a message within the configured silence window.
+const (
+	SensorStatusUnknown = "unknown"
+	SensorStatusOnline  = "online"
+	SensorStatusOffline = "offline"
+)
+
+type SensorModelInterface interface {
+	GetAll() ([]Sensor, error)
+	Get(id string) (Sensor, error)
+	InsertSensor(Sensor) (Sensor, error)
+	UpdateSensor(Sensor) (Sensor, error)
+	DeleteSensor(id string) error
+	RegisterSightings([]SensorSighting) error
+	SetStatus(id string, status string, changedAt int64) error
+}
+
+// Sensor represents a registered sensor.
+type Sensor struct {
+	ID              string `json:"id"`
+	DisplayName     string `json:"displayName"`
+	Location        string `json:"location"`
+	FirmwareVersion string `json:"firmwareVersion"`
+	FirstSeen       int64  `json:"firstSeen,omitempty"`
+	LastSeen        int64  `json:"lastSeen,omitempty"`
+	Status          string `json:"status"`
+	StatusChangedAt int64  `json:"statusChangedAt,omitempty"`
+}
+
+// SensorSighting represents a sensor which sent a message at the given time.
+type SensorSighting struct {
+	SensorID        string
+	FirmwareVersion string
+	Timestamp       int64
+}
+
+// SensorModel represents a sensor model.
+type SensorModel struct {
+	DB *sql.DB
+}
+
+const sensorColumns = `id, display_name, location, firmware_version, coalesce(first_seen, 0), coalesce(last_seen, 0), status, coalesce(status_changed_at, 0)`
+
+func scanSensor(row interface{ Scan(...any) error }) (Sensor, error) {
+	var s Sensor
+	err := row.Scan(&s.ID, &s.DisplayName, &s.Location, &s.FirmwareVersion, &s.FirstSeen, &s.LastSeen, &s.Status, &s.StatusChangedAt)
+	return s, err
+}
+
+// GetAll returns all sensors ordered by id.
+func (m SensorModel) GetAll() ([]Sensor, error) {
+	rows, err := m.DB.Query(`select ` + sensorColumns + ` from "sensors" order by id asc`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	sensors := make([]Sensor, 0)
+
+	for rows.Next() {
+		s, err := scanSensor(rows)
+		if err != nil {
+			return nil, err
+		}
+		sensors = append(sensors, s)
+	}
+
+	return sensors, rows.Err()
+}
+
+// Get returns a single sensor.
+func (m SensorModel) Get(id string) (Sensor, error) {
+	s, err := scanSensor(m.DB.QueryRow(`select `+sensorColumns+` from "sensors" where id = $1`, id))
+	if err != nil {
+		return Sensor{}, mapPostgresSensorError(err)
+	}
+
+	return s, nil
+}
+
+// InsertSensor registers a new sensor.
+func (m SensorModel) InsertSensor(s Sensor) (Sensor, error) {
+	query := `insert into "sensors"("id", "display_name", "location", "firmware_version") values($1, $2, $3, $4)
+		returning ` + sensorColumns
+
+	s, err := scanSensor(m.DB.QueryRow(query, s.ID, s.DisplayName, s.Location, s.FirmwareVersion))
+	if err != nil {
+		return Sensor{}, mapPostgresSensorError(err)
+	}
+
+	return s, nil
+}
+
+// UpdateSensor updates display name, location and firmware version of a sensor.
+func (m SensorModel) UpdateSensor(s Sensor) (Sensor, error) {
+	query := `update "sensors" set
+			"display_name" = $2,
+			"location" = $3,
+			"firmware_version" = $4
+			where "id" = $1
+			returning ` + sensorColumns
+
+	s, err := scanSensor(m.DB.QueryRow(query, s.ID, s.DisplayName, s.Location, s.FirmwareVersion))
+	if err != nil {
+		return Sensor{}, mapPostgresSensorError(err)
+	}
+
+	return s, nil
+}
+
+// DeleteSensor removes a sensor from the registry, its measurements are kept.
+func (m SensorModel) DeleteSensor(id string) error {
+	result, err := m.DB.Exec(`delete from "sensors" where "id" = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrSensorNotFound
+	}
+
+	return nil
+}
+
+// RegisterSightings updates first and last seen times and firmware versions of sensors,
+// sensors which are not registered yet are registered automatically.
+func (m SensorModel) RegisterSightings(sightings []SensorSighting) error {
+	if len(sightings) == 0 {
+		return nil
+	}
+
+	query := `
+	insert into "sensors" ("id", "firmware_version", "first_seen", "last_seen")
+	select "id", "firmware_version", "timestamp", "timestamp"
+	from unnest($1::varchar[], $2::varchar[], $3::int[]) as t("id", "firmware_version", "timestamp")
+	on conflict ("id") do update set
+		"first_seen" = least("sensors"."first_seen", excluded."first_seen"),
+		"last_seen" = greatest("sensors"."last_seen", excluded."last_seen"),
+		"firmware_version" = coalesce(nullif(excluded."firmware_version", ''), "sensors"."firmware_version")
+	`
+
+	ids, firmwareVersions, timestamps := make([]string, 0), make([]string, 0), make([]int64, 0)
+	for _, s := range sightings {
+		ids = append(ids, s.SensorID)
+		firmwareVersions = append(firmwareVersions, s.FirmwareVersion)
+		timestamps = append(timestamps, s.Timestamp)
+	}
+
+	_, err := m.DB.Exec(query, pq.Array(ids), pq.Array(firmwareVersions), pq.Array(timestamps))
+
+	return err
+}
+
+// SetStatus stores the online status of a sensor and the time it changed.
+func (m SensorModel) SetStatus(id string, status string, changedAt int64) error {
+	result, err := m.DB.Exec(`update "sensors" set "status" = $2, "status_changed_at" = $3 where "id" = $1`, id, status, changedAt)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrSensorNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+//go:build integration
+
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_SensorModel(t *testing.T) {
+	db := newTestDB(t)
+	model := SensorModel{DB: db}
+
+	// sensors are seeded by the schema
+	sensors, err := model.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Sensor{
+		{ID: "bedroom", DisplayName: "Bedroom", Location: "bedroom", Status: SensorStatusUnknown},
+		{ID: "livingroom", DisplayName: "Living room", Location: "livingroom", Status: SensorStatusUnknown},
+	}
+	if diff := cmp.Diff(expected, sensors); diff != "" {
+		t.Error(diff)
+	}
+
+	kitchen, err := model.InsertSensor(Sensor{ID: "kitchen", DisplayName: "Kitchen"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := model.InsertSensor(kitchen); !errors.Is(err, ErrDuplicateSensor) {
+		t.Errorf("expected %v, got %v", ErrDuplicateSensor, err)
+	}
+
+	kitchen.Location = "ground floor"
+	if _, err := model.UpdateSensor(kitchen); err != nil {
+		t.Fatal(err)
+	}
+
+	err = model.RegisterSightings([]SensorSighting{
+		{SensorID: "kitchen", FirmwareVersion: "1.2.0", Timestamp: 20},
+		{SensorID: "hallway", Timestamp: 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = model.RegisterSightings([]SensorSighting{{SensorID: "kitchen", Timestamp: 5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := model.SetStatus("kitchen", SensorStatusOnline, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := model.SetStatus("garage", SensorStatusOnline, 5); !errors.Is(err, ErrSensorNotFound) {
+		t.Errorf("expected %v, got %v", ErrSensorNotFound, err)
+	}
+
+	kitchen, err = model.Get("kitchen")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedKitchen := Sensor{ID: "kitchen", DisplayName: "Kitchen", Location: "ground floor", FirmwareVersion: "1.2.0", FirstSeen: 5, LastSeen: 20, Status: SensorStatusOnline, StatusChangedAt: 5}
+	if diff := cmp.Diff(expectedKitchen, kitchen); diff != "" {
+		t.Error(diff)
+	}
+
+	hallway, err := model.Get("hallway")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(Sensor{ID: "hallway", FirstSeen: 10, LastSeen: 10, Status: SensorStatusUnknown}, hallway); diff != "" {
+		t.Error(diff)
+	}
+
+	if err := model.DeleteSensor("hallway"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := model.Get("hallway"); !errors.Is(err, ErrSensorNotFound) {
+		t.Errorf("expected %v, got %v", ErrSensorNotFound, err)
+	}
+
+	if err := model.DeleteSensor("hallway"); !errors.Is(err, ErrSensorNotFound) {
+		t.Errorf("expected %v, got %v", ErrSensorNotFound, err)
+	}
+}
@@ -0,0 +1,39 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"text/template"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// publisher is the part of an MQTT client used to publish notifications.
+type publisher interface {
+	Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token
+}
+
+// MQTT republishes notifications to a topic, e.g. for home automation systems.
+type MQTT struct {
+	Client publisher
+	Topic  string
+	QOS    byte
+	// Template renders the payload, the notification is encoded as JSON when it is nil.
+	Template *template.Template
+}
+
+func (m MQTT) Notify(ctx context.Context, n Notification) error {
+	payload, err := renderPayload(m.Template, n)
+	if err != nil {
+		return err
+	}
+
+	token := m.Client.Publish(m.Topic, m.QOS, false, payload)
+
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return errors.Join(errors.New("notification was not published in time"), ctx.Err())
+	}
+}
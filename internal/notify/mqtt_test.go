@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/go-cmp/cmp"
+)
+
+type tokenStub struct {
+	mqtt.Token
+	done chan struct{}
+	err  error
+}
+
+func (t tokenStub) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t tokenStub) Error() error {
+	return t.err
+}
+
+type publisherStub struct {
+	topic   string
+	payload string
+	token   tokenStub
+}
+
+func (p *publisherStub) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	p.topic = topic
+	p.payload = string(payload.([]byte))
+	return p.token
+}
+
+func Test_MQTT(t *testing.T) {
+	published := make(chan struct{})
+	close(published)
+
+	data := []struct {
+		name        string
+		token       tokenStub
+		expectError bool
+	}{
+		{"published", tokenStub{done: published}, false},
+		{"publish error", tokenStub{done: published, err: errors.New("not connected")}, true},
+		{"timeout", tokenStub{done: make(chan struct{})}, true},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				client := &publisherStub{token: d.token}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+				defer cancel()
+
+				err := MQTT{Client: client, Topic: "airy/notifications"}.Notify(ctx, Notification{Key: "bedroom", Kind: KindSensor, Status: "online", SensorID: "bedroom", Timestamp: 1})
+
+				if diff := cmp.Diff(d.expectError, err != nil); diff != "" {
+					t.Errorf("unexpected error %v: %s", err, diff)
+				}
+
+				expected := []string{"airy/notifications", `{"key":"bedroom","kind":"sensor","status":"online","sensorId":"bedroom","timestamp":1}`}
+				if diff := cmp.Diff(expected, []string{client.topic, client.payload}); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,235 @@
+// Package notify delivers alert and sensor status notifications to channels such as webhooks, email and MQTT topics.
+//
+// Notifications are dispatched asynchronously, every channel retries failed deliveries with exponential backoff
+// and suppresses notifications repeating the last delivered status of their key, so that a sensor reporting the same
+// status over and over does not spam anyone.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"text/template"
+	"time"
+)
+
+// Notification kinds.
+const (
+	KindAlert  = "alert"
+	KindSensor = "sensor"
+)
+
+// Notification describes a change of an alert or of the status of a sensor.
+type Notification struct {
+	// Key identifies the subject of the notification, e.g. an alert rule and a sensor.
+	Key string `json:"key"`
+	// Kind is either KindAlert or KindSensor.
+	Kind string `json:"kind"`
+	// Status is firing or resolved for alerts and offline or online for sensors.
+	Status   string `json:"status"`
+	SensorID string `json:"sensorId"`
+	// Rule describes the alert rule, e.g. "co2 of bedroom above 1000".
+	Rule   string  `json:"rule,omitempty"`
+	Metric string  `json:"metric,omitempty"`
+	Value  float64 `json:"value,omitempty"`
+	// Band is the name of the comfort band the value is in, e.g. "poor".
+	Band      string `json:"band,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// Summary returns a one line description of the notification.
+func (n Notification) Summary() string {
+	if n.Kind == KindAlert && n.Band != "" {
+		return fmt.Sprintf("[%s] %s, value %g (%s)", n.Status, n.Rule, n.Value, n.Band)
+	}
+	if n.Kind == KindAlert {
+		return fmt.Sprintf("[%s] %s, value %g", n.Status, n.Rule, n.Value)
+	}
+	return fmt.Sprintf("[%s] sensor %s", n.Status, n.SensorID)
+}
+
+// Notifier delivers a notification to a single destination.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// render executes a template with the notification, or returns the summary when the template is nil.
+func render(t *template.Template, n Notification) (string, error) {
+	if t == nil {
+		return n.Summary(), nil
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, n); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// renderPayload executes a template with the notification, or encodes the notification as JSON when the template is nil.
+func renderPayload(t *template.Template, n Notification) ([]byte, error) {
+	if t == nil {
+		return json.Marshal(n)
+	}
+
+	s, err := render(t, n)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(s), nil
+}
+
+// Channel is a destination notifications are dispatched to.
+type Channel struct {
+	Name     string
+	Notifier Notifier
+	// Attempts is the number of delivery attempts, including the first one.
+	Attempts int
+	// Backoff is the delay before the second attempt, it doubles with every further attempt up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout limits a single delivery attempt.
+	Timeout time.Duration
+	// DedupeWindow is how long a notification is suppressed after one with the same key and status was delivered,
+	// unless a notification with another status was delivered in between.
+	DedupeWindow time.Duration
+}
+
+type DispatcherOpts struct {
+	Channels []Channel
+	// QueueSize is the number of notifications per channel waiting to be delivered, further notifications are dropped.
+	QueueSize int
+	Now       func() time.Time
+	LogError  *log.Logger
+	LogInfo   *log.Logger
+}
+
+// Dispatcher delivers notifications to all channels in the background.
+type Dispatcher struct {
+	DispatcherOpts
+	queues []chan Notification
+	// stop cancels pending retries when the dispatcher is closed.
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewDispatcher creates a dispatcher and starts a worker per channel.
+func NewDispatcher(o DispatcherOpts) *Dispatcher {
+	d := &Dispatcher{
+		DispatcherOpts: o,
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+
+	workers := make(chan struct{}, len(o.Channels))
+	for _, c := range o.Channels {
+		queue := make(chan Notification, o.QueueSize)
+		d.queues = append(d.queues, queue)
+		go func(c Channel) {
+			d.work(c, queue)
+			workers <- struct{}{}
+		}(c)
+	}
+
+	go func() {
+		for range o.Channels {
+			<-workers
+		}
+		close(d.done)
+	}()
+
+	return d
+}
+
+// Dispatch queues a notification for all channels without blocking.
+func (d *Dispatcher) Dispatch(n Notification) {
+	for i, queue := range d.queues {
+		select {
+		case queue <- n:
+		default:
+			d.LogError.Printf("notification dropped, queue of channel %s is full: %s", d.Channels[i].Name, n.Summary())
+		}
+	}
+}
+
+// Close stops accepting notifications and blocks until queued notifications are delivered.
+// Failed deliveries are not retried anymore, so that Close does not wait for backoffs.
+func (d *Dispatcher) Close() {
+	close(d.stop)
+	for _, queue := range d.queues {
+		close(queue)
+	}
+	<-d.done
+}
+
+func (d *Dispatcher) work(c Channel, queue chan Notification) {
+	type delivery struct {
+		status string
+		at     time.Time
+	}
+	// delivered is the last delivered notification per key, only a repeat of its status is suppressed,
+	// so that e.g. an alert firing again after it was resolved is never mistaken for a repeat of the first firing
+	delivered := make(map[string]delivery)
+
+	for n := range queue {
+		now := d.Now()
+
+		if last, ok := delivered[n.Key]; ok && last.status == n.Status && now.Sub(last.at) < c.DedupeWindow {
+			d.LogInfo.Printf("notification suppressed for channel %s: %s\n", c.Name, n.Summary())
+			continue
+		}
+
+		if err := d.deliver(c, n); err != nil {
+			d.LogError.Printf("notification could not be delivered to channel %s after %d attempts (%s): %s", c.Name, c.Attempts, n.Summary(), err)
+			continue
+		}
+
+		delivered[n.Key] = delivery{status: n.Status, at: now}
+
+		// forget old deliveries so that the map does not grow without bounds
+		for k, last := range delivered {
+			if now.Sub(last.at) >= c.DedupeWindow {
+				delete(delivered, k)
+			}
+		}
+	}
+}
+
+// deliver sends a notification, retrying with exponential backoff.
+func (d *Dispatcher) deliver(c Channel, n Notification) error {
+	backoff := c.Backoff
+
+	var err error
+	for attempt := 1; attempt <= c.Attempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+		err = c.Notifier.Notify(ctx, n)
+		cancel()
+
+		if err == nil {
+			d.LogInfo.Printf("notification delivered to channel %s: %s\n", c.Name, n.Summary())
+			return nil
+		}
+
+		if attempt == c.Attempts {
+			break
+		}
+
+		d.LogError.Printf("notification delivery to channel %s failed, retrying in %s: %s", c.Name, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-d.stop:
+			return fmt.Errorf("dispatcher closed before retrying: %w", err)
+		}
+
+		backoff *= 2
+		if backoff > c.MaxBackoff {
+			backoff = c.MaxBackoff
+		}
+	}
+
+	return err
+}
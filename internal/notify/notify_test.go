@@ -0,0 +1,221 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// notifierStub records notifications and fails the first failures deliveries.
+type notifierStub struct {
+	mu            sync.Mutex
+	failures      int
+	attempts      int
+	notifications []Notification
+}
+
+func (s *notifierStub) Notify(ctx context.Context, n Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attempts++
+	if s.attempts <= s.failures {
+		return errors.New("connection refused")
+	}
+
+	s.notifications = append(s.notifications, n)
+	return nil
+}
+
+// made returns the number of delivery attempts made so far.
+func (s *notifierStub) made() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts
+}
+
+// waitForAttempts waits until the notifier was called attempts times.
+func waitForAttempts(t *testing.T, s *notifierStub, attempts int) {
+	deadline := time.Now().Add(time.Second)
+	for s.made() < attempts {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d attempts, got %d", attempts, s.made())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func newTestDispatcher(now func() time.Time, channels ...Channel) *Dispatcher {
+	return NewDispatcher(DispatcherOpts{
+		Channels:  channels,
+		QueueSize: 10,
+		Now:       now,
+		LogError:  log.New(io.Discard, "", 0),
+		LogInfo:   log.New(io.Discard, "", 0),
+	})
+}
+
+func newTestChannel(notifier Notifier, attempts int) Channel {
+	return Channel{
+		Name:         "test",
+		Notifier:     notifier,
+		Attempts:     attempts,
+		Backoff:      time.Millisecond,
+		MaxBackoff:   2 * time.Millisecond,
+		Timeout:      time.Second,
+		DedupeWindow: time.Minute,
+	}
+}
+
+func Test_Dispatcher_retry(t *testing.T) {
+	data := []struct {
+		name             string
+		failures         int
+		expectedAttempts int
+		expectedNotified int
+	}{
+		{"delivered", 0, 1, 1},
+		{"delivered after retries", 2, 3, 1},
+		{"given up", 5, 3, 0},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				notifier := &notifierStub{failures: d.failures}
+				dispatcher := newTestDispatcher(time.Now, newTestChannel(notifier, 3))
+
+				dispatcher.Dispatch(Notification{Key: "bedroom", Kind: KindSensor, Status: "offline", SensorID: "bedroom"})
+				// Close cancels retries, wait for them first
+				waitForAttempts(t, notifier, d.expectedAttempts)
+				dispatcher.Close()
+
+				if diff := cmp.Diff([]int{d.expectedAttempts, d.expectedNotified}, []int{notifier.attempts, len(notifier.notifications)}); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
+
+func Test_Dispatcher_Close(t *testing.T) {
+	notifier := &notifierStub{failures: 5}
+	channel := newTestChannel(notifier, 3)
+	channel.Backoff = time.Hour
+	channel.MaxBackoff = time.Hour
+	dispatcher := newTestDispatcher(time.Now, channel)
+
+	dispatcher.Dispatch(Notification{Key: "bedroom", Kind: KindSensor, Status: "offline", SensorID: "bedroom"})
+	dispatcher.Dispatch(Notification{Key: "kitchen", Kind: KindSensor, Status: "offline", SensorID: "kitchen"})
+	waitForAttempts(t, notifier, 1)
+
+	// the backoff sleep is cancelled, queued notifications are attempted once
+	closed := make(chan struct{})
+	go func() {
+		dispatcher.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close is waiting for the backoff")
+	}
+
+	if diff := cmp.Diff(2, notifier.made()); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_Dispatcher_dedupe(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Unix(1702156335, 0)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	notifier := &notifierStub{}
+	other := &notifierStub{}
+	dispatcher := newTestDispatcher(clock, newTestChannel(notifier, 1), newTestChannel(other, 1))
+
+	firing := Notification{Key: "co2:bedroom", Kind: KindAlert, Status: "firing", SensorID: "bedroom"}
+	resolved := Notification{Key: "co2:bedroom", Kind: KindAlert, Status: "resolved", SensorID: "bedroom"}
+
+	// repeats of the last delivered status are suppressed within the dedupe window, changes of the status never are
+	dispatcher.Dispatch(firing)
+	dispatcher.Dispatch(firing)
+	dispatcher.Dispatch(resolved)
+	dispatcher.Dispatch(firing)
+	dispatcher.Dispatch(firing)
+	// a different subject is not suppressed
+	dispatcher.Dispatch(Notification{Key: "co2:livingroom", Kind: KindAlert, Status: "firing", SensorID: "livingroom"})
+
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	now = now.Add(2 * time.Minute)
+	mu.Unlock()
+
+	dispatcher.Dispatch(firing)
+	dispatcher.Close()
+
+	statuses := func(notifier *notifierStub) []string {
+		statuses := make([]string, 0)
+		for _, n := range notifier.notifications {
+			statuses = append(statuses, n.Key+" "+n.Status)
+		}
+		return statuses
+	}
+
+	expected := []string{"co2:bedroom firing", "co2:bedroom resolved", "co2:bedroom firing", "co2:livingroom firing", "co2:bedroom firing"}
+	if diff := cmp.Diff(expected, statuses(notifier)); diff != "" {
+		t.Error(diff)
+	}
+
+	if diff := cmp.Diff(expected, statuses(other)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_Notification_Summary(t *testing.T) {
+	data := []struct {
+		name         string
+		notification Notification
+		expected     string
+	}{
+		{
+			"alert",
+			Notification{Kind: KindAlert, Status: "firing", Rule: "co2 of bedroom above 1000", Value: 1100},
+			"[firing] co2 of bedroom above 1000, value 1100",
+		},
+		{
+			"alert with band",
+			Notification{Kind: KindAlert, Status: "firing", Rule: "co2 of bedroom above 1000", Value: 1300, Band: "poor"},
+			"[firing] co2 of bedroom above 1000, value 1300 (poor)",
+		},
+		{
+			"sensor",
+			Notification{Kind: KindSensor, Status: "offline", SensorID: "bedroom"},
+			"[offline] sensor bedroom",
+		},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				if diff := cmp.Diff(d.expected, d.notification.Summary()); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,119 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// SMTP sends notifications as plain text emails.
+type SMTP struct {
+	// Address is the host:port of the mail server.
+	Address  string
+	Username string
+	Password string
+	From     string
+	To       []string
+	// SubjectTemplate and BodyTemplate render the email, the summary of the notification is used when they are nil.
+	SubjectTemplate *template.Template
+	BodyTemplate    *template.Template
+
+	// rootCAs verify the certificate of the mail server, the system roots when nil.
+	rootCAs *x509.CertPool
+}
+
+func (s SMTP) Notify(ctx context.Context, n Notification) error {
+	subject, err := render(s.SubjectTemplate, n)
+	if err != nil {
+		return err
+	}
+
+	body, err := render(s.BodyTemplate, n)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	host, _, err := net.SplitHostPort(s.Address)
+	if err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		// the certificate is verified against the host the mail server was addressed with
+		if err := c.StartTLS(&tls.Config{ServerName: host, RootCAs: s.rootCAs}); err != nil {
+			return err
+		}
+	}
+
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(s.From); err != nil {
+		return err
+	}
+
+	for _, to := range s.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(s.message(subject, body)); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// headerReplacer replaces line breaks in header values.
+var headerReplacer = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+func (s SMTP) message(subject string, body string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.To, ", "))
+	// line breaks in the subject would end the header and inject further headers
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerReplacer.Replace(subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
@@ -0,0 +1,232 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// smtpStandIn is a minimal SMTP server which accepts a single message.
+type smtpStandIn struct {
+	listener net.Listener
+	// tls lets the stand-in advertise STARTTLS and PLAIN authentication when set.
+	tls        *tls.Config
+	auth       string
+	encrypted  bool
+	recipients []string
+	data       string
+	done       chan struct{}
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	return newSMTPStandInWithTLS(t, nil)
+}
+
+func newSMTPStandInWithTLS(t *testing.T, config *tls.Config) *smtpStandIn {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	s := &smtpStandIn{listener: l, tls: config, done: make(chan struct{})}
+	go s.serve()
+
+	return s
+}
+
+// testCertificate returns the configuration of a server with a certificate for 127.0.0.1 and the pool which trusts it.
+func testCertificate() (*tls.Config, *x509.CertPool) {
+	server := httptest.NewTLSServer(nil)
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	return &tls.Config{Certificates: server.TLS.Certificates}, pool
+}
+
+func (s *smtpStandIn) serve() {
+	defer close(s.done)
+
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer func() { conn.Close() }()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+
+		switch {
+		case strings.HasPrefix(command, "EHLO") && s.tls != nil && !s.encrypted:
+			reply("250-localhost")
+			reply("250 STARTTLS")
+		case strings.HasPrefix(command, "EHLO") && s.encrypted:
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case command == "STARTTLS" && s.tls != nil:
+			reply("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, r, s.encrypted = tlsConn, bufio.NewReader(tlsConn), true
+		case strings.HasPrefix(command, "AUTH PLAIN") && s.encrypted:
+			s.auth = strings.TrimSpace(line[len("AUTH PLAIN"):])
+			reply("235 authenticated")
+		case strings.HasPrefix(command, "MAIL FROM"):
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO"):
+			s.recipients = append(s.recipients, strings.TrimSpace(line[len("RCPT TO:"):]))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.data = data.String()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func Test_SMTP(t *testing.T) {
+	standIn := newSMTPStandIn(t)
+
+	notifier := SMTP{
+		Address:         standIn.listener.Addr().String(),
+		From:            "airy@example.com",
+		To:              []string{"anton@example.com", "home@example.com"},
+		SubjectTemplate: template.Must(template.New("subject").Parse(`{{.SensorID}} is {{.Status}}`)),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := notifier.Notify(ctx, Notification{Key: "bedroom", Kind: KindSensor, Status: "offline", SensorID: "bedroom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-standIn.done
+
+	if diff := cmp.Diff([]string{"<anton@example.com>", "<home@example.com>"}, standIn.recipients); diff != "" {
+		t.Error(diff)
+	}
+
+	for _, expected := range []string{"Subject: bedroom is offline\r\n", "To: anton@example.com, home@example.com\r\n", "\r\n\r\n[offline] sensor bedroom\r\n"} {
+		if !strings.Contains(standIn.data, expected) {
+			t.Errorf("expected message to contain %q, got %q", expected, standIn.data)
+		}
+	}
+}
+
+func Test_SMTP_starttls(t *testing.T) {
+	config, pool := testCertificate()
+	standIn := newSMTPStandInWithTLS(t, config)
+
+	notifier := SMTP{
+		Address:  standIn.listener.Addr().String(),
+		Username: "airy",
+		Password: "secret",
+		From:     "airy@example.com",
+		To:       []string{"anton@example.com"},
+		rootCAs:  pool,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := notifier.Notify(ctx, Notification{Key: "bedroom", Kind: KindSensor, Status: "offline", SensorID: "bedroom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-standIn.done
+
+	// the credentials are only sent once the connection is encrypted
+	if diff := cmp.Diff([]any{true, "AGFpcnkAc2VjcmV0", []string{"<anton@example.com>"}}, []any{standIn.encrypted, standIn.auth, standIn.recipients}); diff != "" {
+		t.Error(diff)
+	}
+	if !strings.Contains(standIn.data, "\r\n\r\n[offline] sensor bedroom\r\n") {
+		t.Errorf("expected the notification to be sent, got %q", standIn.data)
+	}
+}
+
+func Test_SMTP_unreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	err = SMTP{Address: address, From: "airy@example.com", To: []string{"anton@example.com"}}.Notify(context.Background(), Notification{})
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func Test_SMTP_message_subject(t *testing.T) {
+	data := []struct {
+		name     string
+		subject  string
+		expected string
+	}{
+		{"plain", "bedroom is offline", "Subject: bedroom is offline\r\n"},
+		{"line feed", "bedroom\nBcc: eve@example.com", "Subject: bedroom Bcc: eve@example.com\r\n"},
+		{"carriage return", "bedroom\rBcc: eve@example.com", "Subject: bedroom Bcc: eve@example.com\r\n"},
+		{"carriage return and line feed", "bedroom\r\nBcc: eve@example.com", "Subject: bedroom Bcc: eve@example.com\r\n"},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				message := string(SMTP{From: "airy@example.com", To: []string{"anton@example.com"}}.message(d.subject, "body"))
+
+				headers, _, _ := strings.Cut(message, "\r\n\r\n")
+				if strings.Contains(headers, "\r\nBcc:") {
+					t.Errorf("expected no injected header, got %q", headers)
+				}
+				if !strings.Contains(headers, d.expected) {
+					t.Errorf("expected headers to contain %q, got %q", d.expected, headers)
+				}
+			},
+		)
+	}
+}
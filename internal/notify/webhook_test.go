@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"text/template"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_Webhook(t *testing.T) {
+	n := Notification{Key: "bedroom", Kind: KindSensor, Status: "offline", SensorID: "bedroom", Timestamp: 1702156335}
+
+	data := []struct {
+		name         string
+		template     *template.Template
+		status       int
+		expectedBody string
+		expectError  bool
+	}{
+		{
+			"json",
+			nil,
+			http.StatusOK,
+			`{"key":"bedroom","kind":"sensor","status":"offline","sensorId":"bedroom","timestamp":1702156335}`,
+			false,
+		},
+		{
+			"template",
+			template.Must(template.New("webhook").Parse(`{"text": "{{.Summary}}"}`)),
+			http.StatusNoContent,
+			`{"text": "[offline] sensor bedroom"}`,
+			false,
+		},
+		{
+			"error status",
+			nil,
+			http.StatusBadGateway,
+			`{"key":"bedroom","kind":"sensor","status":"offline","sensorId":"bedroom","timestamp":1702156335}`,
+			true,
+		},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				var body string
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					b, _ := io.ReadAll(r.Body)
+					body = string(b)
+					w.WriteHeader(d.status)
+				}))
+				defer server.Close()
+
+				err := Webhook{URL: server.URL, Template: d.template}.Notify(context.Background(), n)
+
+				if diff := cmp.Diff(d.expectError, err != nil); diff != "" {
+					t.Errorf("unexpected error %v: %s", err, diff)
+				}
+
+				if diff := cmp.Diff(d.expectedBody, body); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
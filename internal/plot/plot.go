@@ -0,0 +1,401 @@
+// Package plot draws time series charts as SVG and PNG images without a browser.
+//
+// A chart is laid out once and drawn on a canvas, so that both formats show the same lines,
+// shaded time ranges, value bands and markers.
+package plot
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Point is a value at a time.
+type Point struct {
+	Epoch int64
+	Value float64
+}
+
+// Range is the spread of values at a time, e.g. the lowest and highest values of an aggregated interval.
+type Range struct {
+	Epoch    int64
+	Min, Max float64
+}
+
+// Series is a line of points ordered by time.
+type Series struct {
+	Name   string
+	Points []Point
+	// Envelope is shaded in the color of the series, ordered by time, every range lasts until the next one.
+	Envelope []Range
+}
+
+// Area shades a time range, e.g. an event.
+type Area struct {
+	Name       string
+	Color      string
+	Start, End int64
+}
+
+// Band shades a range of values, a missing bound extends the band to the edge of the chart.
+type Band struct {
+	Name     string
+	Color    string
+	Min, Max *float64
+}
+
+// Marker is a vertical line at a time, e.g. the last message of an offline sensor.
+type Marker struct {
+	Name  string
+	Epoch int64
+}
+
+// Chart is a line chart over a time range.
+type Chart struct {
+	Title         string
+	Width, Height int
+	// Start and End are the time range of the x axis, ticks are placed in Location.
+	Start, End int64
+	Location   *time.Location
+	Series     []Series
+	Areas      []Area
+	Bands      []Band
+	Markers    []Marker
+}
+
+// seriesColors are the colors of the series in their order, the same as in the browser charts.
+var seriesColors = []string{"#516b91", "#59c4e6", "#edafda", "#93b7e3", "#a5e7f0", "#cbb0e3"}
+
+// SeriesColor returns the color of the series with the index, e.g. to shade a band in the color of its line.
+func SeriesColor(i int) string {
+	return seriesColors[i%len(seriesColors)]
+}
+
+const (
+	marginLeft   = 56
+	marginRight  = 16
+	marginTop    = 40
+	marginBottom = 28
+	fontSize     = 12
+	textColor    = "#333333"
+	gridColor    = "#e0e0e0"
+)
+
+type anchor int
+
+const (
+	anchorStart anchor = iota
+	anchorMiddle
+	anchorEnd
+)
+
+// canvas is a surface a chart is drawn on, coordinates are in pixels from the top left corner.
+type canvas interface {
+	rect(x, y, w, h float64, color string, opacity float64)
+	line(points [][2]float64, color string, width float64, dashed bool)
+	text(x, y float64, s string, color string, a anchor)
+}
+
+// tick is a labelled position on an axis.
+type tick struct {
+	value float64
+	label string
+}
+
+// layout maps times and values to pixels of the plot area.
+type layout struct {
+	left, top, right, bottom float64
+	start, end               int64
+	min, max                 float64
+}
+
+func (l layout) x(epoch int64) float64 {
+	if l.end == l.start {
+		return l.left
+	}
+	return l.left + float64(epoch-l.start)/float64(l.end-l.start)*(l.right-l.left)
+}
+
+func (l layout) y(value float64) float64 {
+	return l.bottom - (value-l.min)/(l.max-l.min)*(l.bottom-l.top)
+}
+
+// clampX returns the position of the epoch within the plot area.
+func (l layout) clampX(epoch int64) float64 {
+	return math.Min(math.Max(l.x(epoch), l.left), l.right)
+}
+
+// clampY returns the position of the value within the plot area, a missing value is the given edge.
+func (l layout) clampY(value *float64, edge float64) float64 {
+	if value == nil {
+		return edge
+	}
+	return math.Min(math.Max(l.y(*value), l.top), l.bottom)
+}
+
+// niceStep returns a step of 1, 2 or 5 times a power of ten, which divides the span in about count parts.
+func niceStep(span float64, count int) float64 {
+	raw := span / float64(count)
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+
+	for _, factor := range []float64{1, 2, 5} {
+		if raw <= factor*magnitude {
+			return factor * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+// valueTicks returns the ticks of the y axis, the axis is extended to the nearest ticks around the values.
+func valueTicks(series []Series) (float64, float64, []tick) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, s := range series {
+		for _, p := range s.Points {
+			lo = math.Min(lo, p.Value)
+			hi = math.Max(hi, p.Value)
+		}
+		for _, r := range s.Envelope {
+			lo = math.Min(lo, r.Min)
+			hi = math.Max(hi, r.Max)
+		}
+	}
+
+	switch {
+	case math.IsInf(lo, 1):
+		lo, hi = 0, 1
+	case lo == hi:
+		lo, hi = lo-1, hi+1
+	}
+
+	step := niceStep(hi-lo, 5)
+	lo = math.Floor(lo/step) * step
+	hi = math.Ceil(hi/step) * step
+	decimals := max(0, int(-math.Floor(math.Log10(step))))
+
+	ticks := make([]tick, 0)
+	for i := 0; ; i++ {
+		value := lo + float64(i)*step
+		if value > hi+step/2 {
+			break
+		}
+		ticks = append(ticks, tick{value: value, label: strconv.FormatFloat(value, 'f', decimals, 64)})
+	}
+
+	return lo, hi, ticks
+}
+
+// timeStep is an interval between ticks of the time axis.
+type timeStep struct {
+	hours, days, months int
+	format              string
+}
+
+var timeSteps = []timeStep{
+	{hours: 1, format: "15:04"},
+	{hours: 3, format: "15:04"},
+	{hours: 6, format: "15:04"},
+	{hours: 12, format: "15:04"},
+	{days: 1, format: "2 Jan"},
+	{days: 2, format: "2 Jan"},
+	{days: 7, format: "2 Jan"},
+	{months: 1, format: "Jan 2006"},
+	{months: 3, format: "Jan 2006"},
+	{months: 12, format: "2006"},
+}
+
+// approximate returns the approximate length of the step in seconds.
+func (s timeStep) approximate() int64 {
+	return int64(s.hours)*3600 + int64(s.days)*24*3600 + int64(s.months)*30*24*3600
+}
+
+// timeTicks returns ticks at whole hours, days or months in the location, at most maxTicks of them.
+func timeTicks(start int64, end int64, location *time.Location, maxTicks int) []tick {
+	step := timeSteps[len(timeSteps)-1]
+	for _, s := range timeSteps {
+		if (end-start)/s.approximate() < int64(maxTicks) {
+			step = s
+			break
+		}
+	}
+
+	t := time.Unix(start, 0).In(location)
+	switch {
+	case step.hours > 0:
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, location)
+	case step.days > 0:
+		t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+	default:
+		t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, location)
+	}
+
+	ticks := make([]tick, 0)
+	for ; t.Unix() <= end; t = next(t, step, location) {
+		if t.Unix() < start || !aligned(t, step) {
+			continue
+		}
+		ticks = append(ticks, tick{value: float64(t.Unix()), label: t.Format(step.format)})
+	}
+
+	return ticks
+}
+
+// next returns the next candidate of a tick, hours are added as durations so that DST transitions are not skipped.
+func next(t time.Time, step timeStep, location *time.Location) time.Time {
+	switch {
+	case step.hours > 0:
+		return t.Add(time.Hour).In(location)
+	case step.days > 0:
+		return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, location)
+	default:
+		return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, location)
+	}
+}
+
+// aligned reports whether a tick belongs to the step, e.g. every third hour or the first month of a quarter.
+func aligned(t time.Time, step timeStep) bool {
+	switch {
+	case step.hours > 0:
+		return t.Minute() == 0 && t.Hour()%step.hours == 0
+	case step.days == 7:
+		return t.Weekday() == time.Monday
+	case step.days > 0:
+		return (t.YearDay()-1)%step.days == 0
+	default:
+		return (int(t.Month())-1)%step.months == 0
+	}
+}
+
+// draw lays the chart out and draws it on the canvas.
+func (c Chart) draw(cv canvas) {
+	location := c.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	lo, hi, yTicks := valueTicks(c.Series)
+	l := layout{
+		left:   marginLeft,
+		top:    marginTop,
+		right:  float64(c.Width - marginRight),
+		bottom: float64(c.Height - marginBottom),
+		start:  c.Start,
+		end:    c.End,
+		min:    lo,
+		max:    hi,
+	}
+
+	cv.rect(0, 0, float64(c.Width), float64(c.Height), "#ffffff", 1)
+	cv.text(8, 18, c.Title, textColor, anchorStart)
+
+	// legend
+	x := l.right
+	for i := len(c.Series) - 1; i >= 0; i-- {
+		color := SeriesColor(i)
+		cv.text(x, 18, c.Series[i].Name, textColor, anchorEnd)
+		x -= textWidth(c.Series[i].Name) + 4
+		cv.rect(x-12, 10, 12, 8, color, 1)
+		x -= 24
+	}
+
+	for _, band := range c.Bands {
+		top, bottom := l.clampY(band.Max, l.top), l.clampY(band.Min, l.bottom)
+		if bottom <= top {
+			continue
+		}
+		cv.rect(l.left, top, l.right-l.left, bottom-top, band.Color, 0.1)
+		cv.text(l.right-4, top+fontSize, band.Name, textColor, anchorEnd)
+	}
+
+	for _, t := range yTicks {
+		y := l.y(t.value)
+		cv.line([][2]float64{{l.left, y}, {l.right, y}}, gridColor, 1, false)
+		cv.text(l.left-6, y+fontSize/2-2, t.label, textColor, anchorEnd)
+	}
+
+	for _, t := range timeTicks(c.Start, c.End, location, int((l.right-l.left)/80)) {
+		x := l.x(int64(t.value))
+		cv.line([][2]float64{{x, l.bottom}, {x, l.bottom + 4}}, textColor, 1, false)
+		cv.text(x, l.bottom+fontSize+6, t.label, textColor, anchorMiddle)
+	}
+
+	for _, area := range c.Areas {
+		start, end := l.clampX(area.Start), l.clampX(area.End)
+		if end <= start {
+			continue
+		}
+		cv.rect(start, l.top, end-start, l.bottom-l.top, area.Color, 0.2)
+		cv.text(start+2, l.top+fontSize, area.Name, textColor, anchorStart)
+	}
+
+	for _, marker := range c.Markers {
+		if marker.Epoch < c.Start || marker.Epoch > c.End {
+			continue
+		}
+		x := l.x(marker.Epoch)
+		cv.line([][2]float64{{x, l.top}, {x, l.bottom}}, textColor, 1, true)
+		cv.text(x, l.top-4, marker.Name, textColor, anchorMiddle)
+	}
+
+	cv.line([][2]float64{{l.left, l.bottom}, {l.right, l.bottom}}, textColor, 1, false)
+
+	for i, s := range c.Series {
+		for j, r := range s.Envelope {
+			// the last range lasts as long as the one before it
+			var end int64
+			switch {
+			case j+1 < len(s.Envelope):
+				end = s.Envelope[j+1].Epoch
+			case j > 0:
+				end = 2*r.Epoch - s.Envelope[j-1].Epoch
+			default:
+				continue
+			}
+
+			start, stop := l.clampX(r.Epoch), l.clampX(end)
+			top, bottom := l.y(r.Max), l.y(r.Min)
+			if stop <= start || bottom <= top {
+				continue
+			}
+			cv.rect(start, top, stop-start, bottom-top, SeriesColor(i), 0.2)
+		}
+	}
+
+	for i, s := range c.Series {
+		points := make([][2]float64, 0, len(s.Points))
+		for _, p := range s.Points {
+			if p.Epoch < c.Start || p.Epoch > c.End {
+				continue
+			}
+			points = append(points, [2]float64{l.x(p.Epoch), l.y(p.Value)})
+		}
+		cv.line(points, SeriesColor(i), 2, false)
+	}
+}
+
+// textWidth estimates the width of the text, both formats use a font about 7 pixels wide.
+func textWidth(s string) float64 {
+	return float64(len([]rune(s)) * 7)
+}
+
+// parseColor parses hex colors such as #00e400 or #0e4, other colors are drawn gray.
+func parseColor(s string) color.NRGBA {
+	gray := color.NRGBA{R: 0x80, G: 0x80, B: 0x80, A: 0xff}
+
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 || !strings.HasPrefix(s, "#") {
+		return gray
+	}
+
+	var r, g, b uint8
+	if _, err := fmt.Sscanf(hex, "%02x%02x%02x", &r, &g, &b); err != nil {
+		return gray
+	}
+
+	return color.NRGBA{R: r, G: g, B: b, A: 0xff}
+}
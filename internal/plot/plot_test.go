@@ -0,0 +1,177 @@
+package plot
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func bound(value float64) *float64 {
+	return &value
+}
+
+func testChart() Chart {
+	return Chart{
+		Title:  "CO2",
+		Width:  800,
+		Height: 400,
+		Start:  0,
+		End:    24 * 3600,
+		Series: []Series{
+			{Name: "Bedroom", Points: []Point{{0, 400}, {3600, 900}, {7200, 1300}}, Envelope: []Range{{0, 350, 450}, {3600, 700, 1000}, {7200, 1100, 1400}}},
+			{Name: "livingroom", Points: []Point{{0, 500}, {3600, 600}}},
+		},
+		Areas:   []Area{{Name: "window:open", Color: "#5470c6", Start: 1800, End: 5400}},
+		Bands:   []Band{{Name: "moderate", Color: "#ffff00", Min: bound(800), Max: bound(1200)}},
+		Markers: []Marker{{Name: "offline", Epoch: 3600}},
+	}
+}
+
+func Test_valueTicks(t *testing.T) {
+	data := []struct {
+		name     string
+		series   []Series
+		expected []string
+	}{
+		{"rounded to the step", []Series{{Points: []Point{{0, 412}, {1, 1288}}}}, []string{"400", "600", "800", "1000", "1200", "1400"}},
+		{"fractions", []Series{{Points: []Point{{0, 20.3}, {1, 21.1}}}}, []string{"20.2", "20.4", "20.6", "20.8", "21.0", "21.2"}},
+		{"single value", []Series{{Points: []Point{{0, 5}}}}, []string{"4.0", "4.5", "5.0", "5.5", "6.0"}},
+		{"no values", []Series{}, []string{"0.0", "0.2", "0.4", "0.6", "0.8", "1.0"}},
+		{"envelope", []Series{{Points: []Point{{0, 500}, {1, 900}}, Envelope: []Range{{0, 412, 600}, {1, 800, 1288}}}}, []string{"400", "600", "800", "1000", "1200", "1400"}},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				_, _, ticks := valueTicks(d.series)
+				labels := make([]string, 0, len(ticks))
+				for _, tick := range ticks {
+					labels = append(labels, tick.label)
+				}
+				if diff := cmp.Diff(d.expected, labels); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
+
+func Test_timeTicks(t *testing.T) {
+	amsterdam, _ := time.LoadLocation("Europe/Amsterdam")
+
+	data := []struct {
+		name     string
+		start    time.Time
+		end      time.Time
+		expected []string
+	}{
+		{
+			"day",
+			time.Date(2023, 3, 25, 0, 0, 0, 0, amsterdam),
+			time.Date(2023, 3, 25, 23, 59, 59, 0, amsterdam),
+			[]string{"00:00", "03:00", "06:00", "09:00", "12:00", "15:00", "18:00", "21:00"},
+		},
+		{
+			"day with DST transition",
+			time.Date(2023, 3, 26, 0, 0, 0, 0, amsterdam),
+			time.Date(2023, 3, 26, 23, 59, 59, 0, amsterdam),
+			[]string{"00:00", "03:00", "06:00", "09:00", "12:00", "15:00", "18:00", "21:00"},
+		},
+		{
+			"week",
+			time.Date(2023, 3, 19, 0, 0, 0, 0, amsterdam),
+			time.Date(2023, 3, 26, 23, 59, 59, 0, amsterdam),
+			[]string{"19 Mar", "20 Mar", "21 Mar", "22 Mar", "23 Mar", "24 Mar", "25 Mar", "26 Mar"},
+		},
+		{
+			"year",
+			time.Date(2022, 3, 26, 0, 0, 0, 0, amsterdam),
+			time.Date(2023, 3, 26, 23, 59, 59, 0, amsterdam),
+			[]string{"Apr 2022", "Jul 2022", "Oct 2022", "Jan 2023"},
+		},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.name,
+			func(t *testing.T) {
+				labels := make([]string, 0)
+				for _, tick := range timeTicks(d.start.Unix(), d.end.Unix(), amsterdam, 8) {
+					labels = append(labels, tick.label)
+				}
+				if diff := cmp.Diff(d.expected, labels); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
+
+func Test_Chart_SVG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testChart().SVG(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	svg := buf.String()
+	for _, expected := range []string{
+		`<svg xmlns="http://www.w3.org/2000/svg" width="800" height="400"`,
+		`<title>CO2</title>`,
+		`>Bedroom</text>`,
+		`>window:open</text>`,
+		`>moderate</text>`,
+		`>offline</text>`,
+		`stroke-dasharray="4 4"`,
+		// the envelope of the bedroom between 700 and 1000 from 01:00 to 02:00
+		`<rect x="86.3" y="150.7" width="30.3" height="66.4" fill="#516b91" fill-opacity="0.2"/>`,
+	} {
+		if !strings.Contains(svg, expected) {
+			t.Errorf("expected svg to contain %q", expected)
+		}
+	}
+}
+
+func Test_Chart_PNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testChart().PNG(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([2]int{800, 400}, [2]int{img.Bounds().Dx(), img.Bounds().Dy()}); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_parseColor(t *testing.T) {
+	data := []struct {
+		color    string
+		expected [4]uint8
+	}{
+		{"#00e400", [4]uint8{0x00, 0xe4, 0x00, 0xff}},
+		{"#0e4", [4]uint8{0x00, 0xee, 0x44, 0xff}},
+		{"red", [4]uint8{0x80, 0x80, 0x80, 0xff}},
+	}
+
+	for _, d := range data {
+		t.Run(
+			d.color,
+			func(t *testing.T) {
+				c := parseColor(d.color)
+				if diff := cmp.Diff(d.expected, [4]uint8{c.R, c.G, c.B, c.A}); diff != "" {
+					t.Error(diff)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,104 @@
+package plot
+
+import (
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// pngCanvas draws on an image, lines are rasterized with anti-aliasing and text uses a fixed bitmap font.
+type pngCanvas struct {
+	img *image.RGBA
+}
+
+func (c *pngCanvas) rect(x, y, w, h float64, color string, opacity float64) {
+	fill := parseColor(color)
+	fill.A = uint8(math.Round(opacity * 0xff))
+
+	r := image.Rect(int(math.Round(x)), int(math.Round(y)), int(math.Round(x+w)), int(math.Round(y+h)))
+	draw.Draw(c.img, r, image.NewUniform(fill), image.Point{}, draw.Over)
+}
+
+func (c *pngCanvas) line(points [][2]float64, color string, width float64, dashed bool) {
+	if dashed {
+		for _, segment := range dashes(points, 4) {
+			c.line(segment, color, width, false)
+		}
+		return
+	}
+
+	bounds := c.img.Bounds()
+	r := vector.NewRasterizer(bounds.Dx(), bounds.Dy())
+
+	// every segment is a rectangle around it, all of them wind the same way so that overlaps do not cancel out
+	for i := 1; i < len(points); i++ {
+		x0, y0, x1, y1 := points[i-1][0], points[i-1][1], points[i][0], points[i][1]
+		length := math.Hypot(x1-x0, y1-y0)
+		if length == 0 {
+			continue
+		}
+		nx, ny := -(y1-y0)/length*width/2, (x1-x0)/length*width/2
+
+		r.MoveTo(float32(x0+nx), float32(y0+ny))
+		r.LineTo(float32(x1+nx), float32(y1+ny))
+		r.LineTo(float32(x1-nx), float32(y1-ny))
+		r.LineTo(float32(x0-nx), float32(y0-ny))
+		r.ClosePath()
+	}
+
+	r.Draw(c.img, bounds, image.NewUniform(parseColor(color)), image.Point{})
+}
+
+// dashes splits a straight line into dashes of the given length with gaps of the same length.
+func dashes(points [][2]float64, length float64) [][][2]float64 {
+	result := make([][][2]float64, 0)
+	if len(points) < 2 {
+		return result
+	}
+
+	x0, y0, x1, y1 := points[0][0], points[0][1], points[len(points)-1][0], points[len(points)-1][1]
+	total := math.Hypot(x1-x0, y1-y0)
+	for d := 0.0; d < total; d += 2 * length {
+		end := math.Min(d+length, total)
+		result = append(result, [][2]float64{
+			{x0 + (x1-x0)*d/total, y0 + (y1-y0)*d/total},
+			{x0 + (x1-x0)*end/total, y0 + (y1-y0)*end/total},
+		})
+	}
+
+	return result
+}
+
+func (c *pngCanvas) text(x, y float64, s string, color string, a anchor) {
+	d := font.Drawer{
+		Dst:  c.img,
+		Src:  image.NewUniform(parseColor(color)),
+		Face: basicfont.Face7x13,
+	}
+
+	width := d.MeasureString(s).Round()
+	switch a {
+	case anchorMiddle:
+		x -= float64(width) / 2
+	case anchorEnd:
+		x -= float64(width)
+	}
+
+	d.Dot = fixed.P(int(math.Round(x)), int(math.Round(y)))
+	d.DrawString(s)
+}
+
+// PNG writes the chart as a PNG image.
+func (c Chart) PNG(w io.Writer) error {
+	cv := &pngCanvas{img: image.NewRGBA(image.Rect(0, 0, c.Width, c.Height))}
+	c.draw(cv)
+
+	return png.Encode(w, cv.img)
+}
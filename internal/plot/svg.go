@@ -0,0 +1,75 @@
+package plot
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// svgCanvas writes SVG elements, the first write error is kept and later writes are skipped.
+type svgCanvas struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (c *svgCanvas) printf(format string, args ...interface{}) {
+	if c.err != nil {
+		return
+	}
+	_, c.err = fmt.Fprintf(c.w, format, args...)
+}
+
+func (c *svgCanvas) rect(x, y, w, h float64, color string, opacity float64) {
+	c.printf(`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s" fill-opacity="%g"/>`+"\n", x, y, w, h, escape(color), opacity)
+}
+
+func (c *svgCanvas) line(points [][2]float64, color string, width float64, dashed bool) {
+	if len(points) == 0 {
+		return
+	}
+
+	coordinates := make([]string, 0, len(points))
+	for _, p := range points {
+		coordinates = append(coordinates, fmt.Sprintf("%.1f,%.1f", p[0], p[1]))
+	}
+
+	dash := ""
+	if dashed {
+		dash = ` stroke-dasharray="4 4"`
+	}
+
+	c.printf(`<polyline points="%s" fill="none" stroke="%s" stroke-width="%g" stroke-linejoin="round"%s/>`+"\n", strings.Join(coordinates, " "), escape(color), width, dash)
+}
+
+func (c *svgCanvas) text(x, y float64, s string, color string, a anchor) {
+	if s == "" {
+		return
+	}
+
+	textAnchor := map[anchor]string{anchorStart: "start", anchorMiddle: "middle", anchorEnd: "end"}[a]
+	c.printf(`<text x="%.1f" y="%.1f" fill="%s" text-anchor="%s">%s</text>`+"\n", x, y, escape(color), textAnchor, escape(s))
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// SVG writes the chart as an SVG image.
+func (c Chart) SVG(w io.Writer) error {
+	cv := &svgCanvas{w: bufio.NewWriter(w)}
+
+	cv.printf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="%d">`+"\n", c.Width, c.Height, c.Width, c.Height, fontSize)
+	cv.printf("<title>%s</title>\n", escape(c.Title))
+	c.draw(cv)
+	cv.printf("</svg>\n")
+
+	if cv.err != nil {
+		return cv.err
+	}
+
+	return cv.w.Flush()
+}
@@ -0,0 +1,277 @@
+// Package spool implements a durable append-only on-disk queue.
+//
+// Records are appended to segment files in a directory. Segments are drained oldest first and removed once
+// they were processed successfully, so records survive process restarts and are delivered in order.
+package spool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrSpoolFull = errors.New("spool is full")
+var ErrSpoolClosed = errors.New("spool is closed")
+
+const segmentExtension = ".seg"
+
+// recordHeaderSize is the size of the length and checksum which precede every record.
+const recordHeaderSize = 8
+
+type segment struct {
+	seq  uint64
+	size int64
+}
+
+// Spool is an append-only queue of records stored in segment files.
+type Spool struct {
+	dir          string
+	maxBytes     int64
+	segmentBytes int64
+
+	mu       sync.Mutex
+	segments []segment
+	size     int64
+	// current is the segment records are appended to, nil when a new segment has to be started.
+	current *os.File
+	closed  bool
+}
+
+// Open opens the spool in dir, creating the directory if needed. Segments left by a previous run are recovered.
+// maxBytes limits the total size of all segments, segmentBytes is the size after which a new segment is started.
+func Open(dir string, maxBytes int64, segmentBytes int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Spool{dir: dir, maxBytes: maxBytes, segmentBytes: segmentBytes}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExtension) {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExtension), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		s.segments = append(s.segments, segment{seq: seq, size: info.Size()})
+		s.size += info.Size()
+	}
+
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].seq < s.segments[j].seq })
+
+	return s, nil
+}
+
+// Size returns the total size of all segments in bytes, it is 0 when there is nothing to drain.
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.size
+}
+
+// Append durably appends records to the spool. Either all records are appended or none.
+func (s *Spool) Append(records [][]byte) error {
+	var buf []byte
+	for _, record := range records {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(record)))
+		buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(record))
+		buf = append(buf, record...)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrSpoolClosed
+	}
+
+	if s.size+int64(len(buf)) > s.maxBytes {
+		return ErrSpoolFull
+	}
+
+	if s.current == nil || s.segments[len(s.segments)-1].size >= s.segmentBytes {
+		if err := s.startSegment(); err != nil {
+			return err
+		}
+	}
+
+	last := &s.segments[len(s.segments)-1]
+
+	if _, err := s.current.Write(buf); err != nil {
+		// drop a partially written tail so that the segment stays readable
+		s.current.Truncate(last.size)
+		return err
+	}
+
+	if err := s.current.Sync(); err != nil {
+		return err
+	}
+
+	last.size += int64(len(buf))
+	s.size += int64(len(buf))
+
+	return nil
+}
+
+// startSegment closes the current segment and creates a new one.
+func (s *Spool) startSegment() error {
+	if s.current != nil {
+		if err := s.current.Close(); err != nil {
+			return err
+		}
+		s.current = nil
+	}
+
+	var seq uint64 = 1
+	if len(s.segments) > 0 {
+		seq = s.segments[len(s.segments)-1].seq + 1
+	}
+
+	f, err := os.OpenFile(s.segmentPath(seq), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	s.current = f
+	s.segments = append(s.segments, segment{seq: seq})
+
+	return nil
+}
+
+// Drain reads the records of the oldest segment and passes them to fn. The segment is removed when fn succeeds
+// and kept for the next attempt otherwise. It returns false when there was nothing to drain.
+// Drain may be called concurrently with Append, but not with another Drain.
+func (s *Spool) Drain(fn func(records [][]byte) error) (bool, error) {
+	s.mu.Lock()
+
+	if len(s.segments) == 0 {
+		s.mu.Unlock()
+		return false, nil
+	}
+
+	oldest := s.segments[0]
+
+	// stop appending to the segment which is about to be drained
+	if len(s.segments) == 1 && s.current != nil {
+		if err := s.current.Close(); err != nil {
+			s.mu.Unlock()
+			return false, err
+		}
+		s.current = nil
+	}
+
+	s.mu.Unlock()
+
+	records, err := readSegment(s.segmentPath(oldest.seq))
+	if err != nil {
+		return false, err
+	}
+
+	if len(records) > 0 {
+		if err := fn(records); err != nil {
+			return false, err
+		}
+	}
+
+	if err := os.Remove(s.segmentPath(oldest.seq)); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	s.segments = s.segments[1:]
+	s.size -= oldest.size
+	s.mu.Unlock()
+
+	return true, nil
+}
+
+// Close closes the current segment. Spooled records are kept on disk.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+
+	if s.current == nil {
+		return nil
+	}
+
+	err := s.current.Close()
+	s.current = nil
+
+	return err
+}
+
+func (s *Spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, segmentExtension))
+}
+
+// readSegment reads all records of a segment. A truncated or corrupted tail, e.g. after a crash during a write, is ignored.
+func readSegment(path string) ([][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(f)
+	records := make([][]byte, 0)
+	header := make([]byte, recordHeaderSize)
+
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return records, nil
+			}
+			return nil, err
+		}
+
+		length := int64(binary.BigEndian.Uint32(header[:4]))
+		if length > info.Size() {
+			return records, nil
+		}
+
+		record := make([]byte, length)
+		if _, err := io.ReadFull(r, record); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return records, nil
+			}
+			return nil, err
+		}
+
+		if crc32.ChecksumIEEE(record) != binary.BigEndian.Uint32(header[4:]) {
+			return records, nil
+		}
+
+		records = append(records, record)
+	}
+}
@@ -0,0 +1,140 @@
+package spool
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func records(values ...string) [][]byte {
+	r := make([][]byte, 0, len(values))
+	for _, v := range values {
+		r = append(r, []byte(v))
+	}
+	return r
+}
+
+func drainAll(t *testing.T, s *Spool) [][]byte {
+	drained := make([][]byte, 0)
+	for {
+		ok, err := s.Drain(func(r [][]byte) error {
+			drained = append(drained, r...)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			return drained
+		}
+	}
+}
+
+func Test_Spool(t *testing.T) {
+	s, err := Open(t.TempDir(), 1024, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, r := range [][][]byte{records("a", "b"), records("c"), records("d", "e")} {
+		if err := s.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if s.Size() == 0 {
+		t.Error("expected spool not to be empty")
+	}
+
+	if diff := cmp.Diff(records("a", "b", "c", "d", "e"), drainAll(t, s)); diff != "" {
+		t.Error(diff)
+	}
+
+	if diff := cmp.Diff(int64(0), s.Size()); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_Spool_recovery(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := Open(dir, 1024, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Append(records("a", "b")); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// simulate a crash in the middle of a write
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExtension))
+	f, err := os.OpenFile(segments[0], os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 9, 1, 2})
+	f.Close()
+
+	s, err = Open(dir, 1024, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Append(records("c")); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(records("a", "b", "c"), drainAll(t, s)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_Spool_drainError(t *testing.T) {
+	s, err := Open(t.TempDir(), 1024, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Append(records("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	drainErr := errors.New("database error")
+	if _, err := s.Drain(func([][]byte) error { return drainErr }); !errors.Is(err, drainErr) {
+		t.Errorf("expected %v, got %v", drainErr, err)
+	}
+
+	// records are kept when draining failed
+	if diff := cmp.Diff(records("a"), drainAll(t, s)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_Spool_full(t *testing.T) {
+	s, err := Open(t.TempDir(), 20, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Append(records("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Append(records("0123456789")); !errors.Is(err, ErrSpoolFull) {
+		t.Errorf("expected %v, got %v", ErrSpoolFull, err)
+	}
+
+	drainAll(t, s)
+
+	if err := s.Append(records("0123456789")); err != nil {
+		t.Error(err)
+	}
+}
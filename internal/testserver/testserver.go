@@ -67,3 +67,25 @@ func (ts *TestServer) Patch(t *testing.T, urlPath string, requestBody []byte) (i
 
 	return rs.StatusCode, rs.Header, body
 }
+
+func (ts *TestServer) Delete(t *testing.T, urlPath string) (int, http.Header, []byte) {
+	req := httptest.NewRequest(
+		http.MethodDelete,
+		ts.Server.URL+urlPath,
+		nil,
+	)
+	req.RequestURI = ""
+
+	rs, err := ts.Server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, body
+}
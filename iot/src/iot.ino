@@ -75,7 +75,7 @@ void loop(void)
     if (currentMillis - lastMqttMessageSentMillis >= mqttMessageInterval) {
       // save the last time a message was sent
       lastMqttMessageSentMillis = currentMillis;
-      String message = encodeMqttMessage(sensorId, iaqSensor.iaq, iaqSensor.co2Equivalent, iaqSensor.breathVocEquivalent, iaqSensor.pressure, iaqSensor.temperature, iaqSensor.humidity);
+      String message = encodeMqttMessage(sensorId, iaqSensor.iaq, iaqSensor.co2Equivalent, iaqSensor.breathVocEquivalent, iaqSensor.pressure, iaqSensor.temperature, iaqSensor.humidity, getTime());
       sendMqttMessage(mqttTopic, message); 
     }
   } else {
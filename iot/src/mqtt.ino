@@ -17,7 +17,7 @@ void connectToMqttBroker(char host[], int port, char username[], char password[]
   Serial.println();
 }
 
-String encodeMqttMessage (char sensorId[], float iaq, float co2Equivalent, float breathVocEquivalent, float pressure, float temperature, float humidity){
+String encodeMqttMessage (char sensorId[], float iaq, float co2Equivalent, float breathVocEquivalent, float pressure, float temperature, float humidity, unsigned long timestamp){
     String message = "";
     message += String(sensorId);
     message +=" ";
@@ -32,6 +32,11 @@ String encodeMqttMessage (char sensorId[], float iaq, float co2Equivalent, float
     message += String(temperature);
     message +=" ";
     message += String(humidity);
+    // sample time, 0 when the time is not known yet
+    if (timestamp > 0) {
+      message +=" ";
+      message += String(timestamp);
+    }
 
     return message;
 }